@@ -0,0 +1,178 @@
+/*
+ *Descript:检查aof文件(redis-check-aof),可以截断到最后一个完整的命令
+ */
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrAofUnexpectedMulti = "unexpected MULTI"
+	ErrAofUnexpectedExec  = "unexpected EXEC"
+	ErrAofMultiNotExec    = "MULTI without EXEC"
+	ErrAofFixPreamble     = "corruption in rdb preamble can not be fixed"
+	ErrAofNoCorruption    = "aof has no corruption"
+)
+
+// aof检查结果
+type CheckResult struct {
+	Size        int64 // 文件大小
+	Commands    int64 // 完整的命令数量(不包括没有EXEC的事务)
+	ValidSize   int64 // 最后一个完整的命令(事务)的结束位置,修复时截断到这里
+	ValidLine   int64 // ValidSize之后第一行的行号(从1开始)
+	ErrOffset   int64 // 第一个错误的命令(或者没有EXEC的MULTI)的起始位置
+	ErrLine     int64 // ErrOffset处的行号
+	Err         error // 第一个错误,nil表示aof完整
+	RDBPreamble bool  // 错误在rdb preamble中,不能修复
+}
+
+// 检查aof文件:校验每一个命令和事务,找到第一个错误的位置
+func CheckAof(ctx context.Context, path string) (*CheckResult, error) {
+	p, err := NewAofFileParser(path)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	info, err := p.file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat "+path)
+	}
+	r := &CheckResult{Size: info.Size()}
+	if p.HasRDBPreamble() {
+		err = p.ParseRDBPreamble(ctx, func(ctx context.Context, object parser.TypeObject) error {
+			return nil
+		}, parser.ParseArg{CheckSum: true})
+		if err != nil {
+			r.Err, r.RDBPreamble = err, true
+			return r, nil
+		}
+		r.ValidSize = p.RESPOffset()
+	}
+	var multiOffset int64 = -1 // 事务中MULTI的起始位置
+	var multiCommands int64
+	for r.Err == nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		offset := p.GetLastCommandOffset()
+		cmd, err := p.GetNextAofCommand()
+		if err == io.EOF && p.GetLastCommandOffset() == r.Size {
+			break
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			r.Err, r.ErrOffset = err, offset
+			break
+		}
+		name := ""
+		if len(cmd) > 0 {
+			name = strings.ToLower(cmd[0])
+		}
+		switch {
+		case name == "multi" && multiOffset >= 0:
+			r.Err, r.ErrOffset = errors.New(ErrAofUnexpectedMulti), offset
+			continue
+		case name == "multi":
+			multiOffset, multiCommands = offset, 0
+		case name == "exec" && multiOffset < 0:
+			r.Err, r.ErrOffset = errors.New(ErrAofUnexpectedExec), offset
+			continue
+		case name == "exec":
+			r.Commands += multiCommands + 2
+			multiOffset = -1
+		case multiOffset >= 0:
+			multiCommands++
+		default:
+			r.Commands++
+		}
+		if multiOffset < 0 {
+			r.ValidSize = p.GetLastCommandOffset()
+		}
+	}
+	if r.Err == nil && multiOffset >= 0 {
+		r.Err, r.ErrOffset = errors.New(ErrAofMultiNotExec), multiOffset
+	}
+	if r.Err == nil {
+		r.ValidSize = r.Size
+	}
+	r.ValidLine, r.ErrLine, err = lineNumbers(path, r.ValidSize, r.ErrOffset)
+	return r, err
+}
+
+// 两个offset处的行号(从1开始)
+func lineNumbers(path string, offsetA, offsetB int64) (int64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var lineA, lineB, offset int64 = 1, 1, 0
+	buf := make([]byte, 64*1024)
+	for offset < offsetA || offset < offsetB {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			if end := offsetA - offset; end > 0 {
+				lineA += int64(bytes.Count(chunk[:minInt64(end, int64(n))], []byte{Return}))
+			}
+			if end := offsetB - offset; end > 0 {
+				lineB += int64(bytes.Count(chunk[:minInt64(end, int64(n))], []byte{Return}))
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return lineA, lineB, nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// 将aof的前r.ValidSize字节写入dst:去掉第一个错误之后的全部数据
+func FixAof(path, dst string, r *CheckResult) error {
+	if r.Err == nil {
+		return errors.New(ErrAofNoCorruption)
+	}
+	if r.RDBPreamble {
+		return errors.New(ErrAofFixPreamble)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(dstFile, src, r.ValidSize); err != nil {
+		dstFile.Close()
+		return errors.Wrap(err, fmt.Sprintf("copy %d bytes to %s", r.ValidSize, dst))
+	}
+	return dstFile.Close()
+}
@@ -0,0 +1,125 @@
+package aof
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// 一个完整的命令:27字节,7行
+const checkGood = "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n"
+
+// 写入aof文件
+func writeTestAof(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckAof(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check_aof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name string
+		bad  string // 追加在checkGood之后的数据
+		err  string // 错误信息包含的内容,为空表示aof完整
+		eof  bool   // 错误是文件被截断
+	}{
+		{"valid", "", "", false},
+		{"torn bulk string", "*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$5\r\nab", ErrDataLen, true},
+		{"torn line", "*3\r\n$3\r\nSE", "", true},
+		{"bad bulk length", "*1\r\n$x\r\nPING\r\n", ErrDataLen, false},
+		{"negative bulk length", "*1\r\n$-1\r\nPING\r\n", ErrDataLen, false},
+		{"huge bulk length", "*1\r\n$1073741824\r\nPING\r\n", ErrDataLen, false},
+		{"bulk length beyond file", "*1\r\n$100000000\r\nPING\r\n", ErrDataLen, true},
+		{"bad multibulk length", "*x\r\n$4\r\nPING\r\n", ErrCommandLenFormat, false},
+		{"negative multibulk length", "*-1\r\n$4\r\nPING\r\n", ErrCommandLenFormat, false},
+		{"huge multibulk length", "*99999999999\r\n$4\r\nPING\r\n", ErrCommandLenFormat, false},
+		{"multibulk length beyond file", "*1000\r\n$4\r\nPING\r\n", ErrCommandLenFormat, true},
+		{"missing crlf after bulk", "*1\r\n$4\r\nPINGxx*1\r\n$4\r\nPING\r\n", ErrAofLineEndFormat, false},
+		{"missing cr in line", "*1\n$4\r\nPING\r\n", ErrAofLineEndFormat, false},
+		{"multi without exec", "*1\r\n$5\r\nMULTI\r\n" + checkGood, ErrAofMultiNotExec, false},
+		{"exec without multi", "*1\r\n$4\r\nEXEC\r\n", ErrAofUnexpectedExec, false},
+	}
+	for _, c := range cases {
+		path := writeTestAof(t, dir, strings.Replace(c.name, " ", "_", -1)+".aof", checkGood+c.bad)
+		r, err := CheckAof(context.TODO(), path)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if r.Size != int64(len(checkGood+c.bad)) {
+			t.Errorf("%s: size %d", c.name, r.Size)
+		}
+		if c.bad == "" {
+			if r.Err != nil || r.ValidSize != r.Size || r.Commands != 1 {
+				t.Errorf("%s: err %v valid size %d commands %d", c.name, r.Err, r.ValidSize, r.Commands)
+			}
+			continue
+		}
+		if r.Err == nil {
+			t.Errorf("%s: no error", c.name)
+			continue
+		}
+		if !strings.Contains(r.Err.Error(), c.err) {
+			t.Errorf("%s: error %v, want %s", c.name, r.Err, c.err)
+		}
+		if eof := errors.Cause(r.Err) == io.ErrUnexpectedEOF; eof != c.eof {
+			t.Errorf("%s: error %v, unexpected eof %v", c.name, r.Err, c.eof)
+		}
+		if r.ErrOffset != int64(len(checkGood)) || r.ErrLine != 8 {
+			t.Errorf("%s: error offset %d line %d, want %d line 8", c.name, r.ErrOffset, r.ErrLine, len(checkGood))
+		}
+		if r.ValidSize != int64(len(checkGood)) || r.ValidLine != 8 || r.Commands != 1 {
+			t.Errorf("%s: valid size %d line %d commands %d", c.name, r.ValidSize, r.ValidLine, r.Commands)
+		}
+	}
+}
+
+func TestFixAof(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fix_aof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeTestAof(t, dir, "torn.aof", checkGood+"*1\r\n$5\r\nMULTI\r\n"+checkGood+"*2\r\n$4\r\nINCR\r\n$3\r\nab")
+	r, err := CheckAof(context.TODO(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Err == nil {
+		t.Fatal("no error")
+	}
+	dst := filepath.Join(dir, "fixed.aof")
+	if err = FixAof(path, dst, r); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte(checkGood)) {
+		t.Fatalf("fixed aof %q", data)
+	}
+	fixed, err := CheckAof(context.TODO(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed.Err != nil || fixed.Commands != 1 || fixed.ValidSize != int64(len(checkGood)) {
+		t.Fatalf("fixed aof err %v commands %d valid size %d", fixed.Err, fixed.Commands, fixed.ValidSize)
+	}
+	if err = FixAof(dst, filepath.Join(dir, "again.aof"), fixed); err == nil || err.Error() != ErrAofNoCorruption {
+		t.Fatalf("fix valid aof: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ *Descript:跟踪aof文件(类似tail -f),持续输出追加的命令
+ */
+package aof
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const defaultFollowInterval = 100 * time.Millisecond // 默认检查文件的间隔
+
+// 跟踪参数
+type FollowArg struct {
+	Offset          int64                                                     // 开始的offset(命令的起始位置),0为从头开始
+	PollInterval    time.Duration                                             // 没有新数据时检查文件的间隔,默认100ms
+	PreambleHandler func(ctx context.Context, object parser.TypeObject) error // 文件开头的rdb preamble交给这个handler,为nil则跳过
+}
+
+// 跟踪输出的命令
+type FollowCommand struct {
+	Cmd       []string
+	Offset    int64 // 命令的起始offset
+	Rewritten bool  // 文件被重写(或者轮转)之后从新文件读取的第一个命令,新文件从头开始读取
+}
+
+// aof跟踪器
+type AofFollower struct {
+	path      string
+	arg       FollowArg
+	parser    *AofParser
+	info      os.FileInfo // 当前打开的文件,用于检查重写和轮转
+	rewritten bool
+	err       error
+}
+
+// 跟踪aof文件:path为单个aof文件
+func NewAofFollower(path string, arg FollowArg) (*AofFollower, error) {
+	if arg.PollInterval <= 0 {
+		arg.PollInterval = defaultFollowInterval
+	}
+	f := &AofFollower{
+		path: path,
+		arg:  arg,
+	}
+	if err := f.open(arg.Offset); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// 打开文件,从offset开始读取
+func (f *AofFollower) open(offset int64) error {
+	p, err := NewAofFileParser(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := p.file.Stat()
+	if err != nil {
+		p.Close()
+		return errors.Wrap(err, "stat "+f.path)
+	}
+	if offset > 0 {
+		if err = p.ResetFileOffset(offset); err != nil {
+			p.Close()
+			return err
+		}
+	}
+	if f.parser != nil {
+		f.parser.Close()
+	}
+	f.parser, f.info = p, info
+	return nil
+}
+
+// 获取下一个命令:没有新的数据时等待,最后一个命令还没有写完整时回到命令的起始位置等待
+func (f *AofFollower) Next(ctx context.Context) (FollowCommand, error) {
+	for {
+		if err := f.parsePreamble(ctx); err != nil {
+			return FollowCommand{}, err
+		}
+		offset := f.parser.GetLastCommandOffset()
+		cmd, err := f.parser.GetNextAofCommand()
+		if err == nil {
+			command := FollowCommand{Cmd: cmd, Offset: offset, Rewritten: f.rewritten}
+			f.rewritten = false
+			return command, nil
+		}
+		if err != io.EOF && errors.Cause(err) != io.ErrUnexpectedEOF {
+			return FollowCommand{}, errors.Wrap(err, fmt.Sprintf("read aof command at offset %d", offset))
+		}
+		if err = f.parser.ResetFileOffset(offset); err != nil {
+			return FollowCommand{}, err
+		}
+		if err = f.wait(ctx, offset); err != nil {
+			return FollowCommand{}, err
+		}
+	}
+}
+
+// 处理文件开头的rdb preamble
+func (f *AofFollower) parsePreamble(ctx context.Context) error {
+	if !f.parser.HasRDBPreamble() {
+		return nil
+	}
+	if f.arg.PreambleHandler == nil {
+		return f.parser.SkipRDBPreamble(ctx)
+	}
+	return f.parser.ParseRDBPreamble(ctx, f.arg.PreambleHandler, parser.ParseArg{})
+}
+
+// 等待文件追加数据:文件变小(原地重写)或者inode变化(重写之后rename,轮转)则重新打开新文件
+func (f *AofFollower) wait(ctx context.Context, offset int64) error {
+	ticker := time.NewTicker(f.arg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		info, err := os.Stat(f.path)
+		if err != nil { // rename的过程中文件可能暂时不存在
+			continue
+		}
+		if !os.SameFile(info, f.info) || info.Size() < offset {
+			f.rewritten = true
+			return f.open(0)
+		}
+		if info.Size() > offset {
+			return nil
+		}
+	}
+}
+
+// 以channel的方式输出命令:出错或者ctx结束时关闭channel,错误通过Err获取
+func (f *AofFollower) Follow(ctx context.Context) <-chan FollowCommand {
+	commands := make(chan FollowCommand)
+	go func() {
+		defer close(commands)
+		for {
+			command, err := f.Next(ctx)
+			if err != nil {
+				f.err = err
+				return
+			}
+			select {
+			case commands <- command:
+			case <-ctx.Done():
+				f.err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return commands
+}
+
+// Follow的channel关闭的原因
+func (f *AofFollower) Err() error {
+	return f.err
+}
+
+// 已经输出的命令之后的offset:可以作为FollowArg.Offset继续跟踪
+func (f *AofFollower) Offset() int64 {
+	return f.parser.GetLastCommandOffset()
+}
+
+// 关闭
+func (f *AofFollower) Close() error {
+	return f.parser.Close()
+}
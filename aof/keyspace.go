@@ -0,0 +1,227 @@
+/*
+ *Descript:aof重放的内存keyspace
+ */
+package aof
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	ErrNoSuchKey = "no such key"
+)
+
+// 内存中的一个key
+type keyValue struct {
+	kind   string // parser.ObjectType*
+	expire int64  // 过期时间(毫秒时间戳),0表示不过期
+	str    string
+	list   *listValue
+	hash   map[string]string
+	set    map[string]struct{}
+	zset   map[string]float64
+	stream *streamValue
+}
+
+// 一个db
+type database map[string]*keyValue
+
+// 内存keyspace:aof重放的结果
+type Keyspace struct {
+	dbs map[uint64]database
+}
+
+// 创建一个空的keyspace
+func NewKeyspace() *Keyspace {
+	return &Keyspace{dbs: make(map[uint64]database)}
+}
+
+// 获取db,不存在则创建
+func (k *Keyspace) db(index uint64) database {
+	db, ok := k.dbs[index]
+	if !ok {
+		db = make(database)
+		k.dbs[index] = db
+	}
+	return db
+}
+
+// 有数据的db,按照编号排序
+func (k *Keyspace) DBs() []uint64 {
+	dbs := make([]uint64, 0, len(k.dbs))
+	for index, db := range k.dbs {
+		if len(db) > 0 {
+			dbs = append(dbs, index)
+		}
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i] < dbs[j] })
+	return dbs
+}
+
+// db中key的数量
+func (k *Keyspace) Len(index uint64) int {
+	return len(k.dbs[index])
+}
+
+// 获取key对应的object
+func (k *Keyspace) Object(index uint64, key string) (parser.TypeObject, bool) {
+	v, ok := k.dbs[index][key]
+	if !ok {
+		return nil, false
+	}
+	return v.object(key), true
+}
+
+// 按照rdb解析器的顺序输出object:SelectDB,ResizeDB,key(按照名称排序)
+func (k *Keyspace) Export(ctx context.Context, f func(ctx context.Context, object parser.TypeObject) error) error {
+	for _, index := range k.DBs() {
+		db := k.dbs[index]
+		keys := make([]string, 0, len(db))
+		var expireSize uint64
+		for key, v := range db {
+			keys = append(keys, key)
+			if v.expire > 0 {
+				expireSize++
+			}
+		}
+		sort.Strings(keys)
+		if err := f(ctx, parser.SelectionDB{Index: index}); err != nil {
+			return err
+		}
+		if err := f(ctx, parser.ResizeDB{DBSize: uint64(len(keys)), ExpireSize: expireSize}); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if err := f(ctx, db[key].object(key)); err != nil {
+				return errors.Wrap(err, "export key "+key)
+			}
+		}
+	}
+	return nil
+}
+
+// 转换为rdb解析器输出的object
+func (v *keyValue) object(key string) parser.TypeObject {
+	k := parser.NewKeyObject([]byte(key), v.expire)
+	switch v.kind {
+	case parser.ObjectTypeString:
+		return parser.NewStringObject(k, []byte(v.str))
+	case parser.ObjectTypeList:
+		entries := v.list.all()
+		return parser.ListObject{Field: k.Field, Len: uint64(len(entries)), Entries: entries,
+			Expire: k.Expire, LruIdle: k.LruIdle, LfuFreq: k.LfuFreq}
+	case parser.ObjectTypeHash:
+		fields := sortedKeys(v.hash)
+		entries := make([]parser.HashEntry, 0, len(fields))
+		for _, field := range fields {
+			entries = append(entries, parser.HashEntry{Field: field, Value: v.hash[field]})
+		}
+		return parser.HashMap{Field: k.Field, Len: uint64(len(entries)), Entry: entries,
+			Expire: k.Expire, LruIdle: k.LruIdle, LfuFreq: k.LfuFreq}
+	case parser.ObjectTypeSet:
+		members := make([]string, 0, len(v.set))
+		for member := range v.set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return parser.Set{Field: k.Field, Len: uint64(len(members)), Entries: members,
+			Expire: k.Expire, LruIdle: k.LruIdle, LfuFreq: k.LfuFreq}
+	case parser.ObjectTypeSortedSet:
+		members := sortedZSet(v.zset)
+		entries := make([]parser.SortedSetEntry, 0, len(members))
+		for _, member := range members {
+			entries = append(entries, parser.SortedSetEntry{Field: member, Score: v.zset[member]})
+		}
+		return parser.SortedSet{Field: k.Field, Len: uint64(len(entries)), Entries: entries,
+			Expire: k.Expire, LruIdle: k.LruIdle, LfuFreq: k.LfuFreq}
+	default:
+		return v.stream.object(k)
+	}
+}
+
+// 集合类型是否为空,空的key需要删除
+func (v *keyValue) empty() bool {
+	switch v.kind {
+	case parser.ObjectTypeList:
+		return v.list.len() == 0
+	case parser.ObjectTypeHash:
+		return len(v.hash) == 0
+	case parser.ObjectTypeSet:
+		return len(v.set) == 0
+	case parser.ObjectTypeSortedSet:
+		return len(v.zset) == 0
+	}
+	return false
+}
+
+// 深拷贝(COPY命令)
+func (v *keyValue) clone() *keyValue {
+	c := &keyValue{kind: v.kind, expire: v.expire, str: v.str}
+	switch v.kind {
+	case parser.ObjectTypeList:
+		c.list = &listValue{tail: v.list.all()}
+	case parser.ObjectTypeHash:
+		c.hash = make(map[string]string, len(v.hash))
+		for field, val := range v.hash {
+			c.hash[field] = val
+		}
+	case parser.ObjectTypeSet:
+		c.set = make(map[string]struct{}, len(v.set))
+		for member := range v.set {
+			c.set[member] = struct{}{}
+		}
+	case parser.ObjectTypeSortedSet:
+		c.zset = make(map[string]float64, len(v.zset))
+		for member, score := range v.zset {
+			c.zset[member] = score
+		}
+	case parser.ObjectTypeStream:
+		c.stream = v.stream.clone()
+	}
+	return c
+}
+
+// 创建指定类型的空value
+func newKeyValue(kind string) *keyValue {
+	v := &keyValue{kind: kind}
+	switch kind {
+	case parser.ObjectTypeList:
+		v.list = &listValue{}
+	case parser.ObjectTypeHash:
+		v.hash = make(map[string]string)
+	case parser.ObjectTypeSet:
+		v.set = make(map[string]struct{})
+	case parser.ObjectTypeSortedSet:
+		v.zset = make(map[string]float64)
+	case parser.ObjectTypeStream:
+		v.stream = newStreamValue()
+	}
+	return v
+}
+
+// 排序的map key
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 当前毫秒时间戳
+func nowMS() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,205 @@
+/*
+ *Descript:解析多文件aof(redis 7.0+)的manifest
+ */
+package aof
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ManifestSuffix   = ".manifest"
+	AofFileTypeBase  = "b" // base文件:rdb或者aof格式
+	AofFileTypeHist  = "h" // 历史文件:等待删除,不需要加载
+	AofFileTypeIncr  = "i" // 增量文件:aof格式
+	ErrManifest      = "invalid aof manifest"
+	ErrManifestFound = "aof manifest not found"
+)
+
+// manifest中的一个文件
+type ManifestFile struct {
+	Name string // 文件名,相对于appenddirname
+	Seq  int64
+	Type string // AofFileType*
+}
+
+// manifest:一个base文件和按照seq排列的incr文件
+type Manifest struct {
+	Base    *ManifestFile
+	Incr    []ManifestFile
+	History []ManifestFile
+}
+
+// 读取manifest文件
+func LoadManifest(path string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open manifest "+path)
+	}
+	defer file.Close()
+	return ParseManifest(file)
+}
+
+// 解析manifest:每行为 file <name> seq <seq> type <b|h|i>,#开头为注释
+func ParseManifest(reader io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := splitManifestLine(line)
+		if err != nil || len(args) < 6 || len(args)%2 != 0 {
+			return nil, errors.New(fmt.Sprintf("%s line %d: %s", ErrManifest, lineNum, line))
+		}
+		var f ManifestFile
+		for i := 0; i < len(args); i += 2 {
+			switch args[i] {
+			case "file":
+				f.Name = args[i+1]
+			case "seq":
+				if f.Seq, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+					return nil, errors.New(fmt.Sprintf("%s line %d: seq %s", ErrManifest, lineNum, args[i+1]))
+				}
+			case "type":
+				f.Type = args[i+1]
+			}
+		}
+		if f.Name == "" || strings.ContainsAny(f.Name, "/\\") {
+			return nil, errors.New(fmt.Sprintf("%s line %d: file %s", ErrManifest, lineNum, f.Name))
+		}
+		switch f.Type {
+		case AofFileTypeBase:
+			if m.Base != nil {
+				return nil, errors.New(fmt.Sprintf("%s line %d: duplicate base file", ErrManifest, lineNum))
+			}
+			base := f
+			m.Base = &base
+		case AofFileTypeHist:
+			m.History = append(m.History, f)
+		case AofFileTypeIncr:
+			if n := len(m.Incr); n > 0 && f.Seq <= m.Incr[n-1].Seq {
+				return nil, errors.New(fmt.Sprintf("%s line %d: incr seq %d not increasing", ErrManifest, lineNum, f.Seq))
+			}
+			m.Incr = append(m.Incr, f)
+		default:
+			return nil, errors.New(fmt.Sprintf("%s line %d: type %s", ErrManifest, lineNum, f.Type))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read manifest")
+	}
+	if m.Base == nil && len(m.Incr) == 0 {
+		return nil, errors.New(ErrManifest + ": no base and incr file")
+	}
+	return m, nil
+}
+
+// 需要加载的文件:base文件和incr文件
+func (m *Manifest) Files() []ManifestFile {
+	files := make([]ManifestFile, 0, len(m.Incr)+1)
+	if m.Base != nil {
+		files = append(files, *m.Base)
+	}
+	return append(files, m.Incr...)
+}
+
+// 按照空格分割,支持双引号和转义(redis sdssplitargs)
+func splitManifestLine(line string) ([]string, error) {
+	var args []string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		if line[i] != '"' {
+			j := strings.IndexAny(line[i:], " \t")
+			if j < 0 {
+				j = len(line) - i
+			}
+			args = append(args, line[i:i+j])
+			i += j
+			continue
+		}
+		var arg []byte
+		i++
+		for {
+			if i >= len(line) {
+				return nil, errors.New("unbalanced quotes")
+			}
+			c := line[i]
+			if c == '"' {
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				case 'x':
+					if i+2 < len(line) {
+						if v, err := strconv.ParseUint(line[i+1:i+3], 16, 8); err == nil {
+							c = byte(v)
+							i += 2
+							break
+						}
+					}
+					c = 'x'
+				default:
+					c = line[i]
+				}
+			}
+			arg = append(arg, c)
+			i++
+		}
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			return nil, errors.New("closing quote must be followed by a space")
+		}
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// 查找manifest:path为manifest文件或者appenddirname目录
+func FindManifest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "stat "+path)
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(path, "*"+ManifestSuffix))
+	if err != nil {
+		return "", errors.Wrap(err, "find manifest")
+	}
+	if len(matches) != 1 {
+		return "", errors.New(fmt.Sprintf("%s in %s, found %d", ErrManifestFound, path, len(matches)))
+	}
+	return matches[0], nil
+}
+
+// 是否为多文件aof:appenddirname目录或者manifest文件
+func IsMultiPartAof(path string) bool {
+	if strings.HasSuffix(path, ManifestSuffix) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,110 @@
+/*
+ *Descript:多文件aof(redis 7.0+):appenddirname中的base文件和incr文件
+ */
+package aof
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// 多文件aof:按照manifest的顺序读取base文件和incr文件
+type MultiPartAof struct {
+	dir      string
+	manifest *Manifest
+}
+
+// 打开多文件aof:path为appenddirname目录或者manifest文件
+func NewMultiPartAof(path string) (*MultiPartAof, error) {
+	manifestPath, err := FindManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := LoadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	return &MultiPartAof{
+		dir:      filepath.Dir(manifestPath),
+		manifest: manifest,
+	}, nil
+}
+
+// 获取manifest
+func (m *MultiPartAof) Manifest() *Manifest {
+	return m.manifest
+}
+
+// 需要加载的文件全路径:base文件,incr文件
+func (m *MultiPartAof) Files() []string {
+	var files []string
+	for _, f := range m.manifest.Files() {
+		files = append(files, filepath.Join(m.dir, f.Name))
+	}
+	return files
+}
+
+// 按照顺序读取全部文件:rdb格式的数据(rdb格式的base文件或者rdb preamble)交给RDBParser解析,
+// 之后的命令交给cmdHandler.最后一个文件末尾不完整的命令会忽略(aof-load-truncated yes),其他文件不完整时报错
+func (m *MultiPartAof) Read(ctx context.Context, rdbHandler func(ctx context.Context, object parser.TypeObject) error,
+	cmdHandler func(cmd []string) error, arg parser.ParseArg) error {
+	files := m.Files()
+	for i, file := range files {
+		if err := readAofFile(ctx, file, i == len(files)-1, rdbHandler, cmdHandler, arg); err != nil {
+			return errors.Wrap(err, file)
+		}
+	}
+	return nil
+}
+
+// 读取一个aof文件,rdb格式的base文件和rdb preamble一样处理
+func readAofFile(ctx context.Context, path string, last bool, rdbHandler func(ctx context.Context, object parser.TypeObject) error,
+	cmdHandler func(cmd []string) error, arg parser.ParseArg) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	p, err := NewAofParser(file)
+	if err != nil {
+		return err
+	}
+	if err = p.ParseRDBPreamble(ctx, rdbHandler, arg); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		cmd, err := p.GetNextAofCommand()
+		if err == io.EOF && p.GetLastCommandOffset() == info.Size() {
+			return nil
+		}
+		// 只有最后一个文件末尾的命令可以不完整,base文件和其他incr文件不完整说明文件损坏
+		if err == io.EOF || errors.Cause(err) == io.ErrUnexpectedEOF {
+			if last {
+				return nil
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("read aof command at offset %d", p.GetLastCommandOffset()))
+		}
+		if err = cmdHandler(cmd); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("aof command at offset %d", p.GetLastCommandOffset()))
+		}
+	}
+}
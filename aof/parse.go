@@ -19,6 +19,7 @@ const (
 	Star     = 42 // *
 	Comm     = 58 // :
 	Minus    = 45 // -
+	Sharp    = 35 // #
 
 	ErrNotForkAofFormat    = "not fork aof format"
 	ErrDataLineFormat      = "data line format"
@@ -26,6 +27,10 @@ const (
 	ErrCommandLenFormat    = "command len format"
 	ErrAofLineLengthFormat = "aof line length format"
 	ErrAofLineEndFormat    = "aof line end format"
+
+	maxBulkLen      = 512 * 1024 * 1024 // proto-max-bulk-len的默认值
+	maxMultiBulkLen = 1<<31 - 1         // redis允许的最大参数数量
+	minBulkSize     = 6                 // 最短的参数:$0\r\n\r\n
 )
 
 // 获取命令
@@ -38,13 +43,23 @@ func (a *AofParser) GetLastCommandOffset() int64 {
 	return a.nextCmdOffset
 }
 
+// 缓冲区中还没有解析的数据长度
+func (a *AofParser) Buffered() int {
+	return a.reader.Buffered()
+}
+
 // 重置文件的offset
 func (a *AofParser) ResetFileOffset(offset int64) (err error) {
 	if a.file == nil {
 		return errors.New("file not open")
 	}
 	a.offset, err = a.file.Seek(offset, io.SeekStart)
+	a.nextCmdOffset = a.offset
 	a.reader.Reset(a.file)
+	if a.offset == 0 {
+		// 回到文件开头需要重新处理rdb preamble
+		a.preambleDone = false
+	}
 	return
 }
 
@@ -55,16 +70,26 @@ func (a *AofParser) SetOffset(offset int64) {
 
 // 获取下一组命令
 func (a *AofParser) getNextCommand() ([]string, error) {
+	if a.HasRDBPreamble() {
+		return nil, errors.New(ErrAofRDBPreamble)
+	}
 	data, err := a.getLine()
+	for err == nil && len(data) > 0 && data[0] == Sharp { // 注释(redis7.0的#TS:时间戳)
+		a.nextCmdOffset = a.offset
+		data, err = a.getLine()
+	}
 	if err != nil {
 		return nil, err
 	}
-	if len(data) < 2 {
+	if len(data) < 2 || data[0] != Star {
 		return nil, errors.New(ErrDataLineFormat)
 	}
-	var commandLen int
-	if data[0] == Star { // 长度
-		commandLen, err = BytesToInt(data[1:])
+	commandLen, err := BytesToInt(data[1:])
+	if err != nil || commandLen < 0 || commandLen > maxMultiBulkLen {
+		return nil, errors.New(ErrCommandLenFormat)
+	}
+	if a.beyondFile(int64(commandLen) * minBulkSize) {
+		return nil, errors.Wrap(io.ErrUnexpectedEOF, ErrCommandLenFormat)
 	}
 	var commands []string
 	for i := 0; i < commandLen; i++ {
@@ -84,24 +109,27 @@ func (a *AofParser) getCommandString() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if len(data) < 2 {
+	if len(data) < 2 || data[0] != Doller {
 		return "", errors.New(ErrDataLineFormat)
 	}
-	var commandLen int
-	if data[0] == Doller { // 长度
-		commandLen, err = BytesToInt(data[1:])
-		if err != nil {
-			return "", errors.Wrap(err, ErrDataLen)
-		}
+	commandLen, err := BytesToInt(data[1:])
+	if err != nil {
+		return "", errors.Wrap(err, ErrDataLen)
+	}
+	if commandLen < 0 || commandLen > maxBulkLen {
+		return "", errors.New(ErrDataLen)
+	}
+	if a.beyondFile(int64(commandLen) + 2) { // 文件被截断,不按照长度分配内存
+		return "", errors.Wrap(io.ErrUnexpectedEOF, ErrDataLen)
 	}
 	command, err := a.getLen(commandLen + 2)
 	if err != nil {
 		return "", err
 	}
-	if len(command) < 2 {
-		return "", errors.New(ErrCommandLenFormat)
+	if command[commandLen] != Carriage || command[commandLen+1] != Return {
+		return "", errors.New(ErrAofLineEndFormat)
 	}
-	return string(command[:len(command)-2]), nil
+	return string(command[:commandLen]), nil
 }
 
 // 获取一行
@@ -122,6 +150,19 @@ func (a *AofParser) getLine() ([]byte, error) {
 	return nil, errors.New(ErrAofLineEndFormat)
 }
 
+// 文件剩下的数据不足size字节:只有文件解析器检查,文件可能还在追加,不足时重新获取文件大小
+func (a *AofParser) beyondFile(size int64) bool {
+	if a.file == nil || size <= a.fileSize-a.offset {
+		return false
+	}
+	info, err := a.file.Stat()
+	if err != nil {
+		return false
+	}
+	a.fileSize = info.Size()
+	return size > a.fileSize-a.offset
+}
+
 // 获取指定长度
 func (a *AofParser) getLen(dataLen int) ([]byte, error) {
 	var p = make([]byte, dataLen)
@@ -15,7 +15,10 @@ import (
 type AofParser struct {
 	offset        int64
 	nextCmdOffset int64
+	respOffset    int64 // rdb preamble之后resp命令开始的offset
+	preambleDone  bool  // 已经解析或者跳过了rdb preamble
 	file          *os.File
+	fileSize      int64 // 最后一次获取的文件大小
 	reader        *bufio.Reader
 }
 
@@ -0,0 +1,68 @@
+/*
+ *Descript:aof的rdb preamble(aof-use-rdb-preamble yes)
+ */
+package aof
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const ErrAofRDBPreamble = "aof begins with rdb preamble, parse or skip it first"
+
+// 是否以rdb preamble开头:只在还没有读取数据时检测
+func (a *AofParser) HasRDBPreamble() bool {
+	if a.offset != 0 || a.preambleDone {
+		return false
+	}
+	head, _ := a.reader.Peek(len(parser.REDIS))
+	return string(head) == parser.REDIS
+}
+
+// 将rdb preamble交给RDBParser解析,之后从resp命令继续.没有preamble时直接返回
+func (a *AofParser) ParseRDBPreamble(ctx context.Context, handler func(ctx context.Context, object parser.TypeObject) error,
+	arg parser.ParseArg) error {
+	if !a.HasRDBPreamble() {
+		return nil
+	}
+	p, err := parser.NewRDBParse(ctx, a.reader, handler, nil, arg)
+	if err != nil {
+		return errors.Wrap(err, "parse rdb preamble")
+	}
+	if err = p.Parse(); err != nil {
+		return errors.Wrap(err, "parse rdb preamble")
+	}
+	a.ResumeRESP(p.Rest(), p.Offset())
+	return nil
+}
+
+// rdb preamble的输入流:交给RDBParser(或者RedisLoader)解析,解析完成之后调用ResumeRESP
+func (a *AofParser) RDBPreambleReader() io.Reader {
+	return a.reader
+}
+
+// rdb preamble解析完成之后从resp命令继续:rest为RDBParser.Rest(),rdbLen为RDBParser.Offset()
+func (a *AofParser) ResumeRESP(rest io.Reader, rdbLen int64) {
+	a.reader = bufio.NewReader(rest)
+	a.offset = rdbLen
+	a.nextCmdOffset = a.offset
+	a.respOffset = a.offset
+	a.preambleDone = true
+}
+
+// 跳过rdb preamble(需要解析才能知道rdb的结束位置)
+func (a *AofParser) SkipRDBPreamble(ctx context.Context) error {
+	return a.ParseRDBPreamble(ctx, func(ctx context.Context, object parser.TypeObject) error {
+		return nil
+	}, parser.ParseArg{})
+}
+
+// resp命令开始的offset:没有rdb preamble时为0
+func (a *AofParser) RESPOffset() int64 {
+	return a.respOffset
+}
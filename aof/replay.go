@@ -0,0 +1,375 @@
+/*
+ *Descript:将aof命令重放到内存keyspace
+ */
+package aof
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/log_interface"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrReplayUnsupported = "replay unsupported command"
+	ErrReplayArgs        = "wrong number of arguments"
+	ErrReplaySyntax      = "syntax error"
+	ErrReplayMulti       = "MULTI calls can not be nested"
+	ErrReplayExec        = "EXEC without MULTI"
+	ErrReplayDiscard     = "DISCARD without MULTI"
+	ErrNotInteger        = "value is not an integer or out of range"
+	ErrNotFloat          = "value is not a valid float"
+	ErrIncrOverflow      = "increment or decrement would overflow"
+	ErrIndexOutOfRange   = "index out of range"
+)
+
+// 重放参数
+type ReplayArg struct {
+	SkipUnsupported bool                 // 跳过不支持的命令(例如EVAL和module命令),否则返回错误
+	Logger          log_interface.Logger // 打印跳过的命令,为空不打印
+}
+
+// aof重放器:将写命令作用到内存keyspace,之后可以按照rdb的object输出
+type Replayer struct {
+	arg      ReplayArg
+	keyspace *Keyspace
+	db       uint64
+	inMulti  bool
+	multi    [][]string // MULTI之后暂存的命令,EXEC时一起执行
+	commands int64
+	skipped  int64
+	skips    map[string]int64 // 跳过的命令(module类型的key)和次数
+}
+
+// 重放命令:arity为参数数量(包含命令名),负数表示至少-arity个
+type replayCommand struct {
+	arity int
+	f     func(r *Replayer, args []string) error
+}
+
+var replayCommands map[string]replayCommand
+
+func init() {
+	replayCommands = map[string]replayCommand{
+		"ping":     {-1, replayNoop},
+		"select":   {2, replaySelect},
+		"flushdb":  {-1, replayFlushDB},
+		"flushall": {-1, replayFlushAll},
+		"swapdb":   {3, replaySwapDB},
+		// key
+		"del":       {-2, replayDel},
+		"unlink":    {-2, replayDel},
+		"expire":    {-3, replayExpire},
+		"pexpire":   {-3, replayExpire},
+		"expireat":  {-3, replayExpire},
+		"pexpireat": {-3, replayExpire},
+		"persist":   {2, replayPersist},
+		"rename":    {3, replayRename},
+		"renamenx":  {3, replayRename},
+		"move":      {3, replayMove},
+		"copy":      {-3, replayCopy},
+		"restore":   {-4, replayRestore},
+		// MIGRATE的目标实例写入的命令
+		"restore-asking": {-4, replayRestore},
+		// string
+		"set":         {-3, replaySet},
+		"setnx":       {3, replaySetNX},
+		"setex":       {4, replaySetEX},
+		"psetex":      {4, replaySetEX},
+		"getset":      {3, replayGetSet},
+		"getdel":      {2, replayDel},
+		"getex":       {-2, replayGetEX},
+		"mset":        {-3, replayMSet},
+		"msetnx":      {-3, replayMSet},
+		"append":      {3, replayAppend},
+		"incr":        {2, replayIncr},
+		"decr":        {2, replayIncr},
+		"incrby":      {3, replayIncr},
+		"decrby":      {3, replayIncr},
+		"incrbyfloat": {3, replayIncrByFloat},
+		"setrange":    {4, replaySetRange},
+		"setbit":      {4, replaySetBit},
+		"bitop":       {-4, replayBitOp},
+		"bitfield":    {-2, replayBitfield},
+		// hyperloglog
+		"pfadd":   {-2, replayPFAdd},
+		"pfmerge": {-2, replayPFMerge},
+		// 更新缓存的基数或者转换编码,不改变寄存器
+		"pfcount": {-2, replayNoop},
+		"pfdebug": {-3, replayNoop},
+		// hash
+		"hset":         {-4, replayHSet},
+		"hmset":        {-4, replayHSet},
+		"hsetnx":       {4, replayHSetNX},
+		"hdel":         {-3, replayHDel},
+		"hincrby":      {4, replayHIncrBy},
+		"hincrbyfloat": {4, replayHIncrByFloat},
+		// list
+		"lpush":     {-3, replayPush},
+		"rpush":     {-3, replayPush},
+		"lpushx":    {-3, replayPush},
+		"rpushx":    {-3, replayPush},
+		"lpop":      {-2, replayPop},
+		"rpop":      {-2, replayPop},
+		"rpoplpush": {3, replayRPopLPush},
+		"lmove":     {5, replayLMove},
+		"lset":      {4, replayLSet},
+		"linsert":   {5, replayLInsert},
+		"lrem":      {4, replayLRem},
+		"ltrim":     {4, replayLTrim},
+		// set
+		"sadd":        {-3, replaySAdd},
+		"srem":        {-3, replaySRem},
+		"smove":       {4, replaySMove},
+		"sinterstore": {-3, replaySStore},
+		"sunionstore": {-3, replaySStore},
+		"sdiffstore":  {-3, replaySStore},
+		// sorted set
+		"zadd":             {-4, replayZAdd},
+		"zincrby":          {4, replayZIncrBy},
+		"zrem":             {-3, replayZRem},
+		"zremrangebyscore": {4, replayZRemRangeByScore},
+		"zremrangebyrank":  {4, replayZRemRangeByRank},
+		"zremrangebylex":   {4, replayZRemRangeByLex},
+		"zpopmin":          {-2, replayZPop},
+		"zpopmax":          {-2, replayZPop},
+		"zunionstore":      {-4, replayZStore},
+		"zinterstore":      {-4, replayZStore},
+		"zdiffstore":       {-4, replayZStore},
+		"zrangestore":      {-5, replayZRangeStore},
+		// stream
+		"xadd":   {-5, replayXAdd},
+		"xdel":   {-3, replayXDel},
+		"xtrim":  {-4, replayXTrim},
+		"xsetid": {-3, replayXSetId},
+		"xgroup": {-2, replayXGroup},
+		"xack":   {-4, replayXAck},
+		"xclaim": {-6, replayXClaim},
+	}
+}
+
+// 创建一个重放器
+func NewReplayer(arg ReplayArg) *Replayer {
+	return &Replayer{
+		arg:      arg,
+		keyspace: NewKeyspace(),
+	}
+}
+
+// 重放的结果
+func (r *Replayer) Keyspace() *Keyspace {
+	return r.keyspace
+}
+
+// 重放的命令数量和跳过的不支持的命令数量
+func (r *Replayer) Result() (commands, skipped int64) {
+	return r.commands, r.skipped
+}
+
+// 跳过的命令以及次数
+func (r *Replayer) Skipped() map[string]int64 {
+	return r.skips
+}
+
+// 记录跳过的命令,每种命令第一次跳过时打印日志
+func (r *Replayer) skip(name string) {
+	r.skipped++
+	if r.skips == nil {
+		r.skips = make(map[string]int64)
+	}
+	if r.skips[name]++; r.skips[name] == 1 && r.arg.Logger != nil {
+		r.arg.Logger.Warnf("replay skip unsupported command %s", name)
+	}
+}
+
+// 重放aof中的全部命令,rdb preamble中的key也会加载.末尾不完整的命令会忽略,最后没有EXEC的事务会丢弃(和redis加载aof一致)
+func (r *Replayer) Replay(ctx context.Context, p *AofParser) error {
+	if err := p.ParseRDBPreamble(ctx, r.LoadObject, parser.ParseArg{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		offset := p.GetLastCommandOffset()
+		cmd, err := p.GetNextAofCommand()
+		if err == io.EOF || errors.Cause(err) == io.ErrUnexpectedEOF {
+			if err != io.EOF && r.arg.Logger != nil {
+				r.arg.Logger.Warnf("ignore truncated command at offset %d", offset)
+			}
+			r.inMulti = false
+			r.multi = nil
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("read aof command at offset %d", offset))
+		}
+		if err = r.Apply(cmd); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("aof command at offset %d", offset))
+		}
+	}
+}
+
+// 重放一条命令
+func (r *Replayer) Apply(cmd []string) error {
+	if len(cmd) == 0 {
+		return nil
+	}
+	name := strings.ToLower(cmd[0])
+	switch name {
+	case "multi":
+		if r.inMulti {
+			return errors.New(ErrReplayMulti)
+		}
+		r.inMulti = true
+		return nil
+	case "exec":
+		if !r.inMulti {
+			return errors.New(ErrReplayExec)
+		}
+		cmds := r.multi
+		r.inMulti = false
+		r.multi = nil
+		for _, c := range cmds {
+			if err := r.apply(strings.ToLower(c[0]), c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "discard":
+		if !r.inMulti {
+			return errors.New(ErrReplayDiscard)
+		}
+		r.inMulti = false
+		r.multi = nil
+		return nil
+	}
+	if r.inMulti {
+		r.multi = append(r.multi, cmd)
+		return nil
+	}
+	return r.apply(name, cmd)
+}
+
+// 执行命令
+func (r *Replayer) apply(name string, cmd []string) error {
+	r.commands++
+	c, ok := replayCommands[name]
+	if !ok {
+		if r.arg.SkipUnsupported {
+			r.skip(name)
+			return nil
+		}
+		return errors.New(fmt.Sprintf("%s %s", ErrReplayUnsupported, cmd[0]))
+	}
+	if (c.arity > 0 && len(cmd) != c.arity) || (c.arity < 0 && len(cmd) < -c.arity) {
+		return errors.New(fmt.Sprintf("%s for %s", ErrReplayArgs, cmd[0]))
+	}
+	if err := c.f(r, cmd); err != nil {
+		return errors.Wrap(err, "replay "+cmd[0])
+	}
+	return nil
+}
+
+// 当前db
+func (r *Replayer) current() database {
+	return r.keyspace.db(r.db)
+}
+
+// 查找key,不存在返回nil
+func (r *Replayer) lookup(key string) *keyValue {
+	return r.current()[key]
+}
+
+// 查找指定类型的key,不存在返回nil,类型不一致返回错误
+func (r *Replayer) lookupKind(key, kind string) (*keyValue, error) {
+	v := r.lookup(key)
+	if v != nil && v.kind != kind {
+		return nil, errors.New(ErrWrongType)
+	}
+	return v, nil
+}
+
+// 查找指定类型的key,不存在则创建
+func (r *Replayer) lookupOrCreate(key, kind string) (*keyValue, error) {
+	v, err := r.lookupKind(key, kind)
+	if err != nil || v != nil {
+		return v, err
+	}
+	v = newKeyValue(kind)
+	r.current()[key] = v
+	return v, nil
+}
+
+// 集合类型为空时删除key
+func (r *Replayer) deleteIfEmpty(key string, v *keyValue) {
+	if v != nil && v.empty() {
+		delete(r.current(), key)
+	}
+}
+
+func replayNoop(r *Replayer, args []string) error {
+	return nil
+}
+
+func replaySelect(r *Replayer, args []string) error {
+	db, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errors.New(ErrNotInteger)
+	}
+	r.db = db
+	return nil
+}
+
+func replayFlushDB(r *Replayer, args []string) error {
+	delete(r.keyspace.dbs, r.db)
+	return nil
+}
+
+func replayFlushAll(r *Replayer, args []string) error {
+	r.keyspace.dbs = make(map[uint64]database)
+	return nil
+}
+
+func replaySwapDB(r *Replayer, args []string) error {
+	db1, err1 := strconv.ParseUint(args[1], 10, 64)
+	db2, err2 := strconv.ParseUint(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return errors.New(ErrNotInteger)
+	}
+	d1, d2 := r.keyspace.db(db1), r.keyspace.db(db2)
+	r.keyspace.dbs[db1], r.keyspace.dbs[db2] = d2, d1
+	return nil
+}
+
+// 解析整数
+func parseInt(s string) (int64, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New(ErrNotInteger)
+	}
+	return i, nil
+}
+
+// 解析浮点数,不接受nan
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errors.New(ErrNotFloat)
+	}
+	return f, nil
+}
+
+// 格式化浮点数(INCRBYFLOAT的结果)
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
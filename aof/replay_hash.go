@@ -0,0 +1,96 @@
+/*
+ *Descript:重放hash相关的命令
+ */
+package aof
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// HSET/HMSET key field value [field value ...]
+func replayHSet(r *Replayer, args []string) error {
+	if len(args)%2 != 0 {
+		return errors.New(ErrReplayArgs)
+	}
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeHash)
+	if err != nil {
+		return err
+	}
+	for i := 2; i < len(args); i += 2 {
+		v.hash[args[i]] = args[i+1]
+	}
+	return nil
+}
+
+func replayHSetNX(r *Replayer, args []string) error {
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeHash)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.hash[args[2]]; !ok {
+		v.hash[args[2]] = args[3]
+	}
+	return nil
+}
+
+func replayHDel(r *Replayer, args []string) error {
+	v, err := r.lookupKind(args[1], parser.ObjectTypeHash)
+	if err != nil || v == nil {
+		return err
+	}
+	for _, field := range args[2:] {
+		delete(v.hash, field)
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+func replayHIncrBy(r *Replayer, args []string) error {
+	incr, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeHash)
+	if err != nil {
+		return err
+	}
+	var val int64
+	if old, ok := v.hash[args[2]]; ok {
+		if val, err = parseInt(old); err != nil {
+			return errors.New("hash value is not an integer")
+		}
+	}
+	if (incr < 0 && val < 0 && incr < math.MinInt64-val) || (incr > 0 && val > 0 && incr > math.MaxInt64-val) {
+		return errors.New(ErrIncrOverflow)
+	}
+	v.hash[args[2]] = strconv.FormatInt(val+incr, 10)
+	return nil
+}
+
+func replayHIncrByFloat(r *Replayer, args []string) error {
+	incr, err := parseFloat(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeHash)
+	if err != nil {
+		return err
+	}
+	var val float64
+	if old, ok := v.hash[args[2]]; ok {
+		if val, err = parseFloat(old); err != nil {
+			return errors.New("hash value is not a float")
+		}
+	}
+	val += incr
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return errors.New("increment would produce NaN or Infinity")
+	}
+	v.hash[args[2]] = formatFloat(val)
+	return nil
+}
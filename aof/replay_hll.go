@@ -0,0 +1,241 @@
+/*
+ *Descript:重放HyperLogLog相关的命令,HyperLogLog按照redis的编码保存为string
+ */
+package aof
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	hllP             = 14 // 寄存器下标的位数
+	hllQ             = 64 - hllP
+	hllRegisters     = 1 << hllP
+	hllBits          = 6
+	hllHdrSize       = 16 // "HYLL" + 1字节编码 + 3字节保留 + 8字节缓存的基数
+	hllDenseSize     = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllDense         = 0
+	hllSparse        = 1
+	hllSparseValMax  = 32   // sparse编码的VAL最大值,超过则转换为dense
+	hllSparseMaxSize = 3000 // hll-sparse-max-bytes的默认值
+	hllMagic         = "HYLL"
+	hllSeed          = 0xadc83b19
+
+	ErrInvalidHLL = "WRONGTYPE Key is not a valid HyperLogLog string value."
+)
+
+// 解码HyperLogLog的寄存器,返回是否为dense编码
+func hllDecode(s string) ([]uint8, bool, error) {
+	if len(s) < hllHdrSize || s[:4] != hllMagic || s[4] > hllSparse {
+		return nil, false, errors.New(ErrInvalidHLL)
+	}
+	regs := make([]uint8, hllRegisters)
+	if s[4] == hllDense {
+		if len(s) != hllDenseSize {
+			return nil, false, errors.New(ErrInvalidHLL)
+		}
+		for i := range regs {
+			regs[i] = hllDenseGet(s[hllHdrSize:], i)
+		}
+		return regs, true, nil
+	}
+	// sparse: ZERO 00xxxxxx,XZERO 01xxxxxx yyyyyyyy,VAL 1vvvvvxx
+	idx := 0
+	for i := hllHdrSize; i < len(s); i++ {
+		var run, val int
+		switch b := s[i]; {
+		case b&0xc0 == 0:
+			run = int(b&0x3f) + 1
+		case b&0xc0 == 0x40:
+			if i+1 >= len(s) {
+				return nil, false, errors.New(ErrInvalidHLL)
+			}
+			i++
+			run = (int(b&0x3f)<<8 | int(s[i])) + 1
+		default:
+			val, run = int(b>>2&0x1f)+1, int(b&0x3)+1
+		}
+		if idx+run > hllRegisters {
+			return nil, false, errors.New(ErrInvalidHLL)
+		}
+		for ; run > 0; run-- {
+			regs[idx] = uint8(val)
+			idx++
+		}
+	}
+	if idx != hllRegisters {
+		return nil, false, errors.New(ErrInvalidHLL)
+	}
+	return regs, false, nil
+}
+
+// dense编码的寄存器:每个寄存器6位,低位在前
+func hllDenseGet(p string, i int) uint8 {
+	pos := i * hllBits
+	b, fb := pos/8, uint(pos&7)
+	v := uint16(p[b])
+	if b+1 < len(p) {
+		v |= uint16(p[b+1]) << 8
+	}
+	return uint8(v>>fb) & (1<<hllBits - 1)
+}
+
+// 编码HyperLogLog:dense为false时尽量使用sparse编码,缓存的基数标记为无效
+func hllEncode(regs []uint8, dense bool) string {
+	if !dense {
+		if s, ok := hllSparseEncode(regs); ok {
+			return s
+		}
+	}
+	b := hllHeader(hllDense, hllDenseSize)[:hllDenseSize]
+	for i, v := range regs {
+		pos := i * hllBits
+		idx, fb := hllHdrSize+pos/8, uint(pos&7)
+		b[idx] |= v << fb
+		if idx+1 < len(b) {
+			b[idx+1] |= uint8(uint16(v) << fb >> 8)
+		}
+	}
+	return string(b)
+}
+
+// sparse编码,寄存器的值超过32或者长度超过hll-sparse-max-bytes时返回false
+func hllSparseEncode(regs []uint8) (string, bool) {
+	b := hllHeader(hllSparse, hllHdrSize)
+	for i := 0; i < len(regs); {
+		j := i
+		for j < len(regs) && regs[j] == regs[i] {
+			j++
+		}
+		v, run := regs[i], j-i
+		if v > hllSparseValMax {
+			return "", false
+		}
+		for run > 0 {
+			n := run
+			switch {
+			case v != 0:
+				if n > 4 {
+					n = 4
+				}
+				b = append(b, 0x80|(v-1)<<2|uint8(n-1))
+			case n <= 64:
+				b = append(b, uint8(n-1))
+			default:
+				b = append(b, 0x40|uint8((n-1)>>8), uint8(n-1))
+			}
+			run -= n
+		}
+		i = j
+	}
+	if len(b) > hllSparseMaxSize {
+		return "", false
+	}
+	return string(b), true
+}
+
+// HyperLogLog的头部
+func hllHeader(encoding byte, size int) []byte {
+	b := make([]byte, hllHdrSize, size)
+	copy(b, hllMagic)
+	b[4] = encoding
+	b[15] = 1 << 7 // 缓存的基数无效,读取时重新计算
+	return b
+}
+
+// 添加元素,返回寄存器是否改变
+func hllAdd(regs []uint8, element string) bool {
+	hash := murmurHash64A([]byte(element), hllSeed)
+	index := hash & (hllRegisters - 1)
+	hash = hash>>hllP | 1<<hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	if regs[index] >= count {
+		return false
+	}
+	regs[index] = count
+	return true
+}
+
+// redis使用的MurmurHash64A(小端)
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m, r = 0xc6a4a7935bd1e995, 47
+	h := seed ^ uint64(len(key))*m
+	n := len(key) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	if tail := key[n:]; len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// 获取HyperLogLog的寄存器,key不存在时返回空的寄存器
+func (r *Replayer) lookupHLL(key string) (*keyValue, []uint8, bool, error) {
+	v, err := r.lookupString(key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if v == nil {
+		return nil, make([]uint8, hllRegisters), false, nil
+	}
+	regs, dense, err := hllDecode(v.str)
+	return v, regs, dense, err
+}
+
+// PFADD key [element ...]
+func replayPFAdd(r *Replayer, args []string) error {
+	v, regs, dense, err := r.lookupHLL(args[1])
+	if err != nil {
+		return err
+	}
+	updated := v == nil
+	for _, element := range args[2:] {
+		if hllAdd(regs, element) {
+			updated = true
+		}
+	}
+	if updated {
+		r.setString(args[1], hllEncode(regs, dense), 0, true)
+	}
+	return nil
+}
+
+// PFMERGE destkey [sourcekey ...]:取每个寄存器的最大值,destkey存在时也参与合并
+func replayPFMerge(r *Replayer, args []string) error {
+	max := make([]uint8, hllRegisters)
+	dense := false
+	for _, key := range args[1:] {
+		v, regs, d, err := r.lookupHLL(key)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			continue
+		}
+		dense = dense || d
+		for i, reg := range regs {
+			if reg > max[i] {
+				max[i] = reg
+			}
+		}
+	}
+	r.setString(args[1], hllEncode(max, dense), 0, true)
+	return nil
+}
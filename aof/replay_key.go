@@ -0,0 +1,190 @@
+/*
+ *Descript:重放key相关的命令
+ */
+package aof
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+func replayDel(r *Replayer, args []string) error {
+	db := r.current()
+	for _, key := range args[1:] {
+		delete(db, key)
+	}
+	return nil
+}
+
+// EXPIRE/PEXPIRE/EXPIREAT/PEXPIREAT key time [NX|XX|GT|LT]
+func replayExpire(r *Replayer, args []string) error {
+	t, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	var when int64
+	switch strings.ToLower(args[0]) {
+	case "expire":
+		when = nowMS() + t*1000
+	case "pexpire":
+		when = nowMS() + t
+	case "expireat":
+		when = t * 1000
+	default:
+		when = t
+	}
+	v := r.lookup(args[1])
+	if v == nil {
+		return nil
+	}
+	for _, opt := range args[3:] {
+		switch strings.ToLower(opt) {
+		case "nx":
+			if v.expire > 0 {
+				return nil
+			}
+		case "xx":
+			if v.expire == 0 {
+				return nil
+			}
+		case "gt":
+			if v.expire == 0 || when <= v.expire {
+				return nil
+			}
+		case "lt":
+			if v.expire > 0 && when >= v.expire {
+				return nil
+			}
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	// 加载aof时不会删除已经过期的key,由解析的expired policy处理
+	v.expire = when
+	return nil
+}
+
+func replayPersist(r *Replayer, args []string) error {
+	if v := r.lookup(args[1]); v != nil {
+		v.expire = 0
+	}
+	return nil
+}
+
+// RENAME/RENAMENX key newkey
+func replayRename(r *Replayer, args []string) error {
+	db := r.current()
+	v, ok := db[args[1]]
+	if !ok {
+		return errors.New(ErrNoSuchKey)
+	}
+	if args[1] == args[2] {
+		return nil
+	}
+	if _, exist := db[args[2]]; exist && strings.ToLower(args[0]) == "renamenx" {
+		return nil
+	}
+	delete(db, args[1])
+	db[args[2]] = v
+	return nil
+}
+
+// MOVE key db
+func replayMove(r *Replayer, args []string) error {
+	dst, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return errors.New(ErrNotInteger)
+	}
+	v := r.lookup(args[1])
+	if v == nil || dst == r.db {
+		return nil
+	}
+	dstDB := r.keyspace.db(dst)
+	if _, exist := dstDB[args[1]]; exist {
+		return nil
+	}
+	delete(r.current(), args[1])
+	dstDB[args[1]] = v
+	return nil
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func replayCopy(r *Replayer, args []string) error {
+	dst, replace := r.db, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "replace":
+			replace = true
+		case "db":
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			db, err := strconv.ParseUint(args[i+1], 10, 64)
+			if err != nil {
+				return errors.New(ErrNotInteger)
+			}
+			dst = db
+			i++
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	v := r.lookup(args[1])
+	if v == nil || (dst == r.db && args[1] == args[2]) {
+		return nil
+	}
+	dstDB := r.keyspace.db(dst)
+	if _, exist := dstDB[args[2]]; exist && !replace {
+		return nil
+	}
+	dstDB[args[2]] = v.clone()
+	return nil
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func replayRestore(r *Replayer, args []string) error {
+	ttl, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return errors.New("Invalid TTL value, must be >= 0")
+	}
+	replace, absTTL := false, false
+	for i := 4; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "replace":
+			replace = true
+		case "absttl":
+			absTTL = true
+		case "idletime", "freq": // keyspace不保存lru/lfu
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			if _, err = parseInt(args[i+1]); err != nil {
+				return err
+			}
+			i++
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	if r.lookup(args[1]) != nil && !replace {
+		return nil
+	}
+	expire := int64(parser.NotExpired)
+	if ttl > 0 {
+		expire = ttl
+		if !absTTL {
+			expire += nowMS()
+		}
+	}
+	delete(r.current(), args[1])
+	return parser.ParsePayload(context.TODO(), []byte(args[1]), []byte(args[3]), expire, r.LoadObject,
+		parser.ParseArg{MergeQuickList: true})
+}
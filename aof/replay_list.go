@@ -0,0 +1,295 @@
+/*
+ *Descript:重放list相关的命令
+ */
+package aof
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// list:头部元素逆序保存在head中,LPUSH和RPUSH都只需要append
+type listValue struct {
+	head []string
+	tail []string
+}
+
+func (l *listValue) len() int {
+	return len(l.head) + len(l.tail)
+}
+
+func (l *listValue) pushLeft(v string) {
+	l.head = append(l.head, v)
+}
+
+func (l *listValue) pushRight(v string) {
+	l.tail = append(l.tail, v)
+}
+
+func (l *listValue) popLeft() string {
+	if n := len(l.head); n > 0 {
+		v := l.head[n-1]
+		l.head = l.head[:n-1]
+		return v
+	}
+	v := l.tail[0]
+	l.tail = l.tail[1:]
+	return v
+}
+
+func (l *listValue) popRight() string {
+	if n := len(l.tail); n > 0 {
+		v := l.tail[n-1]
+		l.tail = l.tail[:n-1]
+		return v
+	}
+	v := l.head[0]
+	l.head = l.head[1:]
+	return v
+}
+
+// 按照顺序返回全部元素
+func (l *listValue) all() []string {
+	items := make([]string, 0, l.len())
+	for i := len(l.head) - 1; i >= 0; i-- {
+		items = append(items, l.head[i])
+	}
+	return append(items, l.tail...)
+}
+
+// 按照下标修改之前整理为一个slice
+func (l *listValue) items() []string {
+	if len(l.head) > 0 {
+		l.tail = l.all()
+		l.head = nil
+	}
+	return l.tail
+}
+
+// 下标转换,负数从尾部开始
+func listIndex(index int64, length int) int64 {
+	if index < 0 {
+		index += int64(length)
+	}
+	return index
+}
+
+// LPUSH/RPUSH/LPUSHX/RPUSHX key element [element ...]
+func replayPush(r *Replayer, args []string) error {
+	name := strings.ToLower(args[0])
+	var (
+		v   *keyValue
+		err error
+	)
+	if strings.HasSuffix(name, "x") {
+		v, err = r.lookupKind(args[1], parser.ObjectTypeList)
+	} else {
+		v, err = r.lookupOrCreate(args[1], parser.ObjectTypeList)
+	}
+	if err != nil || v == nil {
+		return err
+	}
+	for _, item := range args[2:] {
+		if name[0] == 'l' {
+			v.list.pushLeft(item)
+		} else {
+			v.list.pushRight(item)
+		}
+	}
+	return nil
+}
+
+// LPOP/RPOP key [count]
+func replayPop(r *Replayer, args []string) error {
+	count := int64(1)
+	if len(args) > 2 {
+		c, err := parseInt(args[2])
+		if err != nil || c < 0 {
+			return errors.New(ErrNotInteger)
+		}
+		count = c
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeList)
+	if err != nil || v == nil {
+		return err
+	}
+	for i := int64(0); i < count && v.list.len() > 0; i++ {
+		if args[0][0] == 'l' || args[0][0] == 'L' {
+			v.list.popLeft()
+		} else {
+			v.list.popRight()
+		}
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// 从source弹出一个元素放入destination
+func (r *Replayer) listMove(src, dst string, srcLeft, dstLeft bool) error {
+	v, err := r.lookupKind(src, parser.ObjectTypeList)
+	if err != nil || v == nil {
+		return err
+	}
+	if _, err = r.lookupKind(dst, parser.ObjectTypeList); err != nil {
+		return err
+	}
+	var item string
+	if srcLeft {
+		item = v.list.popLeft()
+	} else {
+		item = v.list.popRight()
+	}
+	r.deleteIfEmpty(src, v)
+	d, _ := r.lookupOrCreate(dst, parser.ObjectTypeList)
+	if dstLeft {
+		d.list.pushLeft(item)
+	} else {
+		d.list.pushRight(item)
+	}
+	return nil
+}
+
+func replayRPopLPush(r *Replayer, args []string) error {
+	return r.listMove(args[1], args[2], false, true)
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func replayLMove(r *Replayer, args []string) error {
+	var where [2]bool
+	for i, arg := range args[3:5] {
+		switch strings.ToLower(arg) {
+		case "left":
+			where[i] = true
+		case "right":
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	return r.listMove(args[1], args[2], where[0], where[1])
+}
+
+// LSET key index element
+func replayLSet(r *Replayer, args []string) error {
+	index, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeList)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return errors.New(ErrNoSuchKey)
+	}
+	items := v.list.items()
+	index = listIndex(index, len(items))
+	if index < 0 || index >= int64(len(items)) {
+		return errors.New(ErrIndexOutOfRange)
+	}
+	items[index] = args[3]
+	return nil
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func replayLInsert(r *Replayer, args []string) error {
+	var after bool
+	switch strings.ToLower(args[2]) {
+	case "before":
+	case "after":
+		after = true
+	default:
+		return errors.New(ErrReplaySyntax)
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeList)
+	if err != nil || v == nil {
+		return err
+	}
+	items := v.list.items()
+	for i, item := range items {
+		if item != args[3] {
+			continue
+		}
+		if after {
+			i++
+		}
+		items = append(items, "")
+		copy(items[i+1:], items[i:])
+		items[i] = args[4]
+		v.list.tail = items
+		break
+	}
+	return nil
+}
+
+// LREM key count element
+func replayLRem(r *Replayer, args []string) error {
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeList)
+	if err != nil || v == nil {
+		return err
+	}
+	items := v.list.items()
+	remove := make([]bool, len(items))
+	removed := int64(0)
+	if count < 0 {
+		for i := len(items) - 1; i >= 0 && removed < -count; i-- {
+			if items[i] == args[3] {
+				remove[i] = true
+				removed++
+			}
+		}
+	} else {
+		for i := 0; i < len(items) && (count == 0 || removed < count); i++ {
+			if items[i] == args[3] {
+				remove[i] = true
+				removed++
+			}
+		}
+	}
+	kept := items[:0]
+	for i, item := range items {
+		if !remove[i] {
+			kept = append(kept, item)
+		}
+	}
+	v.list.tail = kept
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// LTRIM key start stop
+func replayLTrim(r *Replayer, args []string) error {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeList)
+	if err != nil || v == nil {
+		return err
+	}
+	items := v.list.items()
+	start, stop = listIndex(start, len(items)), listIndex(stop, len(items))
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(len(items)) {
+		stop = int64(len(items)) - 1
+	}
+	if start > stop {
+		v.list.tail = nil
+	} else {
+		v.list.tail = items[start : stop+1]
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+ *Descript:将rdb解析的object加载到内存keyspace(rdb格式的base文件或者rdb preamble)
+ */
+package aof
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const ErrStreamObject = "stream object data"
+
+// 重放多文件aof:base文件和incr文件
+func (r *Replayer) ReplayMultiPart(ctx context.Context, m *MultiPartAof, arg parser.ParseArg) error {
+	err := m.Read(ctx, r.LoadObject, r.Apply, arg)
+	r.inMulti = false
+	r.multi = nil
+	return err
+}
+
+// 作为RDBParser的handler,将rdb中的key加载到keyspace
+func (r *Replayer) LoadObject(ctx context.Context, object parser.TypeObject) error {
+	key := object.Key()
+	db := r.current()
+	switch o := object.(type) {
+	case parser.SelectionDB:
+		r.db = o.Index
+		return nil
+	case parser.StringObject:
+		db[key] = &keyValue{kind: parser.ObjectTypeString, str: string(o.Val)}
+	case parser.ListObject:
+		// quicklist的每个节点都会解析成一个ListObject
+		v, ok := db[key]
+		if !ok || v.kind != parser.ObjectTypeList {
+			v = newKeyValue(parser.ObjectTypeList)
+			db[key] = v
+		}
+		v.list.tail = append(v.list.items(), o.Entries...)
+	case parser.HashMap:
+		v := newKeyValue(parser.ObjectTypeHash)
+		for _, entry := range o.Entry {
+			v.hash[entry.Field] = entry.Value
+		}
+		db[key] = v
+	case parser.Set:
+		v := newKeyValue(parser.ObjectTypeSet)
+		for _, member := range o.Entries {
+			v.set[member] = struct{}{}
+		}
+		db[key] = v
+	case parser.SortedSet:
+		v := newKeyValue(parser.ObjectTypeSortedSet)
+		for _, entry := range o.Entries {
+			v.zset[parser.ToString(entry.Field)] = entry.Score
+		}
+		db[key] = v
+	case parser.RedisStream:
+		s, err := loadStream(o)
+		if err != nil {
+			return errors.Wrap(err, "load stream "+key)
+		}
+		db[key] = &keyValue{kind: parser.ObjectTypeStream, stream: s}
+	case parser.ModuleObject:
+		if r.arg.SkipUnsupported {
+			r.skip(o.Type())
+			return nil
+		}
+		return errors.New(fmt.Sprintf("%s %s %s", ErrReplayUnsupported, o.Type(), key))
+	default:
+		// aux,resize db,module aux
+		return nil
+	}
+	if expire := parser.ExpireOf(object); expire > 0 {
+		db[key].expire = expire
+	}
+	return nil
+}
+
+// 将解析的RedisStream转换为内存中的stream
+func loadStream(o parser.RedisStream) (*streamValue, error) {
+	s := newStreamValue()
+	s.lastId, s.maxDeletedId, s.entriesAdded = o.LastId, o.MaxDeletedId, o.EntriesAdded
+	for _, node := range o.Entries {
+		items, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(ErrStreamObject)
+		}
+		for messageId, item := range items {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(ErrStreamObject)
+			}
+			if entry["hasDeleted"] == "true" {
+				continue
+			}
+			id, err := parser.ParseStreamId(messageId)
+			if err != nil {
+				return nil, err
+			}
+			fields, ok := entry["fields"].(parser.StreamFields)
+			if !ok {
+				return nil, errors.New(ErrStreamObject)
+			}
+			si := streamItem{id: id, fields: append([]string{}, fields...)}
+			s.items = append(s.items, si)
+		}
+	}
+	sort.Slice(s.items, func(i, j int) bool { return s.items[i].id.Less(s.items[j].id) })
+	for _, group := range o.Groups {
+		lastId, err := parser.ParseStreamId(group.LastId)
+		if err != nil {
+			return nil, err
+		}
+		g := &streamGroup{lastId: lastId, entriesRead: group.EntriesRead,
+			pel: make(map[parser.StreamId]*streamNACK), consumers: make(map[string]*streamConsumer)}
+		for rawId, item := range group.PendingEntryList {
+			nack, ok := item.(parser.StreamNACK)
+			if !ok {
+				return nil, errors.New(ErrStreamObject)
+			}
+			id, err := parser.ParseStreamId(rawId)
+			if err != nil {
+				return nil, err
+			}
+			g.pel[id] = &streamNACK{deliveryTime: nack.DeliveryTime, deliveryCount: nack.DeliveryCount}
+		}
+		for _, c := range group.Consumers {
+			g.consumers[c.Name] = &streamConsumer{seenTime: c.SeenTime, activeTime: c.ActiveTime}
+			for rawId := range c.PendingEntryList {
+				id, err := parser.ParseStreamId(rawId)
+				if err != nil {
+					return nil, err
+				}
+				if nack, ok := g.pel[id]; ok {
+					nack.consumer = c.Name
+				}
+			}
+		}
+		s.groups[group.Name] = g
+	}
+	return s, nil
+}
@@ -0,0 +1,107 @@
+/*
+ *Descript:重放set相关的命令
+ */
+package aof
+
+import (
+	"strings"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+func replaySAdd(r *Replayer, args []string) error {
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeSet)
+	if err != nil {
+		return err
+	}
+	for _, member := range args[2:] {
+		v.set[member] = struct{}{}
+	}
+	return nil
+}
+
+func replaySRem(r *Replayer, args []string) error {
+	v, err := r.lookupKind(args[1], parser.ObjectTypeSet)
+	if err != nil || v == nil {
+		return err
+	}
+	for _, member := range args[2:] {
+		delete(v.set, member)
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// SMOVE source destination member
+func replaySMove(r *Replayer, args []string) error {
+	src, err := r.lookupKind(args[1], parser.ObjectTypeSet)
+	if err != nil {
+		return err
+	}
+	if _, err = r.lookupKind(args[2], parser.ObjectTypeSet); err != nil {
+		return err
+	}
+	if src == nil {
+		return nil
+	}
+	if _, ok := src.set[args[3]]; !ok {
+		return nil
+	}
+	delete(src.set, args[3])
+	r.deleteIfEmpty(args[1], src)
+	dst, _ := r.lookupOrCreate(args[2], parser.ObjectTypeSet)
+	dst.set[args[3]] = struct{}{}
+	return nil
+}
+
+// SINTERSTORE/SUNIONSTORE/SDIFFSTORE destination key [key ...]
+func replaySStore(r *Replayer, args []string) error {
+	sets := make([]map[string]struct{}, 0, len(args)-2)
+	for _, key := range args[2:] {
+		v, err := r.lookupKind(key, parser.ObjectTypeSet)
+		if err != nil {
+			return err
+		}
+		var set map[string]struct{}
+		if v != nil {
+			set = v.set
+		}
+		sets = append(sets, set)
+	}
+	res := make(map[string]struct{})
+	switch strings.ToLower(args[0]) {
+	case "sinterstore":
+		for member := range sets[0] {
+			in := true
+			for _, set := range sets[1:] {
+				if _, ok := set[member]; !ok {
+					in = false
+					break
+				}
+			}
+			if in {
+				res[member] = struct{}{}
+			}
+		}
+	case "sunionstore":
+		for _, set := range sets {
+			for member := range set {
+				res[member] = struct{}{}
+			}
+		}
+	default:
+		for member := range sets[0] {
+			res[member] = struct{}{}
+		}
+		for _, set := range sets[1:] {
+			for member := range set {
+				delete(res, member)
+			}
+		}
+	}
+	delete(r.current(), args[1])
+	if len(res) > 0 {
+		r.current()[args[1]] = &keyValue{kind: parser.ObjectTypeSet, set: res}
+	}
+	return nil
+}
@@ -0,0 +1,664 @@
+/*
+ *Descript:重放stream相关的命令
+ */
+package aof
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrStreamId        = "Invalid stream ID specified as stream command argument"
+	ErrStreamIdSmaller = "The ID specified in XADD is equal or smaller than the target stream top item"
+	ErrNoGroup         = "NOGROUP No such consumer group"
+	ErrGroupExist      = "BUSYGROUP Consumer Group name already exists"
+)
+
+// stream的一个entry
+type streamItem struct {
+	id     parser.StreamId
+	fields []string // field value field value ...
+}
+
+// 没有ack的消息
+type streamNACK struct {
+	consumer      string
+	deliveryTime  uint64
+	deliveryCount uint64
+}
+
+type streamConsumer struct {
+	seenTime   uint64
+	activeTime uint64
+}
+
+type streamGroup struct {
+	lastId      parser.StreamId
+	entriesRead uint64
+	pel         map[parser.StreamId]*streamNACK
+	consumers   map[string]*streamConsumer
+}
+
+type streamValue struct {
+	items        []streamItem // 按照id排序
+	lastId       parser.StreamId
+	maxDeletedId parser.StreamId
+	entriesAdded uint64
+	groups       map[string]*streamGroup
+}
+
+func newStreamValue() *streamValue {
+	return &streamValue{groups: make(map[string]*streamGroup)}
+}
+
+// 查找id的位置,不存在时返回应该插入的位置
+func (s *streamValue) search(id parser.StreamId) (int, bool) {
+	i := sort.Search(len(s.items), func(i int) bool { return !s.items[i].id.Less(id) })
+	return i, i < len(s.items) && s.items[i].id == id
+}
+
+// 删除[0,n)的entry
+func (s *streamValue) trimHead(n int) {
+	if n > 0 {
+		s.items = append([]streamItem{}, s.items[n:]...)
+	}
+}
+
+// 排序的消费组名称
+func (s *streamValue) groupNames() []string {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 排序的消费者名称
+func (g *streamGroup) consumerNames() []string {
+	names := make([]string, 0, len(g.consumers))
+	for name := range g.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *streamValue) clone() *streamValue {
+	c := &streamValue{
+		items:        append([]streamItem{}, s.items...),
+		lastId:       s.lastId,
+		maxDeletedId: s.maxDeletedId,
+		entriesAdded: s.entriesAdded,
+		groups:       make(map[string]*streamGroup, len(s.groups)),
+	}
+	for name, g := range s.groups {
+		cg := &streamGroup{lastId: g.lastId, entriesRead: g.entriesRead,
+			pel:       make(map[parser.StreamId]*streamNACK, len(g.pel)),
+			consumers: make(map[string]*streamConsumer, len(g.consumers))}
+		for id, nack := range g.pel {
+			n := *nack
+			cg.pel[id] = &n
+		}
+		for cName, consumer := range g.consumers {
+			cc := *consumer
+			cg.consumers[cName] = &cc
+		}
+		c.groups[name] = cg
+	}
+	return c
+}
+
+// 转换为rdb解析器输出的RedisStream
+func (s *streamValue) object(k parser.KeyObject) parser.RedisStream {
+	stream := parser.RedisStream{
+		Field:        k.Field,
+		Length:       uint64(len(s.items)),
+		LastId:       s.lastId,
+		MaxDeletedId: s.maxDeletedId,
+		EntriesAdded: s.entriesAdded,
+		Expire:       k.Expire,
+		LruIdle:      k.LruIdle,
+		LfuFreq:      k.LfuFreq,
+	}
+	if len(s.items) > 0 {
+		stream.FirstId = s.items[0].id
+		entries := make(map[string]interface{}, len(s.items))
+		for _, item := range s.items {
+			fields := append(parser.StreamFields{}, item.fields...)
+			entries[item.id.String()] = map[string]interface{}{"hasDeleted": "false", "fields": fields}
+		}
+		stream.Entries = map[string]interface{}{s.items[0].id.String(): entries}
+	}
+	for _, name := range s.groupNames() {
+		g := s.groups[name]
+		group := parser.StreamGroup{Name: name, LastId: g.lastId.String(), EntriesRead: g.entriesRead}
+		consumerPEL := make(map[string]map[parser.StreamId]*streamNACK)
+		for id, nack := range g.pel {
+			if group.PendingEntryList == nil {
+				group.PendingEntryList = make(map[string]interface{}, len(g.pel))
+			}
+			group.PendingEntryList[id.String()] = parser.StreamNACK{DeliveryTime: nack.deliveryTime, DeliveryCount: nack.deliveryCount}
+			if consumerPEL[nack.consumer] == nil {
+				consumerPEL[nack.consumer] = make(map[parser.StreamId]*streamNACK)
+			}
+			consumerPEL[nack.consumer][id] = nack
+		}
+		cNames := make([]string, 0, len(g.consumers))
+		for cName := range g.consumers {
+			cNames = append(cNames, cName)
+		}
+		sort.Strings(cNames)
+		for _, cName := range cNames {
+			c := g.consumers[cName]
+			consumer := parser.StreamConsumer{Name: cName, SeenTime: c.seenTime, ActiveTime: c.activeTime}
+			for id, nack := range consumerPEL[cName] {
+				if consumer.PendingEntryList == nil {
+					consumer.PendingEntryList = make(map[string]interface{})
+				}
+				consumer.PendingEntryList[id.String()] = parser.StreamNACK{Consumer: parser.StreamConsumer{Name: cName, SeenTime: c.seenTime},
+					DeliveryTime: nack.deliveryTime, DeliveryCount: nack.deliveryCount}
+			}
+			group.Consumers = append(group.Consumers, consumer)
+		}
+		stream.Groups = append(stream.Groups, group)
+	}
+	return stream
+}
+
+// 获取stream类型的key
+func (r *Replayer) lookupStream(key string) (*streamValue, error) {
+	v, err := r.lookupKind(key, parser.ObjectTypeStream)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.stream, nil
+}
+
+// 获取consumer group
+func (r *Replayer) lookupGroup(key, group string) (*streamValue, *streamGroup, error) {
+	s, err := r.lookupStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil {
+		return nil, nil, errors.New(ErrNoSuchKey)
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return nil, nil, errors.New(ErrNoGroup + " " + group)
+	}
+	return s, g, nil
+}
+
+// 解析完整的stream id,缺少seq时使用defaultSeq
+func parseStreamId(s string, defaultSeq uint64) (parser.StreamId, error) {
+	if i := strings.IndexByte(s, '-'); i < 0 {
+		ms, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return parser.StreamId{}, errors.New(ErrStreamId)
+		}
+		return parser.StreamId{Ms: ms, Sequence: defaultSeq}, nil
+	}
+	id, err := parser.ParseStreamId(s)
+	if err != nil {
+		return id, errors.New(ErrStreamId)
+	}
+	return id, nil
+}
+
+// XADD的id:*,ms-*或者完整的id
+func (s *streamValue) nextId(arg string) (parser.StreamId, error) {
+	last := s.lastId
+	var id parser.StreamId
+	switch {
+	case arg == "*":
+		ms := uint64(nowMS())
+		if ms <= last.Ms {
+			if last.Sequence == math.MaxUint64 {
+				return id, errors.New(ErrStreamIdSmaller)
+			}
+			return parser.StreamId{Ms: last.Ms, Sequence: last.Sequence + 1}, nil
+		}
+		return parser.StreamId{Ms: ms}, nil
+	case strings.HasSuffix(arg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(arg, "-*"), 10, 64)
+		if err != nil {
+			return id, errors.New(ErrStreamId)
+		}
+		id = parser.StreamId{Ms: ms}
+		if ms == last.Ms {
+			if last.Sequence == math.MaxUint64 {
+				return id, errors.New(ErrStreamIdSmaller)
+			}
+			id.Sequence = last.Sequence + 1
+		}
+	default:
+		var err error
+		if id, err = parseStreamId(arg, 0); err != nil {
+			return id, err
+		}
+	}
+	if id == (parser.StreamId{}) || !last.Less(id) {
+		return id, errors.New(ErrStreamIdSmaller)
+	}
+	return id, nil
+}
+
+// 解析MAXLEN|MINID [=|~] threshold [LIMIT count],返回下一个参数的位置
+func (s *streamValue) parseTrim(args []string, i int) (func(), int, error) {
+	strategy := strings.ToLower(args[i])
+	i++
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		i++
+	}
+	if i >= len(args) {
+		return nil, i, errors.New(ErrReplaySyntax)
+	}
+	threshold := args[i]
+	i++
+	if i+1 < len(args) && strings.ToLower(args[i]) == "limit" {
+		if _, err := parseInt(args[i+1]); err != nil {
+			return nil, i, err
+		}
+		i += 2
+	}
+	if strategy == "maxlen" {
+		maxLen, err := parseInt(threshold)
+		if err != nil || maxLen < 0 {
+			return nil, i, errors.New(ErrNotInteger)
+		}
+		return func() {
+			if n := int64(len(s.items)) - maxLen; n > 0 {
+				s.trimHead(int(n))
+			}
+		}, i, nil
+	}
+	minId, err := parseStreamId(threshold, 0)
+	if err != nil {
+		return nil, i, err
+	}
+	return func() {
+		n, _ := s.search(minId)
+		s.trimHead(n)
+	}, i, nil
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func replayXAdd(r *Replayer, args []string) error {
+	s, err := r.lookupStream(args[1])
+	if err != nil {
+		return err
+	}
+	noMkStream := false
+	var trim func()
+	i := 2
+	if strings.ToLower(args[i]) == "nomkstream" {
+		noMkStream = true
+		i++
+	}
+	if i < len(args) {
+		if opt := strings.ToLower(args[i]); opt == "maxlen" || opt == "minid" {
+			if s == nil {
+				s = newStreamValue()
+			}
+			if trim, i, err = s.parseTrim(args, i); err != nil {
+				return err
+			}
+		}
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return errors.New(ErrReplayArgs)
+	}
+	if r.lookup(args[1]) == nil {
+		if noMkStream {
+			return nil
+		}
+		if s == nil {
+			s = newStreamValue()
+		}
+		r.current()[args[1]] = &keyValue{kind: parser.ObjectTypeStream, stream: s}
+	}
+	id, err := s.nextId(args[i])
+	if err != nil {
+		return err
+	}
+	s.items = append(s.items, streamItem{id: id, fields: append([]string{}, args[i+1:]...)})
+	s.lastId = id
+	s.entriesAdded++
+	if trim != nil {
+		trim()
+	}
+	return nil
+}
+
+// XDEL key id [id ...]
+func replayXDel(r *Replayer, args []string) error {
+	s, err := r.lookupStream(args[1])
+	if err != nil || s == nil {
+		return err
+	}
+	for _, arg := range args[2:] {
+		id, err := parseStreamId(arg, 0)
+		if err != nil {
+			return err
+		}
+		i, ok := s.search(id)
+		if !ok {
+			continue
+		}
+		s.items = append(s.items[:i], s.items[i+1:]...)
+		if s.maxDeletedId.Less(id) {
+			s.maxDeletedId = id
+		}
+	}
+	return nil
+}
+
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func replayXTrim(r *Replayer, args []string) error {
+	s, err := r.lookupStream(args[1])
+	if err != nil || s == nil {
+		return err
+	}
+	trim, i, err := s.parseTrim(args, 2)
+	if err != nil {
+		return err
+	}
+	if i != len(args) {
+		return errors.New(ErrReplaySyntax)
+	}
+	trim()
+	return nil
+}
+
+// XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+func replayXSetId(r *Replayer, args []string) error {
+	s, err := r.lookupStream(args[1])
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errors.New(ErrNoSuchKey)
+	}
+	lastId, err := parseStreamId(args[2], 0)
+	if err != nil {
+		return err
+	}
+	for i := 3; i+1 < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "entriesadded":
+			added, err := parseInt(args[i+1])
+			if err != nil || added < 0 {
+				return errors.New(ErrNotInteger)
+			}
+			s.entriesAdded = uint64(added)
+		case "maxdeletedid":
+			if s.maxDeletedId, err = parseStreamId(args[i+1], 0); err != nil {
+				return err
+			}
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	s.lastId = lastId
+	return nil
+}
+
+// 解析group的id:$表示stream的last id
+func (s *streamValue) groupId(arg string) (parser.StreamId, error) {
+	if arg == "$" {
+		return s.lastId, nil
+	}
+	return parseStreamId(arg, 0)
+}
+
+// 解析[ENTRIESREAD entries-read]
+func parseEntriesRead(args []string, defaultRead uint64) (uint64, error) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "entriesread":
+			if i+1 >= len(args) {
+				return 0, errors.New(ErrReplaySyntax)
+			}
+			read, err := parseInt(args[i+1])
+			if err != nil {
+				return 0, err
+			}
+			if read < 0 {
+				read = 0
+			}
+			defaultRead = uint64(read)
+			i++
+		case "mkstream":
+		default:
+			return 0, errors.New(ErrReplaySyntax)
+		}
+	}
+	return defaultRead, nil
+}
+
+// XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func replayXGroup(r *Replayer, args []string) error {
+	sub := strings.ToLower(args[1])
+	if len(args) < 4 {
+		return errors.New(ErrReplayArgs)
+	}
+	key, name := args[2], args[3]
+	if sub == "create" {
+		if len(args) < 5 {
+			return errors.New(ErrReplayArgs)
+		}
+		s, err := r.lookupStream(key)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			mkStream := false
+			for _, arg := range args[5:] {
+				if strings.ToLower(arg) == "mkstream" {
+					mkStream = true
+				}
+			}
+			if !mkStream {
+				return errors.New(ErrNoSuchKey)
+			}
+			s = newStreamValue()
+			r.current()[key] = &keyValue{kind: parser.ObjectTypeStream, stream: s}
+		}
+		if _, ok := s.groups[name]; ok {
+			return errors.New(ErrGroupExist)
+		}
+		id, err := s.groupId(args[4])
+		if err != nil {
+			return err
+		}
+		var defaultRead uint64
+		if args[4] == "$" {
+			defaultRead = s.entriesAdded
+		}
+		read, err := parseEntriesRead(args[5:], defaultRead)
+		if err != nil {
+			return err
+		}
+		s.groups[name] = &streamGroup{lastId: id, entriesRead: read,
+			pel: make(map[parser.StreamId]*streamNACK), consumers: make(map[string]*streamConsumer)}
+		return nil
+	}
+	s, err := r.lookupStream(key)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errors.New(ErrNoSuchKey)
+	}
+	g, ok := s.groups[name]
+	switch sub {
+	case "destroy":
+		delete(s.groups, name)
+		return nil
+	case "setid", "createconsumer", "delconsumer":
+		if !ok {
+			return errors.New(ErrNoGroup + " " + name)
+		}
+		if len(args) < 5 {
+			return errors.New(ErrReplayArgs)
+		}
+	default:
+		return errors.New(ErrReplaySyntax)
+	}
+	switch sub {
+	case "setid":
+		id, err := s.groupId(args[4])
+		if err != nil {
+			return err
+		}
+		var defaultRead uint64
+		if args[4] == "$" {
+			defaultRead = s.entriesAdded
+		}
+		if g.entriesRead, err = parseEntriesRead(args[5:], defaultRead); err != nil {
+			return err
+		}
+		g.lastId = id
+	case "createconsumer":
+		g.consumer(args[4], uint64(nowMS()))
+	case "delconsumer":
+		for id, nack := range g.pel {
+			if nack.consumer == args[4] {
+				delete(g.pel, id)
+			}
+		}
+		delete(g.consumers, args[4])
+	}
+	return nil
+}
+
+// 获取consumer,不存在则创建
+func (g *streamGroup) consumer(name string, now uint64) *streamConsumer {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &streamConsumer{seenTime: now, activeTime: now}
+		g.consumers[name] = c
+	}
+	return c
+}
+
+// XACK key group id [id ...]
+func replayXAck(r *Replayer, args []string) error {
+	_, g, err := r.lookupGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	for _, arg := range args[3:] {
+		id, err := parseStreamId(arg, 0)
+		if err != nil {
+			return err
+		}
+		delete(g.pel, id)
+	}
+	return nil
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+// XREADGROUP和XAUTOCLAIM在aof中都会转换为XCLAIM
+func replayXClaim(r *Replayer, args []string) error {
+	s, g, err := r.lookupGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	minIdle, err := parseInt(args[4])
+	if err != nil {
+		return err
+	}
+	now := uint64(nowMS())
+	var ids []parser.StreamId
+	i := 5
+	for ; i < len(args); i++ {
+		id, err := parseStreamId(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	deliveryTime := now
+	var (
+		retryCount    int64 = -1
+		force, justId bool
+		lastId        parser.StreamId
+		hasLastId     bool
+	)
+	for ; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		switch opt {
+		case "force":
+			force = true
+		case "justid":
+			justId = true
+		case "idle", "time", "retrycount", "lastid":
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			i++
+			if opt == "lastid" {
+				if lastId, err = parseStreamId(args[i], 0); err != nil {
+					return err
+				}
+				hasLastId = true
+				continue
+			}
+			v, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			switch opt {
+			case "idle":
+				deliveryTime = now - uint64(v)
+			case "time":
+				deliveryTime = uint64(v)
+			default:
+				retryCount = v
+			}
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	if hasLastId && g.lastId.Less(lastId) {
+		g.lastId = lastId
+	}
+	consumer := g.consumer(args[3], now)
+	for _, id := range ids {
+		nack, pending := g.pel[id]
+		if _, exist := s.search(id); !exist {
+			// entry已经删除,从pel中删除
+			delete(g.pel, id)
+			continue
+		}
+		if !pending {
+			if !force {
+				continue
+			}
+			nack = &streamNACK{deliveryTime: now}
+			g.pel[id] = nack
+		}
+		if minIdle > 0 && pending && now-nack.deliveryTime < uint64(minIdle) {
+			continue
+		}
+		nack.consumer = args[3]
+		nack.deliveryTime = deliveryTime
+		if retryCount >= 0 {
+			nack.deliveryCount = uint64(retryCount)
+		} else if !justId {
+			nack.deliveryCount++
+		}
+		consumer.seenTime = now
+	}
+	return nil
+}
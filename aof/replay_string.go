@@ -0,0 +1,563 @@
+/*
+ *Descript:重放string相关的命令
+ */
+package aof
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const maxStringSize = 512 * 1024 * 1024 // proto-max-bulk-len
+
+// 写入string,keepTTL为true时保留原来的过期时间
+func (r *Replayer) setString(key, val string, expire int64, keepTTL bool) {
+	db := r.current()
+	if old, ok := db[key]; ok && keepTTL {
+		expire = old.expire
+	}
+	db[key] = &keyValue{kind: parser.ObjectTypeString, str: val, expire: expire}
+}
+
+// 获取string类型的key
+func (r *Replayer) lookupString(key string) (*keyValue, error) {
+	return r.lookupKind(key, parser.ObjectTypeString)
+}
+
+// 解析EX/PX/EXAT/PXAT的过期时间
+func expireOption(opt, val string) (int64, error) {
+	t, err := parseInt(val)
+	if err != nil {
+		return 0, err
+	}
+	if t <= 0 {
+		return 0, errors.New("invalid expire time")
+	}
+	switch opt {
+	case "ex":
+		return nowMS() + t*1000, nil
+	case "px":
+		return nowMS() + t, nil
+	case "exat":
+		return t * 1000, nil
+	default:
+		return t, nil
+	}
+}
+
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
+func replaySet(r *Replayer, args []string) error {
+	var (
+		expire  int64
+		keepTTL bool
+		nx, xx  bool
+		err     error
+	)
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		switch opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			if expire, err = expireOption(opt, args[i+1]); err != nil {
+				return err
+			}
+			i++
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	exist := r.lookup(args[1]) != nil
+	if (nx && exist) || (xx && !exist) {
+		return nil
+	}
+	r.setString(args[1], args[2], expire, keepTTL)
+	return nil
+}
+
+func replaySetNX(r *Replayer, args []string) error {
+	if r.lookup(args[1]) == nil {
+		r.setString(args[1], args[2], 0, false)
+	}
+	return nil
+}
+
+// SETEX/PSETEX key time value
+func replaySetEX(r *Replayer, args []string) error {
+	opt := "ex"
+	if strings.ToLower(args[0]) == "psetex" {
+		opt = "px"
+	}
+	expire, err := expireOption(opt, args[2])
+	if err != nil {
+		return err
+	}
+	r.setString(args[1], args[3], expire, false)
+	return nil
+}
+
+func replayGetSet(r *Replayer, args []string) error {
+	if _, err := r.lookupString(args[1]); err != nil {
+		return err
+	}
+	r.setString(args[1], args[2], 0, false)
+	return nil
+}
+
+// GETEX key [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|PERSIST]
+func replayGetEX(r *Replayer, args []string) error {
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	var expire int64
+	set := false
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		switch opt {
+		case "persist":
+			expire, set = 0, true
+		case "ex", "px", "exat", "pxat":
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			if expire, err = expireOption(opt, args[i+1]); err != nil {
+				return err
+			}
+			set = true
+			i++
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	if v != nil && set {
+		v.expire = expire
+	}
+	return nil
+}
+
+// MSET/MSETNX key value [key value ...]
+func replayMSet(r *Replayer, args []string) error {
+	if len(args)%2 != 1 {
+		return errors.New(ErrReplayArgs)
+	}
+	if strings.ToLower(args[0]) == "msetnx" {
+		for i := 1; i < len(args); i += 2 {
+			if r.lookup(args[i]) != nil {
+				return nil
+			}
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		r.setString(args[i], args[i+1], 0, false)
+	}
+	return nil
+}
+
+func replayAppend(r *Replayer, args []string) error {
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		r.setString(args[1], args[2], 0, false)
+		return nil
+	}
+	v.str += args[2]
+	return nil
+}
+
+// INCR/DECR/INCRBY/DECRBY
+func replayIncr(r *Replayer, args []string) error {
+	var incr int64 = 1
+	if len(args) > 2 {
+		i, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		incr = i
+	}
+	switch strings.ToLower(args[0]) {
+	case "decr":
+		incr = -1
+	case "decrby":
+		if incr == math.MinInt64 {
+			return errors.New(ErrIncrOverflow)
+		}
+		incr = -incr
+	}
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	var val int64
+	if v != nil {
+		if val, err = parseInt(v.str); err != nil {
+			return err
+		}
+	}
+	if (incr < 0 && val < 0 && incr < math.MinInt64-val) || (incr > 0 && val > 0 && incr > math.MaxInt64-val) {
+		return errors.New(ErrIncrOverflow)
+	}
+	r.setString(args[1], strconv.FormatInt(val+incr, 10), 0, true)
+	return nil
+}
+
+func replayIncrByFloat(r *Replayer, args []string) error {
+	incr, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	var val float64
+	if v != nil {
+		if val, err = parseFloat(v.str); err != nil {
+			return err
+		}
+	}
+	val += incr
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return errors.New("increment would produce NaN or Infinity")
+	}
+	r.setString(args[1], formatFloat(val), 0, true)
+	return nil
+}
+
+// SETRANGE key offset value
+func replaySetRange(r *Replayer, args []string) error {
+	offset, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset+int64(len(args[3])) > maxStringSize {
+		return errors.New(ErrIndexOutOfRange)
+	}
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	if len(args[3]) == 0 {
+		return nil
+	}
+	var b []byte
+	if v != nil {
+		b = []byte(v.str)
+	}
+	if end := int(offset) + len(args[3]); end > len(b) {
+		b = append(b, make([]byte, end-len(b))...)
+	}
+	copy(b[offset:], args[3])
+	r.setString(args[1], string(b), 0, true)
+	return nil
+}
+
+// SETBIT key offset value
+func replaySetBit(r *Replayer, args []string) error {
+	offset, err := parseInt(args[2])
+	if err != nil || offset < 0 || offset >= maxStringSize*8 {
+		return errors.New("bit offset is not an integer or out of range")
+	}
+	if args[3] != "0" && args[3] != "1" {
+		return errors.New("bit is not an integer or out of range")
+	}
+	v, err := r.lookupString(args[1])
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if v != nil {
+		b = []byte(v.str)
+	}
+	byteIndex := int(offset >> 3)
+	if byteIndex >= len(b) {
+		b = append(b, make([]byte, byteIndex+1-len(b))...)
+	}
+	bit := byte(1 << (7 - uint(offset&7)))
+	if args[3] == "1" {
+		b[byteIndex] |= bit
+	} else {
+		b[byteIndex] &^= bit
+	}
+	r.setString(args[1], string(b), 0, true)
+	return nil
+}
+
+// BITOP AND|OR|XOR|NOT destkey key [key ...]
+func replayBitOp(r *Replayer, args []string) error {
+	op := strings.ToLower(args[1])
+	switch op {
+	case "and", "or", "xor":
+	case "not":
+		if len(args) != 4 {
+			return errors.New(ErrReplaySyntax)
+		}
+	default:
+		return errors.New(ErrReplaySyntax)
+	}
+	srcs := make([]string, 0, len(args)-3)
+	maxLen := 0
+	for _, key := range args[3:] {
+		v, err := r.lookupString(key)
+		if err != nil {
+			return err
+		}
+		var s string
+		if v != nil {
+			s = v.str
+		}
+		srcs = append(srcs, s)
+		if len(s) > maxLen {
+			maxLen = len(s)
+		}
+	}
+	res := make([]byte, maxLen)
+	for i := 0; i < maxLen; i++ {
+		for j, s := range srcs {
+			var c byte
+			if i < len(s) {
+				c = s[i]
+			}
+			switch op {
+			case "and":
+				if j == 0 {
+					res[i] = c
+				} else {
+					res[i] &= c
+				}
+			case "or":
+				res[i] |= c
+			case "xor":
+				res[i] ^= c
+			case "not":
+				res[i] = ^c
+			}
+		}
+	}
+	if maxLen == 0 {
+		delete(r.current(), args[2])
+		return nil
+	}
+	r.setString(args[2], string(res), 0, false)
+	return nil
+}
+
+// BITFIELD的整数类型:i1-i64,u1-u63
+type bitfieldType struct {
+	signed bool
+	bits   uint
+}
+
+func parseBitfieldType(s string) (bitfieldType, error) {
+	var t bitfieldType
+	if len(s) > 1 && (s[0] == 'i' || s[0] == 'I' || s[0] == 'u' || s[0] == 'U') {
+		t.signed = s[0] == 'i' || s[0] == 'I'
+		bits, err := strconv.Atoi(s[1:])
+		if err == nil && bits >= 1 && (bits <= 63 || (t.signed && bits == 64)) {
+			t.bits = uint(bits)
+			return t, nil
+		}
+	}
+	return t, errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+}
+
+// BITFIELD的offset:#N表示N乘以类型的位数
+func parseBitfieldOffset(s string, t bitfieldType) (int64, error) {
+	hash := strings.HasPrefix(s, "#")
+	if hash {
+		s = s[1:]
+	}
+	offset, err := parseInt(s)
+	if err == nil && hash {
+		offset *= int64(t.bits)
+	}
+	if err != nil || offset < 0 || (offset+int64(t.bits)-1)>>3 >= maxStringSize {
+		return 0, errors.New("bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// 读取offset开始的bits位(高位在前)
+func getBitfield(b []byte, offset int64, t bitfieldType) uint64 {
+	var v uint64
+	for i := int64(0); i < int64(t.bits); i++ {
+		pos := offset + i
+		var bit uint64
+		if pos>>3 < int64(len(b)) {
+			bit = uint64(b[pos>>3]>>(7-uint(pos&7))) & 1
+		}
+		v = v<<1 | bit
+	}
+	if t.signed && t.bits < 64 && v&(1<<(t.bits-1)) != 0 {
+		v |= ^uint64(0) << t.bits
+	}
+	return v
+}
+
+// 写入offset开始的bits位(高位在前)
+func setBitfield(b []byte, offset int64, t bitfieldType, v uint64) {
+	for i := int64(0); i < int64(t.bits); i++ {
+		pos := offset + i
+		mask := byte(1 << (7 - uint(pos&7)))
+		if v>>uint(int64(t.bits)-1-i)&1 == 1 {
+			b[pos>>3] |= mask
+		} else {
+			b[pos>>3] &^= mask
+		}
+	}
+}
+
+// 计算value+incr并处理溢出(和redis的checkSignedBitfieldOverflow/checkUnsignedBitfieldOverflow一致),FAIL溢出时返回false
+func bitfieldAdd(value uint64, incr int64, t bitfieldType, overflow string) (uint64, bool) {
+	wrap := func() uint64 {
+		c := value + uint64(incr)
+		if t.bits < 64 {
+			mask := ^uint64(0) << t.bits
+			if t.signed && c&(1<<(t.bits-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return c
+	}
+	var limit uint64
+	if t.signed {
+		v := int64(value)
+		max := int64(math.MaxInt64)
+		if t.bits < 64 {
+			max = 1<<(t.bits-1) - 1
+		}
+		min := -max - 1
+		maxIncr, minIncr := max-v, min-v
+		switch {
+		case v > max || (t.bits != 64 && incr > maxIncr) || (v >= 0 && incr > 0 && incr > maxIncr):
+			limit = uint64(max)
+		case v < min || (t.bits != 64 && incr < minIncr) || (v < 0 && incr < 0 && incr < minIncr):
+			limit = uint64(min)
+		default:
+			return uint64(v + incr), true
+		}
+	} else {
+		max := uint64(1)<<t.bits - 1
+		maxIncr, minIncr := int64(max-value), -int64(value)
+		switch {
+		case value > max || (incr > 0 && incr > maxIncr):
+			limit = max
+		case incr < 0 && incr < minIncr:
+			limit = 0
+		default:
+			return value + uint64(incr), true
+		}
+	}
+	switch overflow {
+	case "sat":
+		return limit, true
+	case "fail":
+		return 0, false
+	}
+	return wrap(), true
+}
+
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+func replayBitfield(r *Replayer, args []string) error {
+	type bitfieldOp struct {
+		op       string
+		t        bitfieldType
+		offset   int64
+		value    int64
+		overflow string
+	}
+	var (
+		ops      []bitfieldOp
+		overflow = "wrap"
+		size     int64 // 写操作需要的string长度
+	)
+	for i := 2; i < len(args); i++ {
+		op := strings.ToLower(args[i])
+		switch op {
+		case "overflow":
+			if i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			overflow = strings.ToLower(args[i+1])
+			if overflow != "wrap" && overflow != "sat" && overflow != "fail" {
+				return errors.New("Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		case "get", "set", "incrby":
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+		argc := 3
+		if op == "get" {
+			argc = 2
+		}
+		if i+argc >= len(args) {
+			return errors.New(ErrReplaySyntax)
+		}
+		t, err := parseBitfieldType(args[i+1])
+		if err != nil {
+			return err
+		}
+		offset, err := parseBitfieldOffset(args[i+2], t)
+		if err != nil {
+			return err
+		}
+		o := bitfieldOp{op: op, t: t, offset: offset, overflow: overflow}
+		if op != "get" {
+			if o.value, err = parseInt(args[i+3]); err != nil {
+				return err
+			}
+			if end := (offset + int64(t.bits) + 7) >> 3; end > size {
+				size = end
+			}
+		}
+		ops = append(ops, o)
+		i += argc
+	}
+	v, err := r.lookupString(args[1])
+	if err != nil || size == 0 {
+		return err
+	}
+	var b []byte
+	if v != nil {
+		b = []byte(v.str)
+	}
+	if size > int64(len(b)) {
+		b = append(b, make([]byte, size-int64(len(b)))...)
+	}
+	for _, o := range ops {
+		var (
+			value uint64
+			ok    bool
+		)
+		switch o.op {
+		case "set":
+			value, ok = bitfieldAdd(uint64(o.value), 0, o.t, o.overflow)
+		case "incrby":
+			value, ok = bitfieldAdd(getBitfield(b, o.offset, o.t), o.value, o.t, o.overflow)
+		}
+		if ok {
+			setBitfield(b, o.offset, o.t, value)
+		}
+	}
+	r.setString(args[1], string(b), 0, true)
+	return nil
+}
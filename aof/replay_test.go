@@ -0,0 +1,312 @@
+package aof
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// 编码成aof中的命令
+func respCommand(args ...string) string {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return cmd
+}
+
+// object转换成便于比较的字符串
+func describeObject(object parser.TypeObject) string {
+	var s string
+	switch o := object.(type) {
+	case parser.StringObject:
+		s = "string " + o.Value()
+	case parser.ListObject:
+		s = "list " + strings.Join(o.Entries, ",")
+	case parser.HashMap:
+		fields := make([]string, 0, len(o.Entry))
+		for _, e := range o.Entry {
+			fields = append(fields, e.Field+"="+e.Value)
+		}
+		s = "hash " + strings.Join(fields, ",")
+	case parser.Set:
+		s = "set " + strings.Join(o.Entries, ",")
+	case parser.SortedSet:
+		members := make([]string, 0, len(o.Entries))
+		for _, e := range o.Entries {
+			members = append(members, fmt.Sprintf("%s=%v", e.Field, e.Score))
+		}
+		s = "zset " + strings.Join(members, ",")
+	case parser.RedisStream:
+		s = fmt.Sprintf("stream len=%d last=%s first=%s deleted=%s added=%d",
+			o.Length, o.LastId.String(), o.FirstId.String(), o.MaxDeletedId.String(), o.EntriesAdded)
+		for _, g := range o.Groups {
+			s += fmt.Sprintf("; %s last=%s read=%d pel=%d", g.Name, g.LastId, g.EntriesRead, len(g.PendingEntryList))
+			for _, c := range g.Consumers {
+				ids := make([]string, 0, len(c.PendingEntryList))
+				for id, nack := range c.PendingEntryList {
+					ids = append(ids, fmt.Sprintf("%s/%d", id, nack.(parser.StreamNACK).DeliveryCount))
+				}
+				sort.Strings(ids)
+				s += fmt.Sprintf(" %s[%s]", c.Name, strings.Join(ids, ","))
+			}
+		}
+	default:
+		return fmt.Sprintf("%T", object)
+	}
+	if expire := parser.ExpireOf(object); expire > 0 {
+		s += fmt.Sprintf(" ex=%d", expire)
+	}
+	return s
+}
+
+func TestReplay(t *testing.T) {
+	cases := []struct {
+		name string
+		cmds [][]string
+		tail string            // 追加在命令之后的数据
+		want map[string]string // db0中key的内容,空字符串表示key不存在
+		err  string            // 错误信息包含的内容
+	}{
+		{
+			name: "multi exec",
+			cmds: [][]string{{"MULTI"}, {"SET", "a", "1"}, {"INCR", "a"}, {"EXEC"}},
+			want: map[string]string{"a": "string 2"},
+		},
+		{
+			name: "discard",
+			cmds: [][]string{{"MULTI"}, {"SET", "a", "1"}, {"DISCARD"}, {"SET", "b", "1"}},
+			want: map[string]string{"a": "", "b": "string 1"},
+		},
+		{
+			name: "multi without exec",
+			cmds: [][]string{{"SET", "a", "1"}, {"MULTI"}, {"SET", "a", "2"}, {"SET", "b", "2"}},
+			want: map[string]string{"a": "string 1", "b": ""},
+		},
+		{
+			name: "nested multi",
+			cmds: [][]string{{"MULTI"}, {"MULTI"}},
+			err:  ErrReplayMulti,
+		},
+		{
+			name: "exec without multi",
+			cmds: [][]string{{"SET", "a", "1"}, {"EXEC"}},
+			err:  ErrReplayExec,
+		},
+		{
+			name: "discard without multi",
+			cmds: [][]string{{"DISCARD"}},
+			err:  ErrReplayDiscard,
+		},
+		{
+			name: "torn tail",
+			cmds: [][]string{{"RPUSH", "l", "a", "b"}},
+			tail: "*3\r\n$5\r\nRPUSH\r\n$1\r\nl\r\n$5\r\nab",
+			want: map[string]string{"l": "list a,b"},
+		},
+		{
+			name: "torn tail in multi",
+			cmds: [][]string{{"SET", "a", "1"}, {"MULTI"}, {"SET", "a", "2"}},
+			tail: "*1\r\n$4\r\nEX",
+			want: map[string]string{"a": "string 1"},
+		},
+		{
+			name: "torn multibulk length",
+			cmds: [][]string{{"SET", "a", "1"}},
+			tail: "*2",
+			want: map[string]string{"a": "string 1"},
+		},
+		{
+			name: "expire options",
+			cmds: [][]string{
+				{"SET", "k", "v"},
+				{"PEXPIREAT", "k", "5000", "XX"}, // 没有过期时间,不设置
+				{"PEXPIREAT", "k", "5000", "GT"}, // 没有过期时间当作无限大,不设置
+				{"PEXPIREAT", "k", "5000", "NX"},
+				{"PEXPIREAT", "k", "6000", "NX"},
+				{"PEXPIREAT", "k", "4000", "GT"},
+				{"PEXPIREAT", "k", "7000", "GT"},
+				{"PEXPIREAT", "k", "8000", "LT"},
+				{"PEXPIREAT", "k", "3000", "LT"},
+				{"EXPIREAT", "k", "9", "XX"},
+				{"SET", "n", "v"},
+				{"PEXPIREAT", "n", "2000", "LT"},
+				{"SET", "p", "v"},
+				{"PEXPIREAT", "p", "2000"},
+				{"PERSIST", "p"},
+				{"PEXPIREAT", "missing", "2000"},
+			},
+			want: map[string]string{"k": "string v ex=9000", "n": "string v ex=2000", "p": "string v", "missing": ""},
+		},
+		{
+			name: "bad expire option",
+			cmds: [][]string{{"SET", "k", "v"}, {"PEXPIREAT", "k", "1000", "YY"}},
+			err:  ErrReplaySyntax,
+		},
+		{
+			name: "set options",
+			cmds: [][]string{
+				{"SET", "a", "1", "PXAT", "5000"},
+				{"SET", "a", "2", "KEEPTTL"},
+				{"SET", "a", "3", "NX"},
+				{"SET", "b", "1", "XX"},
+				{"SET", "c", "1", "PXAT", "5000"},
+				{"SET", "c", "2"},
+			},
+			want: map[string]string{"a": "string 2 ex=5000", "b": "", "c": "string 2"},
+		},
+		{
+			name: "stream groups",
+			cmds: [][]string{
+				{"XADD", "s", "1-0", "f", "v"},
+				{"XADD", "s", "2-0", "f", "v"},
+				{"XADD", "s", "3-0", "f", "v"},
+				{"XGROUP", "CREATE", "s", "g1", "0", "ENTRIESREAD", "0"},
+				{"XGROUP", "CREATE", "s", "g2", "$"},
+				// XREADGROUP在aof中转换为XCLAIM
+				{"XCLAIM", "s", "g1", "alice", "0", "1-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "1-0"},
+				{"XCLAIM", "s", "g1", "alice", "0", "2-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "2-0"},
+				{"XGROUP", "SETID", "s", "g1", "2-0", "ENTRIESREAD", "2"},
+				{"XCLAIM", "s", "g1", "bob", "0", "2-0", "TIME", "2000", "RETRYCOUNT", "2", "JUSTID"},
+				{"XACK", "s", "g1", "1-0"},
+				{"XGROUP", "CREATECONSUMER", "s", "g2", "carol"},
+				{"XDEL", "s", "1-0"},
+			},
+			want: map[string]string{"s": "stream len=2 last=3-0 first=2-0 deleted=1-0 added=3" +
+				"; g1 last=2-0 read=2 pel=1 alice[] bob[2-0/2]" +
+				"; g2 last=3-0 read=3 pel=0 carol[]"},
+		},
+		{
+			name: "stream group destroy and deleted entry claim",
+			cmds: [][]string{
+				{"XGROUP", "CREATE", "s", "g1", "$", "MKSTREAM"},
+				{"XGROUP", "CREATE", "s", "g2", "$"},
+				{"XADD", "s", "1-0", "f", "v"},
+				{"XCLAIM", "s", "g1", "alice", "0", "1-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "1-0"},
+				{"XDEL", "s", "1-0"},
+				{"XCLAIM", "s", "g1", "alice", "0", "1-0", "TIME", "2000", "JUSTID"},
+				{"XGROUP", "DESTROY", "s", "g2"},
+			},
+			want: map[string]string{"s": "stream len=0 last=1-0 first=0-0 deleted=1-0 added=1" +
+				"; g1 last=1-0 read=0 pel=0 alice[]"},
+		},
+		{
+			name: "stream group exists",
+			cmds: [][]string{{"XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"}, {"XGROUP", "CREATE", "s", "g", "$"}},
+			err:  ErrGroupExist,
+		},
+		{
+			name: "list moves",
+			cmds: [][]string{
+				{"RPUSH", "l", "a", "b", "c", "d"},
+				{"LMOVE", "l", "m", "LEFT", "RIGHT"},
+				{"RPOPLPUSH", "l", "m"},
+				{"LINSERT", "l", "BEFORE", "b", "x"},
+				{"RPOPLPUSH", "l", "l"},
+			},
+			want: map[string]string{"l": "list c,x,b", "m": "list d,a"},
+		},
+		{
+			name: "zset store",
+			cmds: [][]string{
+				{"ZADD", "z1", "1", "a", "2", "b"},
+				{"ZADD", "z2", "3", "b", "4", "c"},
+				{"ZUNIONSTORE", "u", "2", "z1", "z2", "WEIGHTS", "1", "2", "AGGREGATE", "MAX"},
+				{"ZINTERSTORE", "i", "2", "z1", "z2"},
+				{"ZRANGESTORE", "r", "z1", "(1", "+inf", "BYSCORE"},
+				{"ZINTERSTORE", "e", "2", "z1", "missing"},
+			},
+			want: map[string]string{"u": "zset a=1,b=6,c=8", "i": "zset b=5", "r": "zset b=2", "e": ""},
+		},
+		{
+			name: "wrong type",
+			cmds: [][]string{{"SET", "a", "1"}, {"RPUSH", "a", "x"}},
+			err:  ErrWrongType,
+		},
+		{
+			name: "unsupported command",
+			cmds: [][]string{{"NOSUCHCMD", "a"}},
+			err:  ErrReplayUnsupported,
+		},
+	}
+	for _, c := range cases {
+		var aof string
+		for _, cmd := range c.cmds {
+			aof += respCommand(cmd...)
+		}
+		p, err := NewAofParser(strings.NewReader(aof + c.tail))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewReplayer(ReplayArg{})
+		err = r.Replay(context.TODO(), p)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %s", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		for key, want := range c.want {
+			var got string
+			if object, ok := r.Keyspace().Object(0, key); ok {
+				got = describeObject(object)
+			}
+			if got != want {
+				t.Errorf("%s: key %s is %q, want %q", c.name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestReplaySkipUnsupported(t *testing.T) {
+	r := NewReplayer(ReplayArg{SkipUnsupported: true})
+	cmds := [][]string{{"SET", "a", "1"}, {"NOSUCHCMD", "a"}, {"NOSUCHCMD", "b"}, {"PFCOUNT", "h"}, {"PFDEBUG", "GETREG", "h"}}
+	for _, cmd := range cmds {
+		if err := r.Apply(cmd); err != nil {
+			t.Fatalf("%v: %v", cmd, err)
+		}
+	}
+	if commands, skipped := r.Result(); commands != 5 || skipped != 2 {
+		t.Fatalf("commands %d skipped %d", commands, skipped)
+	}
+	if n := r.Skipped()["nosuchcmd"]; n != 2 {
+		t.Fatalf("skipped nosuchcmd %d", n)
+	}
+}
+
+func TestReplayExport(t *testing.T) {
+	r := NewReplayer(ReplayArg{})
+	cmds := [][]string{{"SELECT", "1"}, {"SET", "b", "1"}, {"SET", "a", "1", "PXAT", "5000"}, {"SELECT", "0"}, {"SADD", "s", "y", "x"}}
+	for _, cmd := range cmds {
+		if err := r.Apply(cmd); err != nil {
+			t.Fatalf("%v: %v", cmd, err)
+		}
+	}
+	var got []string
+	err := r.Keyspace().Export(context.TODO(), func(ctx context.Context, object parser.TypeObject) error {
+		switch o := object.(type) {
+		case parser.SelectionDB:
+			got = append(got, fmt.Sprintf("select %d", o.Index))
+		case parser.ResizeDB:
+			got = append(got, fmt.Sprintf("resize %d %d", o.DBSize, o.ExpireSize))
+		default:
+			got = append(got, describeObject(object))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"select 0", "resize 1 0", "set x,y", "select 1", "resize 2 1", "string 1 ex=5000", "string 1"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("export %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,523 @@
+/*
+ *Descript:重放sorted set相关的命令
+ */
+package aof
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const ErrZSetRange = "min or max is not a float"
+
+// 按照score和member排序
+func sortedZSet(zset map[string]float64) []string {
+	members := make([]string, 0, len(zset))
+	for member := range zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		si, sj := zset[members[i]], zset[members[j]]
+		if si != sj {
+			return si < sj
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func replayZAdd(r *Replayer, args []string) error {
+	var nx, xx, gt, lt, incr bool
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+		case "incr":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (incr && len(pairs) != 2) || (nx && (xx || gt || lt)) || (gt && lt) {
+		return errors.New(ErrReplaySyntax)
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseFloat(pairs[j])
+		if err != nil {
+			return err
+		}
+		scores = append(scores, score)
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeSortedSet)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if xx {
+			return nil
+		}
+		v, _ = r.lookupOrCreate(args[1], parser.ObjectTypeSortedSet)
+	}
+	for j, score := range scores {
+		member := pairs[j*2+1]
+		old, exist := v.zset[member]
+		if (nx && exist) || (xx && !exist) {
+			continue
+		}
+		if incr && exist {
+			score += old
+			if math.IsNaN(score) {
+				return errors.New("resulting score is not a number (NaN)")
+			}
+		}
+		if exist && ((gt && score <= old) || (lt && score >= old)) {
+			continue
+		}
+		v.zset[member] = score
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// ZINCRBY key increment member
+func replayZIncrBy(r *Replayer, args []string) error {
+	incr, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupOrCreate(args[1], parser.ObjectTypeSortedSet)
+	if err != nil {
+		return err
+	}
+	score := v.zset[args[3]] + incr
+	if math.IsNaN(score) {
+		return errors.New("resulting score is not a number (NaN)")
+	}
+	v.zset[args[3]] = score
+	return nil
+}
+
+func replayZRem(r *Replayer, args []string) error {
+	v, err := r.lookupKind(args[1], parser.ObjectTypeSortedSet)
+	if err != nil || v == nil {
+		return err
+	}
+	for _, member := range args[2:] {
+		delete(v.zset, member)
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// 删除满足条件的member
+func (r *Replayer) zsetRemove(key string, match func(member string, score float64, rank int) bool) error {
+	v, err := r.lookupKind(key, parser.ObjectTypeSortedSet)
+	if err != nil || v == nil {
+		return err
+	}
+	for rank, member := range sortedZSet(v.zset) {
+		if match(member, v.zset[member], rank) {
+			delete(v.zset, member)
+		}
+	}
+	r.deleteIfEmpty(key, v)
+	return nil
+}
+
+// 解析score区间:(1.5 开区间, -inf, +inf
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false, errors.New(ErrZSetRange)
+	}
+	return f, exclusive, nil
+}
+
+// ZREMRANGEBYSCORE key min max
+func replayZRemRangeByScore(r *Replayer, args []string) error {
+	min, minEx, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, maxEx, err := parseScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	return r.zsetRemove(args[1], func(member string, score float64, rank int) bool {
+		return (score > min || (!minEx && score == min)) && (score < max || (!maxEx && score == max))
+	})
+}
+
+// ZREMRANGEBYRANK key start stop
+func replayZRemRangeByRank(r *Replayer, args []string) error {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeSortedSet)
+	if err != nil || v == nil {
+		return err
+	}
+	length := len(v.zset)
+	start, stop = listIndex(start, length), listIndex(stop, length)
+	if start < 0 {
+		start = 0
+	}
+	return r.zsetRemove(args[1], func(member string, score float64, rank int) bool {
+		return int64(rank) >= start && int64(rank) <= stop
+	})
+}
+
+// 字典序区间的一端:[a 闭区间,(a 开区间,- 最小,+ 最大
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int // -1:负无穷,1:正无穷
+}
+
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, nil
+	case s == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	}
+	return lexBound{}, errors.New("min or max not valid string range item")
+}
+
+// member大于等于(开区间为大于)min
+func (b lexBound) lessEqual(member string) bool {
+	if b.inf != 0 {
+		return b.inf < 0
+	}
+	return member > b.value || (!b.exclusive && member == b.value)
+}
+
+// member小于等于(开区间为小于)max
+func (b lexBound) greaterEqual(member string) bool {
+	if b.inf != 0 {
+		return b.inf > 0
+	}
+	return member < b.value || (!b.exclusive && member == b.value)
+}
+
+// ZREMRANGEBYLEX key min max
+func replayZRemRangeByLex(r *Replayer, args []string) error {
+	min, err := parseLexBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseLexBound(args[3])
+	if err != nil {
+		return err
+	}
+	return r.zsetRemove(args[1], func(member string, score float64, rank int) bool {
+		return min.lessEqual(member) && max.greaterEqual(member)
+	})
+}
+
+// ZPOPMIN/ZPOPMAX key [count]
+func replayZPop(r *Replayer, args []string) error {
+	count := int64(1)
+	if len(args) > 2 {
+		c, err := parseInt(args[2])
+		if err != nil || c < 0 {
+			return errors.New(ErrNotInteger)
+		}
+		count = c
+	}
+	v, err := r.lookupKind(args[1], parser.ObjectTypeSortedSet)
+	if err != nil || v == nil {
+		return err
+	}
+	members := sortedZSet(v.zset)
+	if strings.ToLower(args[0]) == "zpopmax" {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	for i := 0; int64(i) < count && i < len(members); i++ {
+		delete(v.zset, members[i])
+	}
+	r.deleteIfEmpty(args[1], v)
+	return nil
+}
+
+// ZUNIONSTORE/ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+// ZDIFFSTORE destination numkeys key [key ...]
+func replayZStore(r *Replayer, args []string) error {
+	name := strings.ToLower(args[0])
+	numKeys, err := parseInt(args[2])
+	if err != nil || numKeys < 1 || numKeys > int64(len(args)-3) {
+		return errors.New(ErrReplaySyntax)
+	}
+	keys := args[3 : 3+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "sum"
+	for i := 3 + int(numKeys); i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "weights":
+			if name == "zdiffstore" || i+int(numKeys) >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			for j := range weights {
+				if weights[j], err = parseFloat(args[i+1+j]); err != nil {
+					return err
+				}
+			}
+			i += int(numKeys)
+		case "aggregate":
+			if name == "zdiffstore" || i+1 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			aggregate = strings.ToLower(args[i+1])
+			if aggregate != "sum" && aggregate != "min" && aggregate != "max" {
+				return errors.New(ErrReplaySyntax)
+			}
+			i++
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	// set也可以作为参数,score为1
+	srcs := make([]map[string]float64, 0, numKeys)
+	for _, key := range keys {
+		src := map[string]float64{}
+		v := r.lookup(key)
+		switch {
+		case v == nil:
+		case v.kind == parser.ObjectTypeSortedSet:
+			src = v.zset
+		case v.kind == parser.ObjectTypeSet:
+			for member := range v.set {
+				src[member] = 1
+			}
+		default:
+			return errors.New(ErrWrongType)
+		}
+		srcs = append(srcs, src)
+	}
+	res := make(map[string]float64)
+	switch name {
+	case "zunionstore":
+		for i, src := range srcs {
+			for member, score := range src {
+				score = zsetWeight(score, weights[i])
+				if old, ok := res[member]; ok {
+					score = zsetAggregate(old, score, aggregate)
+				}
+				res[member] = score
+			}
+		}
+	case "zinterstore":
+		for member, score := range srcs[0] {
+			score = zsetWeight(score, weights[0])
+			in := true
+			for i, src := range srcs[1:] {
+				s, ok := src[member]
+				if !ok {
+					in = false
+					break
+				}
+				score = zsetAggregate(score, zsetWeight(s, weights[i+1]), aggregate)
+			}
+			if in {
+				res[member] = score
+			}
+		}
+	default:
+		for member, score := range srcs[0] {
+			res[member] = score
+		}
+		for _, src := range srcs[1:] {
+			for member := range src {
+				delete(res, member)
+			}
+		}
+	}
+	delete(r.current(), args[1])
+	if len(res) > 0 {
+		r.current()[args[1]] = &keyValue{kind: parser.ObjectTypeSortedSet, zset: res}
+	}
+	return nil
+}
+
+// score乘以权重,nan当作0
+func zsetWeight(score, weight float64) float64 {
+	if s := score * weight; !math.IsNaN(s) {
+		return s
+	}
+	return 0
+}
+
+// 合并score
+func zsetAggregate(a, b float64, aggregate string) float64 {
+	switch aggregate {
+	case "min":
+		return math.Min(a, b)
+	case "max":
+		return math.Max(a, b)
+	}
+	if s := a + b; !math.IsNaN(s) {
+		return s
+	}
+	return 0
+}
+
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func replayZRangeStore(r *Replayer, args []string) error {
+	var (
+		byScore, byLex, rev, limit bool
+		offset, count              = int64(0), int64(-1)
+		err                        error
+	)
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "byscore":
+			byScore = true
+		case "bylex":
+			byLex = true
+		case "rev":
+			rev = true
+		case "limit":
+			if i+2 >= len(args) {
+				return errors.New(ErrReplaySyntax)
+			}
+			if offset, err = parseInt(args[i+1]); err != nil {
+				return err
+			}
+			if count, err = parseInt(args[i+2]); err != nil {
+				return err
+			}
+			limit = true
+			i += 2
+		default:
+			return errors.New(ErrReplaySyntax)
+		}
+	}
+	if (byScore && byLex) || (limit && !byScore && !byLex) {
+		return errors.New(ErrReplaySyntax)
+	}
+	v, err := r.lookupKind(args[2], parser.ObjectTypeSortedSet)
+	if err != nil {
+		return err
+	}
+	var members []string
+	if v != nil {
+		members = sortedZSet(v.zset)
+	}
+	if rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	// REV时BYSCORE和BYLEX的参数为max min
+	min, max := args[3], args[4]
+	if rev && (byScore || byLex) {
+		min, max = max, min
+	}
+	var selected []string
+	switch {
+	case byScore:
+		minScore, minEx, err := parseScoreBound(min)
+		if err != nil {
+			return err
+		}
+		maxScore, maxEx, err := parseScoreBound(max)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			score := v.zset[member]
+			if (score > minScore || (!minEx && score == minScore)) && (score < maxScore || (!maxEx && score == maxScore)) {
+				selected = append(selected, member)
+			}
+		}
+	case byLex:
+		minLex, err := parseLexBound(min)
+		if err != nil {
+			return err
+		}
+		maxLex, err := parseLexBound(max)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if minLex.lessEqual(member) && maxLex.greaterEqual(member) {
+				selected = append(selected, member)
+			}
+		}
+	default:
+		start, err := parseInt(min)
+		if err != nil {
+			return err
+		}
+		stop, err := parseInt(max)
+		if err != nil {
+			return err
+		}
+		start, stop = listIndex(start, len(members)), listIndex(stop, len(members))
+		if start < 0 {
+			start = 0
+		}
+		if stop >= int64(len(members)) {
+			stop = int64(len(members)) - 1
+		}
+		if start <= stop {
+			selected = members[start : stop+1]
+		}
+	}
+	if limit {
+		switch {
+		case offset < 0 || offset >= int64(len(selected)):
+			selected = nil
+		default:
+			selected = selected[offset:]
+			if count >= 0 && count < int64(len(selected)) {
+				selected = selected[:count]
+			}
+		}
+	}
+	delete(r.current(), args[1])
+	if len(selected) > 0 {
+		res := make(map[string]float64, len(selected))
+		for _, member := range selected {
+			res[member] = v.zset[member]
+		}
+		r.current()[args[1]] = &keyValue{kind: parser.ObjectTypeSortedSet, zset: res}
+	}
+	return nil
+}
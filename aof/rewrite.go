@@ -0,0 +1,158 @@
+/*
+ *Descript:将object重写为最少的aof命令(bgrewriteaof)
+ */
+package aof
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const DefaultItemsPerCmd = 64 // 和redis的AOF_REWRITE_ITEMS_PER_CMD一致
+
+// 重写参数
+type RewriteArg struct {
+	ItemsPerCmd  int  // 集合类型每个命令最多包含多少个元素,默认DefaultItemsPerCmd
+	NoStreamMeta bool // 目标redis低于7.0:stream不输出ENTRIESADDED/MAXDELETEDID/ENTRIESREAD
+}
+
+// 将一个key重写为aof命令:每个key一组命令(大集合按照ItemsPerCmd拆分),最后是PEXPIREAT
+func RewriteObject(object parser.TypeObject, arg RewriteArg, emit func(cmd []string) error) error {
+	if arg.ItemsPerCmd <= 0 {
+		arg.ItemsPerCmd = DefaultItemsPerCmd
+	}
+	key := object.Key()
+	var err error
+	switch o := object.(type) {
+	case parser.StringObject:
+		err = emit([]string{"SET", key, string(o.Val)})
+	case parser.ListObject:
+		err = emitChunks("RPUSH", key, o.Entries, 1, arg.ItemsPerCmd, emit)
+	case parser.HashMap:
+		items := make([]string, 0, len(o.Entry)*2)
+		for _, entry := range o.Entry {
+			items = append(items, entry.Field, entry.Value)
+		}
+		err = emitChunks("HMSET", key, items, 2, arg.ItemsPerCmd, emit)
+	case parser.Set:
+		err = emitChunks("SADD", key, o.Entries, 1, arg.ItemsPerCmd, emit)
+	case parser.SortedSet:
+		items := make([]string, 0, len(o.Entries)*2)
+		for _, entry := range o.Entries {
+			items = append(items, formatScore(entry.Score), parser.ToString(entry.Field))
+		}
+		err = emitChunks("ZADD", key, items, 2, arg.ItemsPerCmd, emit)
+	case parser.RedisStream:
+		err = rewriteStream(o, arg, emit)
+	case parser.ModuleObject:
+		return errors.New(fmt.Sprintf("%s %s %s", ErrReplayUnsupported, o.Type(), key))
+	default:
+		// select db,aux,resize db,module aux
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if expire := parser.ExpireOf(object); expire > 0 {
+		return emit([]string{"PEXPIREAT", key, strconv.FormatInt(expire, 10)})
+	}
+	return nil
+}
+
+// 集合类型按照每个命令最多itemsPerCmd个元素(每个元素width个参数)拆分
+func emitChunks(name, key string, items []string, width, itemsPerCmd int, emit func(cmd []string) error) error {
+	step := itemsPerCmd * width
+	for start := 0; start < len(items); start += step {
+		end := start + step
+		if end > len(items) {
+			end = len(items)
+		}
+		cmd := make([]string, 0, end-start+2)
+		cmd = append(cmd, name, key)
+		if err := emit(append(cmd, items[start:end]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zset的score:和redis一样使用17位有效数字
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', 17, 64)
+}
+
+// stream:XADD每个entry(空stream使用MAXLEN 0),XSETID,消费组,消费者,以及通过XCLAIM恢复没有ack的消息
+func rewriteStream(o parser.RedisStream, arg RewriteArg, emit func(cmd []string) error) error {
+	key := o.Key()
+	s, err := loadStream(o)
+	if err != nil {
+		return errors.Wrap(err, "rewrite stream "+key)
+	}
+	for _, item := range s.items {
+		cmd := append([]string{"XADD", key, item.id.String()}, item.fields...)
+		if err = emit(cmd); err != nil {
+			return err
+		}
+	}
+	if len(s.items) == 0 { // 空stream:添加一个entry之后删除
+		id := s.lastId
+		if id == (parser.StreamId{}) { // XADD的id需要大于0-0
+			id.Sequence = 1
+		}
+		if err = emit([]string{"XADD", key, "MAXLEN", "0", id.String(), "x", "y"}); err != nil {
+			return err
+		}
+	}
+	cmd := []string{"XSETID", key, s.lastId.String()}
+	if !arg.NoStreamMeta {
+		cmd = append(cmd, "ENTRIESADDED", strconv.FormatUint(s.entriesAdded, 10), "MAXDELETEDID", s.maxDeletedId.String())
+	}
+	if err = emit(cmd); err != nil {
+		return err
+	}
+	for _, name := range s.groupNames() {
+		g := s.groups[name]
+		cmd = []string{"XGROUP", "CREATE", key, name, g.lastId.String()}
+		if !arg.NoStreamMeta {
+			cmd = append(cmd, "ENTRIESREAD", strconv.FormatUint(g.entriesRead, 10))
+		}
+		if err = emit(cmd); err != nil {
+			return err
+		}
+		for _, consumer := range g.consumerNames() {
+			if err = emit([]string{"XGROUP", "CREATECONSUMER", key, name, consumer}); err != nil {
+				return err
+			}
+		}
+		ids := make([]parser.StreamId, 0, len(g.pel))
+		for id := range g.pel {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+		for _, id := range ids {
+			nack := g.pel[id]
+			if nack.consumer == "" {
+				continue
+			}
+			err = emit([]string{"XCLAIM", key, name, nack.consumer, "0", id.String(),
+				"TIME", strconv.FormatUint(nack.deliveryTime, 10), "RETRYCOUNT", strconv.FormatUint(nack.deliveryCount, 10),
+				"JUSTID", "FORCE"})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
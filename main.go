@@ -7,38 +7,98 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+	"github.com/qianxiansheng90/go-redis-tool/log_interface"
 	"github.com/qianxiansheng90/go-redis-tool/rdb/dump"
 	"github.com/qianxiansheng90/go-redis-tool/rdb/load"
 	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/writer"
+	"github.com/qianxiansheng90/go-redis-tool/tls_config"
 )
 
 const (
 	parseRDBToKV   = "kv"
 	parseRDBToJson = "json"
 	parseRDBToNone = "none"
+	parseRDBToRDB  = "rdb"
+	parseRDBToAof  = "aof"
+	parseRDBToCsv  = "csv"
 	actionDump     = "dump"
 	actionLoad     = "load"
 	actionParse    = "parse"
 	actionTrans    = "trans"
 	actionInfo     = "info"
+	actionAofLoad  = "aofload"
+	actionAofCheck = "aofcheck"
 )
 
 var (
-	action            = flag.String("action", actionDump, "<parse/load/dump/trans/info>.parse rdb file/load rdb file to redis/dump rdb from redis/dump rdb from redis and load to redis")
+	action            = flag.String("action", actionDump, "<parse/load/dump/trans/info/aofload/aofcheck>.parse rdb file/load rdb file to redis/dump rdb from redis/dump rdb from redis and load to redis/get rdb info/replay aof commands to redis/check aof file")
 	rdbFile           = flag.String("rdb", "", "<rdb-file-name>. For example: ./dump.rdb")
+	aofFile           = flag.String("aof", "", "<aof-file-name/appenddirname>.replay aof(or multi part aof of redis 7.0+) in memory and use the result as rdb for parse/load/info.For example: ./appendonly.aof")
+	aofOffset         = flag.Int64("aof_offset", 0, "aofload:start from this offset(start of a command, printed after aofload), for aof appended after last aofload")
+	aofDB             = flag.Uint64("aof_db", 0, "aofload:db at aof_offset, printed after aofload")
+	aofFix            = flag.Bool("fix", false, "aofcheck:write aof truncated at the last complete command to out_file")
+	aofSkipUnsupport  = flag.Bool("aof_skip_unsupported", false, "skip aof commands can not replay(eval, module commands...), default fail")
 	fromRedisAddr     = flag.String("from_addr", "127.0.0.1:6379", "<redis-host:redis-port>.dump from redis addr.For example:192.168.1.1:6379")
 	fromRedisAuthPass = flag.String("from_auth", "", "connect to from_addr dump rdb when set requirepass")
+	fromRedisAuthUser = flag.String("from_auth_user", "", "connect to from_addr with acl username(redis 6.0+), need +psync +replconf +ping")
 	toRedisAddr       = flag.String("to_addr", "", "<redis-host:redis-port>.load rdb to redis addr.For example:192.168.1.1:6379")
 	toRedisAuthUser   = flag.String("to_auth_user", "", "connect to to_addr with account username")
 	toRedisAuthPass   = flag.String("to_auth_pass", "", "connect to to_addr with account password")
-	parseType         = flag.String("parse_type", "none", "<csv/json/none>.")
+	fromTLS           = flag.Bool("from_tls", false, "connect to from_addr with tls")
+	fromTLSCA         = flag.String("from_tls_ca", "", "<ca-file>.verify from_addr certificate with this ca, default system ca")
+	fromTLSCert       = flag.String("from_tls_cert", "", "<cert-file>.client certificate for from_addr(mutual tls)")
+	fromTLSKey        = flag.String("from_tls_key", "", "<key-file>.client private key for from_addr(mutual tls)")
+	fromTLSServerName = flag.String("from_tls_server_name", "", "server name(sni) to verify from_addr certificate, default host of from_addr")
+	fromTLSInsecure   = flag.Bool("from_tls_insecure", false, "skip verify from_addr certificate")
+	toTLS             = flag.Bool("to_tls", false, "connect to to_addr with tls")
+	toTLSCA           = flag.String("to_tls_ca", "", "<ca-file>.verify to_addr certificate with this ca, default system ca")
+	toTLSCert         = flag.String("to_tls_cert", "", "<cert-file>.client certificate for to_addr(mutual tls)")
+	toTLSKey          = flag.String("to_tls_key", "", "<key-file>.client private key for to_addr(mutual tls)")
+	toTLSServerName   = flag.String("to_tls_server_name", "", "server name(sni) to verify to_addr certificate, default host of to_addr")
+	toTLSInsecure     = flag.Bool("to_tls_insecure", false, "skip verify to_addr certificate")
+	toRedisCluster    = flag.Bool("to_cluster", false, "to_addr is a redis cluster, keys of all db are loaded into db 0")
+	toClusterSkipDB   = flag.Bool("to_cluster_skip_db", false, "to_cluster:skip keys(commands) of db other than 0 instead of loading them into db 0")
+	parseType         = flag.String("parse_type", "none", "<kv/json/csv/none/rdb/aof>.csv:columns of redis-rdb-tools memory report.rdb:write parsed(filtered) keys to a new rdb file.aof:rewrite keys to minimal aof commands(resp format, can be imported by redis-cli --pipe)")
+	rdbVersion        = flag.Int("rdb_version", parser.VersionMax, "parse_type rdb:version of the new rdb file, keys need higher version fail")
+	rdbCompress       = flag.Bool("rdb_compress", false, "parse_type rdb:compress strings with lzf")
+	aofItemsPerCmd    = flag.Int("aof_items_per_cmd", aof.DefaultItemsPerCmd, "parse_type aof:max items of list/hash/set/zset per command")
+	aofNoStreamMeta   = flag.Bool("aof_no_stream_meta", false, "parse_type aof:target redis lower than 7.0, write streams without ENTRIESADDED/MAXDELETEDID/ENTRIESREAD")
 	outDst            = flag.String("out_file", "./out_file", "<file-path/redis-host:redis-port>.For example: ./dump.rdb.csv")
 	outBigKey         = flag.Bool("big_key", false, "print big key")
+	bigKeyOrder       = flag.String("big_key_order", load.BigKeyOrderMemory, "<memory/size/len>.info:sort big keys by estimated memory usage/value size/item count")
+	bigKeyTop         = flag.Int("big_key_top", 0, "info:only print the top n big keys of each type, 0 for all")
+	memoryRedisVer    = flag.Int("memory_redis_version", 0, "info/parse_type csv:major version of the redis to estimate memory usage for(7+ converts ziplist to listpack), 0 for the version that wrote the rdb")
+	checkSum          = flag.Bool("check_sum", false, "verify rdb crc64 checksum(rdb saved with rdbchecksum no has no checksum)")
+	filterKey         = flag.String("filter_key", "", "<pattern,pattern>.only keys match glob pattern.For example: user:*,order:*")
+	filterRegex       = flag.String("filter_regex", "", "only keys match regular expression")
+	filterExclude     = flag.String("filter_exclude", "", "<pattern,pattern>.exclude keys match glob pattern")
+	filterExcludeRe   = flag.String("filter_exclude_regex", "", "exclude keys match regular expression")
+	filterType        = flag.String("filter_type", "", "<String,Hash,Set,SortedSet,List,Stream,Module>.only keys of these types")
+	filterDB          = flag.String("filter_db", "", "<0,1>.only keys in these db")
+	filterExpiry      = flag.String("filter_expiry", "", "<ttl/nottl/expired>.only keys with ttl/without ttl/already expired")
+	checkpointFile    = flag.String("checkpoint", "", "<file-path>.load save checkpoint to this file periodically")
+	resumeLoad        = flag.Bool("resume", false, "load resume from checkpoint file, need the same rdb")
+	restoreLoad       = flag.Bool("restore", false, "load/trans keys by RESTORE with dump payload(redis 5.0+), keep stream consumer groups and lru/lfu")
+	syncCommand       = flag.Bool("sync_command", false, "trans keep sync commands after rdb like a replica(psync), until error or killed")
+	expiredPolicy     = flag.String("expired_policy", parser.ExpiredPolicyKeep, "<keep/skip/nottl>.keys already expired:keep ttl and let expire/skip/remove ttl")
+	loadParallel      = flag.Int("load_parallel", 1, "load/trans/aofload:connections write to to_addr in parallel, aofload with checkpoint always use 1")
+	loadSpeed         = flag.Int("load_speed", 0, "load/trans/aofload:max keys(aofload:commands) per second, 0 for unlimited")
+	loadPipeline      = flag.Int("load_pipeline", 10, "load/trans/aofload:commands per pipeline")
+	loadRetry         = flag.Int("load_retry", 3, "load/trans:max retries per command on network error(aofload commands never retry, resume from checkpoint)")
 )
 
 func main() {
 	flag.Parse()
+	pArg, err := newParseArg()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	switch *action {
 	case actionDump:
 		if *fromRedisAddr == "" {
@@ -46,14 +106,14 @@ func main() {
 			return
 		}
 		switch *parseType {
-		case parseRDBToKV, parseRDBToJson, parseRDBToNone:
-			dumpRedisRDBToFile(*fromRedisAddr, *outDst, *parseType, *fromRedisAuthPass)
+		case parseRDBToKV, parseRDBToJson, parseRDBToCsv, parseRDBToNone, parseRDBToRDB, parseRDBToAof:
+			dumpRedisRDBToFile(*fromRedisAddr, *outDst, *parseType, *fromRedisAuthUser, *fromRedisAuthPass, pArg)
 		default:
 			fmt.Println("not support parse_type")
 		}
 	case actionLoad:
-		if *rdbFile == "" {
-			fmt.Println("need rdb")
+		if *rdbFile == "" && *aofFile == "" {
+			fmt.Println("need rdb or aof")
 			return
 		}
 		if *toRedisAddr == "" {
@@ -61,15 +121,15 @@ func main() {
 			return
 		}
 
-		loadRDBFileToRedis(*rdbFile, *toRedisAddr, *toRedisAuthUser, *toRedisAuthPass)
+		loadRDBFileToRedis(*rdbFile, *toRedisAddr, *toRedisAuthUser, *toRedisAuthPass, pArg)
 	case actionParse:
-		if *rdbFile == "" {
-			fmt.Println("need rdb")
+		if *rdbFile == "" && *aofFile == "" {
+			fmt.Println("need rdb or aof")
 			return
 		}
 		switch *parseType {
-		case parseRDBToKV, parseRDBToJson, parseRDBToNone:
-			parseRDBFile(*rdbFile, *parseType, *outDst)
+		case parseRDBToKV, parseRDBToJson, parseRDBToCsv, parseRDBToNone, parseRDBToRDB, parseRDBToAof:
+			parseRDBFile(*rdbFile, *parseType, *outDst, pArg)
 		default:
 			fmt.Println("not support parse_type")
 		}
@@ -82,28 +142,56 @@ func main() {
 			fmt.Println("need to_addr")
 			return
 		}
-		transRedisRDBToRedis(*fromRedisAddr, *toRedisAddr, *toRedisAuthUser, *toRedisAuthPass)
+		transRedisRDBToRedis(*fromRedisAddr, *fromRedisAuthUser, *fromRedisAuthPass, *toRedisAddr, *toRedisAuthUser, *toRedisAuthPass, *syncCommand, pArg)
 	case actionInfo:
-		if *rdbFile == "" {
-			fmt.Println("need rdb")
+		if *rdbFile == "" && *aofFile == "" {
+			fmt.Println("need rdb or aof")
 			return
 		}
-		getRDBInfo(*rdbFile, *outBigKey)
+		getRDBInfo(*rdbFile, *outBigKey, pArg)
+	case actionAofLoad:
+		if *aofFile == "" || aof.IsMultiPartAof(*aofFile) {
+			fmt.Println("need aof file(multi part aof use -action load -aof)")
+			return
+		}
+		if *toRedisAddr == "" {
+			fmt.Println("need to_addr")
+			return
+		}
+		loadAofFileToRedis(*aofFile, *toRedisAddr, *toRedisAuthUser, *toRedisAuthPass, pArg)
+	case actionAofCheck:
+		if *aofFile == "" || aof.IsMultiPartAof(*aofFile) {
+			fmt.Println("need aof file(check files of multi part aof one by one)")
+			return
+		}
+		checkAofFile(*aofFile, *aofFix, *outDst)
 	default:
 		fmt.Println("not support action")
 		return
 	}
 }
 
-func getRDBInfo(rdbFile string, bigKey bool) {
-	info, err := load.GetRDBFileInfo(context.TODO(), rdbFile, load.GetRDBInfoArg{
+func getRDBInfo(rdbFile string, bigKey bool, pArg parser.ParseArg) {
+	file, err := openRDBFile(rdbFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+	info, err := load.GetRDBInfo(context.TODO(), file, load.GetRDBInfoArg{
 		OnlyRDBInfo:   !bigKey,
 		KeyStatistics: false,
 		BigKey:        bigKey,
 		BigKeyArg: load.BigKeyArg{
 			ValueSize: 1024,
 			TypeVal:   map[string]load.BigKey{},
+			OrderBy:   *bigKeyOrder,
+			Top:       *bigKeyTop,
 		},
+		Filter:             pArg.Filter,
+		CheckSum:           pArg.CheckSum,
+		ExpiredPolicy:      pArg.ExpiredPolicy,
+		MemoryRedisVersion: pArg.MemoryRedisVersion,
 	})
 	if err != nil {
 		fmt.Println(err)
@@ -117,12 +205,59 @@ func getRDBInfo(rdbFile string, bigKey bool) {
 			return
 		}
 		fmt.Println(string(data))
+		if data, err = json.Marshal(info.EncodingStatistics); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(data))
 	}
 }
 
+// 根据命令行参数生成解析参数
+func newParseArg() (parser.ParseArg, error) {
+	filterArg := parser.FilterArg{
+		Patterns:        splitFlag(*filterKey),
+		ExcludePatterns: splitFlag(*filterExclude),
+		Types:           splitFlag(*filterType),
+		Expiry:          *filterExpiry,
+	}
+	if *filterRegex != "" {
+		filterArg.Regexps = []string{*filterRegex}
+	}
+	if *filterExcludeRe != "" {
+		filterArg.ExcludeRegexps = []string{*filterExcludeRe}
+	}
+	for _, db := range splitFlag(*filterDB) {
+		dbNum, err := strconv.ParseUint(db, 10, 64)
+		if err != nil {
+			return parser.ParseArg{}, fmt.Errorf("invalid filter_db %s", db)
+		}
+		filterArg.DBs = append(filterArg.DBs, dbNum)
+	}
+	pArg := parser.ParseArg{CheckSum: *checkSum, ExpiredPolicy: *expiredPolicy, MemoryRedisVersion: *memoryRedisVer}
+	if len(filterArg.Patterns) == 0 && len(filterArg.ExcludePatterns) == 0 && len(filterArg.Types) == 0 &&
+		len(filterArg.Regexps) == 0 && len(filterArg.ExcludeRegexps) == 0 && len(filterArg.DBs) == 0 && filterArg.Expiry == "" {
+		return pArg, nil
+	}
+	filter, err := parser.NewKeyFilter(filterArg)
+	if err != nil {
+		return pArg, err
+	}
+	pArg.Filter = filter
+	return pArg, nil
+}
+
+// 逗号分隔的参数
+func splitFlag(val string) []string {
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
 // 解析rdb文件
-func parseRDBFile(filePath, outType, dst string) {
-	file, err := os.Open(filePath)
+func parseRDBFile(filePath, outType, dst string, pArg parser.ParseArg) {
+	file, err := openRDBFile(filePath)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -135,8 +270,24 @@ func parseRDBFile(filePath, outType, dst string) {
 	}
 	defer dstFile.Close()
 	switch outType {
-	case parseRDBToKV, parseRDBToJson:
-		if _, err = load.ParseRDBOutJson(context.TODO(), file, dstFile, parser.ParseArg{}); err != nil {
+	case parseRDBToKV:
+		if _, err = load.ParseRDBOutKV(context.TODO(), file, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToJson:
+		if _, err = load.ParseRDBOutJson(context.TODO(), file, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToCsv:
+		if _, err = load.ParseRDBOutCsv(context.TODO(), file, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToRDB:
+		if _, err = load.ParseRDBOutRDB(context.TODO(), file, dstFile, pArg, rdbWriterArg()); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToAof:
+		if _, err = load.ParseRDBOutAof(context.TODO(), file, dstFile, pArg, aofRewriteArg()); err != nil {
 			fmt.Println(err)
 		}
 	case parseRDBToNone:
@@ -149,14 +300,14 @@ func parseRDBFile(filePath, outType, dst string) {
 }
 
 // 将redis的rdb导出到文件
-func dumpRedisRDBToFile(fromRedisAddr, rdbFile, outType, userPass string) {
+func dumpRedisRDBToFile(fromRedisAddr, rdbFile, outType, userName, userPass string, pArg parser.ParseArg) {
 	dumper := dump.NewRDBDumper(dump.DumperArg{
 		RedisAddr:        fromRedisAddr,
-		RedisUser:        "",
+		RedisUser:        userName,
 		RedisPassword:    userPass,
 		ReadTimeout:      0,
 		KeepAliveTimeout: 0,
-		TLSEnable:        false,
+		TLS:              fromTLSArg(),
 	})
 	defer dumper.Close()
 	_, err := dumper.InitConnection()
@@ -171,8 +322,24 @@ func dumpRedisRDBToFile(fromRedisAddr, rdbFile, outType, userPass string) {
 		return
 	}
 	switch outType {
-	case parseRDBToKV, parseRDBToJson:
-		if _, err = load.ParseRDBOutJson(context.TODO(), reader, dstFile, parser.ParseArg{}); err != nil {
+	case parseRDBToKV:
+		if _, err = load.ParseRDBOutKV(context.TODO(), reader, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToJson:
+		if _, err = load.ParseRDBOutJson(context.TODO(), reader, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToCsv:
+		if _, err = load.ParseRDBOutCsv(context.TODO(), reader, dstFile, pArg); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToRDB:
+		if _, err = load.ParseRDBOutRDB(context.TODO(), reader, dstFile, pArg, rdbWriterArg()); err != nil {
+			fmt.Println(err)
+		}
+	case parseRDBToAof:
+		if _, err = load.ParseRDBOutAof(context.TODO(), reader, dstFile, pArg, aofRewriteArg()); err != nil {
 			fmt.Println(err)
 		}
 	case parseRDBToNone:
@@ -182,19 +349,38 @@ func dumpRedisRDBToFile(fromRedisAddr, rdbFile, outType, userPass string) {
 	}
 }
 
+// 打开rdb文件,指定了aof时在内存中重放aof(目录或者manifest为多文件aof)生成rdb
+func openRDBFile(rdbFile string) (io.ReadCloser, error) {
+	if *aofFile == "" {
+		file, err := os.Open(rdbFile)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	arg := aof.ReplayArg{SkipUnsupported: *aofSkipUnsupport, Logger: log_interface.NewLogStdout()}
+	if aof.IsMultiPartAof(*aofFile) {
+		return load.NewMultiPartAOFRDBReader(context.TODO(), *aofFile, arg)
+	}
+	file, err := os.Open(*aofFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return load.NewAOFRDBReader(context.TODO(), file, arg)
+}
+
 // 加载rdb文件到redis
-func loadRDBFileToRedis(rdbFile, toRedisAddr, userName, userPass string) {
-	file, err := os.Open(rdbFile)
+func loadRDBFileToRedis(rdbFile, toRedisAddr, userName, userPass string, pArg parser.ParseArg) {
+	file, err := openRDBFile(rdbFile)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 	defer file.Close()
-	loader, err := load.NewRDBLoad(context.TODO(), file, load.LoadArg{
-		Addr:     []string{toRedisAddr},
-		Username: userName,
-		Password: userPass,
-	}, parser.ParseArg{})
+	loadArg := toLoadArg(toRedisAddr, userName, userPass)
+	loadArg.Checkpoint, loadArg.Resume = *checkpointFile, *resumeLoad
+	loader, err := load.NewRDBLoad(context.TODO(), file, loadArg, pArg)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -202,35 +388,162 @@ func loadRDBFileToRedis(rdbFile, toRedisAddr, userName, userPass string) {
 	defer loader.Close()
 	if err = loader.Run(); err != nil {
 		fmt.Println(err)
+		return
+	}
+	result := loader.LoadResult()
+	fmt.Printf("load keys:%d skip expired keys:%d\n", result.TotalKeyCount, result.SkipExpiredKeyCount)
+}
+
+// 将aof中的命令重放到redis中:rdb preamble像rdb一样加载
+func loadAofFileToRedis(aofFile, toRedisAddr, userName, userPass string, pArg parser.ParseArg) {
+	loadArg := toLoadArg(toRedisAddr, userName, userPass)
+	loadArg.Checkpoint, loadArg.Resume = *checkpointFile, *resumeLoad
+	loader, err := load.NewAofLoad(context.TODO(), aofFile, load.AofLoadArg{
+		Load:        loadArg,
+		StartOffset: *aofOffset,
+		StartDB:     *aofDB,
+	}, pArg)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = loader.Run()
+	if cErr := loader.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	result := loader.LoadResult()
+	fmt.Printf("load preamble keys:%d commands:%d error commands:%d offset:%d db:%d\n",
+		result.PreambleKeyCount, result.TotalCmd, result.ErrorCmd, result.Offset, result.DB)
+}
+
+// 检查aof文件,fix为true时将截断到最后一个完整命令的aof写入dst
+func checkAofFile(aofFile string, fix bool, dst string) {
+	result, err := aof.CheckAof(context.TODO(), aofFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("aof size:%d commands:%d ok_up_to:%d ok_up_to_line:%d diff:%d\n",
+		result.Size, result.Commands, result.ValidSize, result.ValidLine, result.Size-result.ValidSize)
+	if result.Err == nil {
+		fmt.Println("aof is valid")
+		return
 	}
+	fmt.Printf("first corruption at offset:%d line:%d error:%s\n", result.ErrOffset, result.ErrLine, result.Err.Error())
+	if !fix {
+		return
+	}
+	if err = aof.FixAof(aofFile, dst, result); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("fixed aof %s size:%d\n", dst, result.ValidSize)
 }
 
-// 从redis将rdb导出到另一个redis中
-func transRedisRDBToRedis(fromRedisAddr, toRedisAddr, userName, userPass string) {
+// 从redis将rdb导出到另一个redis中,syncCommand为true时继续同步rdb之后的增量命令
+func transRedisRDBToRedis(fromRedisAddr, fromUser, fromPass, toRedisAddr, userName, userPass string, syncCommand bool, pArg parser.ParseArg) {
 	dumper := dump.NewRDBDumper(dump.DumperArg{
 		RedisAddr:        fromRedisAddr,
-		RedisUser:        userName,
-		RedisPassword:    userPass,
+		RedisUser:        fromUser,
+		RedisPassword:    fromPass,
 		ReadTimeout:      0,
 		KeepAliveTimeout: 0,
-		TLSEnable:        false,
+		TLS:              fromTLSArg(),
 	})
 	defer dumper.Close()
 	if _, err := dumper.InitConnection(); err != nil {
 		fmt.Println(err)
 		return
 	}
-	reader := dumper.Reader()
-	loader, err := load.NewRDBLoad(context.TODO(), reader, load.LoadArg{
-		Addr: []string{toRedisAddr},
-	}, parser.ParseArg{})
+	loadArg := toLoadArg(toRedisAddr, userName, userPass)
+	if !dumper.PartialSync() {
+		loader, err := load.NewRDBLoad(context.TODO(), dumper.Reader(), loadArg, pArg)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = loader.Run()
+		loader.Close()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if !syncCommand {
+		return
+	}
+	cmdLoader, err := load.NewCommandLoader(context.TODO(), loadArg)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	defer loader.Close()
-	if err = loader.Run(); err != nil {
+	defer cmdLoader.Close()
+	fmt.Printf("sync command from repl id:%s offset:%d\n", dumper.ReplId(), dumper.ReplOffset())
+	if err = dumper.SyncCommands(context.TODO(), cmdLoader.Load, cmdLoader.Flush); err != nil {
 		fmt.Println(err)
-		return
+	}
+	total, errCount := cmdLoader.Result()
+	fmt.Printf("sync commands:%d error commands:%d repl offset:%d\n", total, errCount, dumper.ReplOffset())
+}
+
+// 源redis的tls参数
+func fromTLSArg() tls_config.TLSArg {
+	return tls_config.TLSArg{
+		Enable:             *fromTLS,
+		CAFile:             *fromTLSCA,
+		CertFile:           *fromTLSCert,
+		KeyFile:            *fromTLSKey,
+		ServerName:         *fromTLSServerName,
+		InsecureSkipVerify: *fromTLSInsecure,
+	}
+}
+
+// 写入目标redis的参数,redis返回的错误打印到标准输出
+func toLoadArg(toRedisAddr, userName, userPass string) load.LoadArg {
+	return load.LoadArg{
+		Addr:           strings.Split(toRedisAddr, ","),
+		Username:       userName,
+		Password:       userPass,
+		LoadParallel:   *loadParallel,
+		Speed:          *loadSpeed,
+		MaxRetryPerCmd: *loadRetry,
+		PipeLineCmdLen: *loadPipeline,
+		Logger:         log_interface.NewLogStdout(),
+		Cluster:        *toRedisCluster,
+		ClusterSkipDB:  *toClusterSkipDB,
+		TLS:            toTLSArg(),
+		Restore:        *restoreLoad,
+	}
+}
+
+// 目标redis的tls参数
+func toTLSArg() tls_config.TLSArg {
+	return tls_config.TLSArg{
+		Enable:             *toTLS,
+		CAFile:             *toTLSCA,
+		CertFile:           *toTLSCert,
+		KeyFile:            *toTLSKey,
+		ServerName:         *toTLSServerName,
+		InsecureSkipVerify: *toTLSInsecure,
+	}
+}
+
+// 写rdb的参数
+func rdbWriterArg() writer.WriterArg {
+	return writer.WriterArg{
+		Version:  *rdbVersion,
+		Compress: *rdbCompress,
+	}
+}
+
+// 重写aof的参数
+func aofRewriteArg() aof.RewriteArg {
+	return aof.RewriteArg{
+		ItemsPerCmd:  *aofItemsPerCmd,
+		NoStreamMeta: *aofNoStreamMeta,
 	}
 }
@@ -19,33 +19,62 @@ func (r *RDBDumper) InitConnection() (int64, error) {
 	if err := r.openConn(); err != nil {
 		return 0, err
 	}
+	if err := r.sendReplConf(); err != nil {
+		return 0, err
+	}
 	if err := r.sendPSync(); err != nil {
 		return 0, err
 	}
+	rsp, err := r.readSyncResponse()
+	if err != nil {
+		return 0, err
+	}
+	if err = r.parsePSyncResponse(rsp); err != nil {
+		return 0, err
+	}
+	if r.partialSync { // 部分同步没有rdb
+		return 0, nil
+	}
+	if rsp, err = r.readSyncResponse(); err != nil {
+		return 0, err
+	}
+	if rsp[0] != '$' {
+		return 0, errors.Errorf("invalid sync response, rsp = '%s'", rsp)
+	}
+	if strings.HasPrefix(rsp, eofMarkPrefix) { // 无盘复制:$EOF:<40字节的mark>,rdb以mark结尾
+		mark := RemoveRESPEnd(rsp[len(eofMarkPrefix):])
+		if len(mark) != eofMarkLen {
+			return 0, errors.Errorf("invalid sync eof mark, rsp = '%s'", rsp)
+		}
+		r.eofMark = []byte(mark)
+		r.rdbSize = UnknownRDBSize
+		return UnknownRDBSize, nil
+	}
+	n, err := strconv.ParseInt(rsp[1:len(rsp)-2], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.Wrap(err, fmt.Sprintf("invalid sync response = '%s', n = %d", rsp, n))
+	}
+	r.rdbSize = n
+	return n, nil
+}
+
+// 读取同步的响应,跳过master生成rdb期间发送的\n
+func (r *RDBDumper) readSyncResponse() (string, error) {
 	var rsp string
 	for {
 		b := []byte{0}
 		r.conn.SetDeadline(time.Now().Add(time.Duration(r.readTimeout) * time.Second))
 		if _, err := r.conn.Read(b); err != nil {
-			return 0, errors.Wrap(err, "read sync response = "+rsp)
+			return "", errors.Wrap(err, "read sync response = "+rsp)
 		}
 		if len(rsp) == 0 && b[0] == '\n' {
 			continue
 		}
 		rsp += string(b)
 		if strings.HasSuffix(rsp, "\r\n") {
-			break
+			return rsp, nil
 		}
 	}
-	if rsp[0] != '$' {
-		return 0, errors.Errorf("invalid sync response, rsp = '%s'", rsp)
-	}
-	n, err := strconv.ParseInt(rsp[1:len(rsp)-2], 10, 64)
-	if err != nil || n <= 0 {
-		return 0, errors.Wrap(err, fmt.Sprintf("invalid sync response = '%s', n = %d", rsp, n))
-	}
-	r.rdbSize = n
-	return n, nil
 }
 
 // 发起连接
@@ -53,9 +82,12 @@ func (r *RDBDumper) openConn() error {
 	d := &net.Dialer{
 		KeepAlive: time.Duration(r.keepAliveTimeout) * time.Second,
 	}
-	var err error
-	if r.tlsEnable {
-		r.conn, err = tls.DialWithDialer(d, "tcp", r.addr, &tls.Config{InsecureSkipVerify: false})
+	tlsConf, err := r.tls.Config()
+	if err != nil {
+		return err
+	}
+	if tlsConf != nil {
+		r.conn, err = tls.DialWithDialer(d, "tcp", r.addr, tlsConf)
 	} else {
 		r.conn, err = d.Dial("tcp", r.addr)
 	}
@@ -65,26 +97,58 @@ func (r *RDBDumper) openConn() error {
 
 	return r.auth()
 }
+
+// 认证:设置了用户名时使用acl认证 AUTH <user> <password>
 func (r *RDBDumper) auth() error {
 	if r.password == "" {
 		return nil
 	}
-	if err := r.setConnDeadline(); err != nil {
-		return err
+	args := []interface{}{r.password}
+	if r.user != "" {
+		args = []interface{}{r.user, r.password}
 	}
-	_, err := r.conn.Write(MustEncodeToBytes(NewCommand("AUTH", r.password)))
-	if err != nil {
-		return errors.Wrap(err, "write auth command failed")
+	if _, err := r.sendCommand("AUTH", args...); err != nil {
+		return errors.Wrap(err, "auth failed")
 	}
+	return nil
+}
 
+// 发送命令并读取一行响应,响应为错误时返回错误
+func (r *RDBDumper) sendCommand(name string, args ...interface{}) (string, error) {
+	if err := r.setConnDeadline(); err != nil {
+		return "", err
+	}
+	if _, err := r.conn.Write(MustEncodeToBytes(NewCommand(name, args...))); err != nil {
+		return "", errors.Wrap(err, "write "+name+" command failed")
+	}
 	ret, err := ReadRESPEnd(r.conn)
 	if err != nil {
-		return errors.Wrap(err, "read auth response failed")
+		return "", errors.Wrap(err, "read "+name+" response failed")
 	}
-	if strings.ToUpper(ret) != "+OK\r\n" {
-		return errors.Errorf("auth failed[%v]", RemoveRESPEnd(ret))
+	if err = r.respError(ret); err != nil {
+		return "", err
 	}
-	return nil
+	return RemoveRESPEnd(ret), nil
+}
+
+// 将错误响应转换成错误,NOPERM给出需要的权限
+func (r *RDBDumper) respError(rsp string) error {
+	if len(rsp) == 0 || rsp[0] != byte(typeError) {
+		return nil
+	}
+	rsp = RemoveRESPEnd(rsp[1:])
+	if strings.HasPrefix(rsp, errNoPerm) {
+		return errors.Errorf("user '%s' has no permission(%s), replication user need: ACL SETUSER %s on >password +psync +replconf +ping", r.userName(), rsp, r.userName())
+	}
+	return errors.New(rsp)
+}
+
+// 获取连接的用户名
+func (r *RDBDumper) userName() string {
+	if r.user == "" {
+		return "default"
+	}
+	return r.user
 }
 
 func (r *RDBDumper) setConnDeadline() error {
@@ -6,17 +6,40 @@ package dump
 import (
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qianxiansheng90/go-redis-tool/tls_config"
+)
+
+const (
+	defaultReplId      = "?" // 全量同步
+	defaultReplOffset  = -1
+	defaultReplTimeout = 60 // 增量同步的读超时(秒),master默认每10秒发送一次ping
+
+	UnknownRDBSize = -1      // 无盘复制时rdb的大小未知
+	eofMarkPrefix  = "$EOF:" // 无盘复制的响应前缀
+	eofMarkLen     = 40      // 无盘复制的结束标记长度
+	errNoPerm      = "NOPERM"
 )
 
 type RDBDumper struct {
+	replOffset       int64 // 已经处理的复制offset
 	user             string
 	password         string
 	addr             string
 	conn             net.Conn
-	tlsEnable        bool
+	tls              tls_config.TLSArg
 	keepAliveTimeout int64
 	readTimeout      int
+	replTimeout      int
+	listeningPort    int
 	rdbSize          int64
+	eofMark          []byte      // 无盘复制的结束标记
+	reader           *netReader  // rdb的reader,无盘复制时可能多读了增量命令
+	replId           string      // master的replication id
+	partialSync      bool        // 部分同步:没有rdb,直接是增量命令
+	writeLock        *sync.Mutex // ack和命令响应的写锁
 }
 type DumperArg struct {
 	RedisAddr        string
@@ -25,6 +48,11 @@ type DumperArg struct {
 	ReadTimeout      int
 	KeepAliveTimeout int64
 	TLSEnable        bool
+	TLS              tls_config.TLSArg // tls配置,TLSEnable等同于TLS.Enable
+	ReplId           string            // 部分同步的replication id,为空则全量同步
+	ReplOffset       int64             // 部分同步从这个offset开始,即上次ReplOffset()+1
+	ReplTimeout      int               // 增量同步的读超时(秒),默认60秒
+	ListeningPort    int               // REPLCONF listening-port,默认为本地连接的端口
 }
 
 func NewRDBDumper(arg DumperArg) *RDBDumper {
@@ -34,20 +62,51 @@ func NewRDBDumper(arg DumperArg) *RDBDumper {
 	if arg.KeepAliveTimeout == 0 {
 		arg.KeepAliveTimeout = 5
 	}
+	if arg.TLSEnable {
+		arg.TLS.Enable = true
+	}
+	if arg.ReplTimeout == 0 {
+		arg.ReplTimeout = defaultReplTimeout
+	}
+	if arg.ReplId == "" {
+		arg.ReplId = defaultReplId
+		arg.ReplOffset = defaultReplOffset
+	}
 	return &RDBDumper{
+		replOffset:       arg.ReplOffset,
 		user:             arg.RedisUser,
 		password:         arg.RedisPassword,
 		addr:             arg.RedisAddr,
 		conn:             nil,
-		tlsEnable:        arg.TLSEnable,
+		tls:              arg.TLS,
 		keepAliveTimeout: arg.KeepAliveTimeout,
 		readTimeout:      arg.ReadTimeout,
+		replTimeout:      arg.ReplTimeout,
+		listeningPort:    arg.ListeningPort,
+		replId:           arg.ReplId,
+		writeLock:        &sync.Mutex{},
 	}
 }
 
 // 获取reader
 func (r *RDBDumper) Reader() io.ReadCloser {
-	return newNetReader(r.conn, r.readTimeout, r.rdbSize)
+	r.reader = newNetReader(r.conn, r.readTimeout, r.rdbSize, r.eofMark)
+	return r.reader
+}
+
+// 获取master的replication id
+func (r *RDBDumper) ReplId() string {
+	return r.replId
+}
+
+// 获取已经处理的复制offset
+func (r *RDBDumper) ReplOffset() int64 {
+	return atomic.LoadInt64(&r.replOffset)
+}
+
+// 是否是部分同步:部分同步没有rdb
+func (r *RDBDumper) PartialSync() bool {
+	return r.partialSync
 }
 
 // 发起连接
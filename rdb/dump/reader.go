@@ -1,47 +1,104 @@
 package dump
 
 import (
+	"bytes"
 	"io"
 	"net"
 	"time"
 )
 
+const netReadBufferSize = 32 * 1024 // 无盘复制时每次读取的大小
+
 // netReader结构体
 type netReader struct {
 	conn        net.Conn
 	readTimeout int
 	rdbSize     int64
 	readSize    int64
+	eofMark     []byte // 无盘复制的结束标记,为空则按照rdbSize读取
+	buf         []byte // 已经读取还没有返回的rdb数据
+	rest        []byte // 结束标记之后多读的数据(增量命令)
+	eof         bool   // 已经读取到结束标记
 }
 
 // 新建一个netReader
-func newNetReader(conn net.Conn, readTimeout int, rdbSize int64) io.ReadCloser {
+func newNetReader(conn net.Conn, readTimeout int, rdbSize int64, eofMark []byte) *netReader {
 	return &netReader{
 		conn:        conn,
 		readTimeout: readTimeout,
 		rdbSize:     rdbSize,
+		eofMark:     eofMark,
 	}
 }
 
 // 读取数据
 func (r *netReader) Read(p []byte) (int, error) {
+	if len(r.eofMark) > 0 {
+		return r.readUntilMark(p)
+	}
+	if r.readSize >= r.rdbSize { // rdb已经读取完,之后的数据是增量命令
+		return 0, io.EOF
+	}
 	if err := r.conn.SetDeadline(time.Now().Add(time.Duration(r.readTimeout) * time.Second)); err != nil {
 		return 0, err
 	}
-	var pLen = int64(len(p))
-	var readLen = pLen
-	diff := r.rdbSize - r.readSize
-	if diff < pLen {
+	var readLen = int64(len(p))
+	if diff := r.rdbSize - r.readSize; diff < readLen {
 		readLen = diff
 	}
+	// 网络读取可能少于readLen,只有读取了rdbSize才结束
 	size, err := r.conn.Read(p[:readLen])
 	r.readSize += int64(size)
-	if err == nil && readLen != pLen {
-		err = io.EOF
+	if err == io.EOF && r.readSize < r.rdbSize {
+		err = io.ErrUnexpectedEOF
 	}
 	return size, err
 }
 
+// 无盘复制:读取到结束标记为止,末尾可能是结束标记的数据先不返回
+func (r *netReader) readUntilMark(p []byte) (int, error) {
+	for {
+		if r.eof {
+			if len(r.buf) == 0 {
+				return 0, io.EOF
+			}
+			n := copy(p, r.buf)
+			r.buf = r.buf[n:]
+			return n, nil
+		}
+		if safe := len(r.buf) - len(r.eofMark); safe > 0 {
+			n := copy(p, r.buf[:safe])
+			r.buf = r.buf[n:]
+			return n, nil
+		}
+		if err := r.conn.SetDeadline(time.Now().Add(time.Duration(r.readTimeout) * time.Second)); err != nil {
+			return 0, err
+		}
+		b := make([]byte, netReadBufferSize)
+		size, err := r.conn.Read(b)
+		r.readSize += int64(size)
+		r.buf = append(r.buf, b[:size]...)
+		if i := bytes.Index(r.buf, r.eofMark); i >= 0 {
+			r.rest = append([]byte{}, r.buf[i+len(r.eofMark):]...)
+			r.buf = r.buf[:i]
+			r.readSize -= int64(len(r.eofMark) + len(r.rest))
+			r.eof = true
+			continue
+		}
+		if err == io.EOF { // 没有读取到结束标记
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// 获取rdb之后多读的数据
+func (r *netReader) Rest() []byte {
+	return r.rest
+}
+
 // 关闭
 func (r *netReader) Close() error {
 	if r.conn == nil {
@@ -4,16 +4,64 @@
 package dump
 
 import (
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
 	"github.com/pkg/errors"
 )
 
-// 发送psync
+// 像从库一样发送REPLCONF:监听端口以及支持的能力(无盘复制eof,psync2)
+func (r *RDBDumper) sendReplConf() error {
+	port := r.listeningPort
+	if port == 0 {
+		if addr, ok := r.conn.LocalAddr().(*net.TCPAddr); ok {
+			port = addr.Port
+		}
+	}
+	if _, err := r.sendCommand("REPLCONF", "listening-port", port); err != nil {
+		return errors.Wrap(err, "replconf listening-port")
+	}
+	if _, err := r.sendCommand("REPLCONF", "capa", "eof", "capa", "psync2"); err != nil {
+		return errors.Wrap(err, "replconf capa")
+	}
+	return nil
+}
+
+// 发送psync:replId为?时全量同步
 func (r *RDBDumper) sendPSync() error {
 	if err := r.setConnDeadline(); err != nil {
 		return err
 	}
-	if _, err := r.conn.Write(MustEncodeToBytes(NewCommand("sync"))); err != nil {
-		return errors.Wrap(err, "write sync command failed")
+	if _, err := r.conn.Write(MustEncodeToBytes(NewCommand("psync", r.replId, r.replOffset))); err != nil {
+		return errors.Wrap(err, "write psync command failed")
+	}
+	return nil
+}
+
+// 解析psync的响应:+FULLRESYNC <replid> <offset> 或者 +CONTINUE [replid]
+func (r *RDBDumper) parsePSyncResponse(rsp string) error {
+	if err := r.respError(rsp); err != nil {
+		return errors.Wrap(err, "psync failed")
+	}
+	fields := strings.Fields(RemoveRESPEnd(rsp))
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "invalid psync offset "+fields[2])
+		}
+		r.replId = fields[1]
+		atomic.StoreInt64(&r.replOffset, offset)
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		if len(fields) == 2 { // master的replication id变化了
+			r.replId = fields[1]
+		}
+		r.partialSync = true
+		atomic.StoreInt64(&r.replOffset, r.replOffset-1)
+	default:
+		return errors.Errorf("invalid psync response, rsp = '%s'", RemoveRESPEnd(rsp))
 	}
 	return nil
 }
@@ -0,0 +1,112 @@
+/*
+ *Descript:同步rdb之后的增量命令
+ */
+package dump
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+)
+
+const ackInterval = time.Second // REPLCONF ACK 的间隔
+
+// 同步增量命令:需要在rdb读取完成之后调用.handle处理每个命令,
+// flush在没有待处理的数据时调用,flush成功之后才会ack对应的offset
+func (r *RDBDumper) SyncCommands(ctx context.Context, handle func(cmd []string) error, flush func() error) error {
+	if r.conn == nil {
+		return errors.New("connection not init")
+	}
+	var reader io.Reader = r.conn
+	if r.reader != nil && len(r.reader.Rest()) > 0 { // 无盘复制时读取rdb多读的命令
+		reader = io.MultiReader(bytes.NewReader(r.reader.Rest()), r.conn)
+	}
+	parser, err := aof.NewAofParser(reader)
+	if err != nil {
+		return err
+	}
+	if err = r.sendAck(r.ReplOffset()); err != nil { // 无盘复制时master收到第一个ack之后才会发送增量命令
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go r.ackLoop(stop)
+
+	baseOffset := r.ReplOffset()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("context done")
+		default:
+		}
+		if err := r.conn.SetReadDeadline(time.Now().Add(time.Duration(r.replTimeout) * time.Second)); err != nil {
+			return err
+		}
+		prevOffset := parser.GetLastCommandOffset()
+		cmd, err := parser.GetNextAofCommand()
+		if err != nil {
+			return errors.Wrap(err, "read replication stream")
+		}
+		if len(cmd) > 0 {
+			switch strings.ToLower(cmd[0]) {
+			case "ping": // master的心跳
+			case "replconf":
+				if len(cmd) > 1 && strings.ToLower(cmd[1]) == "getack" {
+					if err = flush(); err != nil {
+						return err
+					}
+					atomic.StoreInt64(&r.replOffset, baseOffset+prevOffset)
+					if err = r.sendAck(r.ReplOffset()); err != nil {
+						return err
+					}
+				}
+			default:
+				if err = handle(cmd); err != nil {
+					return err
+				}
+			}
+		}
+		if parser.Buffered() == 0 { // 没有待处理的数据
+			if err = flush(); err != nil {
+				return err
+			}
+			atomic.StoreInt64(&r.replOffset, baseOffset+parser.GetLastCommandOffset())
+		}
+	}
+}
+
+// 定时发送ack
+func (r *RDBDumper) ackLoop(stop chan struct{}) {
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := r.sendAck(r.ReplOffset()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 发送REPLCONF ACK <offset>
+func (r *RDBDumper) sendAck(offset int64) error {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	if err := r.conn.SetWriteDeadline(time.Now().Add(time.Duration(r.readTimeout) * time.Second)); err != nil {
+		return err
+	}
+	if _, err := r.conn.Write(MustEncodeToBytes(NewCommand("REPLCONF", "ACK", offset))); err != nil {
+		return errors.Wrap(err, "write replconf ack failed")
+	}
+	return nil
+}
@@ -0,0 +1,613 @@
+/*
+ *Descript:aof加载器,将aof中的命令重放到redis中
+ */
+package load
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrAofNestedMulti      = "MULTI calls can not be nested"
+	ErrAofExecWithoutMulti = "EXEC without MULTI"
+	ErrAofSelect           = "invalid SELECT db"
+	unknownDB              = -1
+)
+
+// 只写入一个key(第一个参数)的命令:按照key分配到固定的goroutine,保证同一个key的命令的顺序.
+// 其他命令(多个key,flushdb,eval...)需要等待之前的命令全部写入之后单独执行
+var aofSingleKeyCommands = map[string]bool{
+	"set": true, "setnx": true, "setex": true, "psetex": true, "getset": true, "getex": true, "getdel": true,
+	"append": true, "incr": true, "decr": true, "incrby": true, "decrby": true, "incrbyfloat": true,
+	"setrange": true, "setbit": true, "del": true, "unlink": true, "move": true, "restore": true,
+	"expire": true, "pexpire": true, "expireat": true, "pexpireat": true, "persist": true,
+	"hset": true, "hmset": true, "hsetnx": true, "hdel": true, "hincrby": true, "hincrbyfloat": true,
+	"lpush": true, "rpush": true, "lpushx": true, "rpushx": true, "lpop": true, "rpop": true,
+	"lset": true, "linsert": true, "lrem": true, "ltrim": true,
+	"sadd": true, "srem": true, "spop": true,
+	"zadd": true, "zincrby": true, "zrem": true, "zremrangebyscore": true, "zremrangebyrank": true,
+	"zremrangebylex": true, "zpopmin": true, "zpopmax": true,
+	"xadd": true, "xdel": true, "xtrim": true, "xsetid": true, "xack": true, "xclaim": true, "xautoclaim": true,
+	"pfadd": true, "geoadd": true,
+}
+
+// aof加载参数
+type AofLoadArg struct {
+	Load        LoadArg // 连接,并行,限速,重试,断点等参数
+	StartOffset int64   // 从这个offset(命令的起始位置)开始加载,用于中断之后继续
+	StartDB     uint64  // StartOffset处的db
+}
+
+// aof加载结果
+type AofLoadResult struct {
+	PreambleKeyCount int64  // rdb preamble中加载的key的数量
+	TotalCmd         int64  // 写入的命令数量
+	ErrorCmd         int64  // redis返回错误的命令数量
+	Offset           int64  // 加载结束的offset:aof继续追加之后可以从这里继续加载
+	DB               uint64 // Offset处的db
+}
+
+// aof加载器
+type AofLoader struct {
+	loadArg          LoadArg            // 加载器参数
+	parserArg        parser.ParseArg    // rdb preamble的解析参数
+	aofParser        *aof.AofParser     // aof解析器
+	ctx              context.Context    // 结束并行线程
+	cancel           context.CancelFunc // 取消函数
+	limiter          *rate.Limiter      // 限速器
+	lock             *sync.Mutex        // 错误信息锁
+	err              error              // 错误信息
+	unitChan         []chan aofUnit     // 每个goroutine的命令channel
+	wg               *sync.WaitGroup    // 运行的goroutine
+	checkpoint       *checkpointTracker // 断点
+	db               uint64             // 当前的db
+	multi            *aofUnit           // MULTI之后还没有EXEC的命令
+	startOffset      int64              // 开始加载的offset
+	endOffset        int64              // 加载结束的offset
+	preambleKeyCount int64              // rdb preamble中加载的key的数量
+	totalCmd         int64              // 写入的命令数量
+	errorCmd         int64              // redis返回错误的命令数量
+	loadDone         bool               // 加载完成
+	closed           bool               // 已经关闭
+}
+
+// 发送到加载goroutine的一组命令:一个命令或者一个事务
+type aofUnit struct {
+	cmds   [][]string
+	db     uint64
+	tx     bool          // MULTI/EXEC事务
+	offset int64         // 第一个命令(或者MULTI)的起始offset
+	seq    int64         // 断点编号
+	done   chan struct{} // 屏障:goroutine写入之前的全部命令之后关闭
+}
+
+// 创建一个aof加载器:aof为单个aof文件,开头可以是rdb preamble
+func NewAofLoad(ctx context.Context, aofFile string, arg AofLoadArg, pArg parser.ParseArg) (*AofLoader, error) {
+	loadArg := arg.Load
+	loadArg.noRetry = true
+	if loadArg.PipeLineCmdLen <= 0 {
+		loadArg.PipeLineCmdLen = 10
+	}
+	if loadArg.LoadParallel <= 0 {
+		loadArg.LoadParallel = 1
+	}
+	aofParser, err := aof.NewAofFileParser(aofFile)
+	if err != nil {
+		return nil, err
+	}
+	loaderCtx, loaderCancel := context.WithCancel(ctx)
+	l := AofLoader{
+		loadArg:     loadArg,
+		parserArg:   pArg,
+		aofParser:   aofParser,
+		ctx:         loaderCtx,
+		cancel:      loaderCancel,
+		limiter:     newLimiter(loadArg.Speed),
+		lock:        &sync.Mutex{},
+		wg:          &sync.WaitGroup{},
+		db:          arg.StartDB,
+		startOffset: arg.StartOffset,
+	}
+	if loadArg.Checkpoint != "" {
+		l.checkpoint = newCheckpointTracker(loadArg.Checkpoint, loadArg.CheckpointInterval)
+	}
+	return &l, nil
+}
+
+// 加载:rdb preamble通过RedisLoader加载,之后的命令按照顺序重放
+func (l *AofLoader) Run() error {
+	if err := l.resume(); err != nil {
+		return err
+	}
+	if err := l.loadPreamble(); err != nil {
+		return err
+	}
+	l.startGoroutine()
+	if err := l.replay(); err != nil {
+		return err
+	}
+	l.loadDone = true
+	return nil
+}
+
+// 从断点(或者指定的offset)继续加载:断点之前的命令已经全部写入
+func (l *AofLoader) resume() error {
+	if l.checkpoint != nil && l.loadArg.Resume {
+		cp, err := ReadCheckpoint(l.loadArg.Checkpoint)
+		if err != nil {
+			return err
+		}
+		if cp != nil {
+			l.Log("resume from offset %d db %d", cp.Offset, cp.DB)
+			l.startOffset, l.db = cp.Offset, cp.DB
+			l.checkpoint.resume = *cp
+		}
+	}
+	if l.startOffset <= 0 {
+		return nil
+	}
+	return l.aofParser.ResetFileOffset(l.startOffset)
+}
+
+// 加载rdb preamble
+func (l *AofLoader) loadPreamble() error {
+	if !l.aofParser.HasRDBPreamble() {
+		return nil
+	}
+	arg := l.loadArg
+	arg.Checkpoint, arg.Resume = "", false // 断点只记录preamble之后的命令
+	arg.noRetry = false                    // preamble按照RedisLoader的方式重试
+	loader, err := NewRDBLoad(l.ctx, l.aofParser.RDBPreambleReader(), arg, l.parserArg)
+	if err != nil {
+		return errors.Wrap(err, "load rdb preamble")
+	}
+	err = loader.Run()
+	loader.Close()
+	if err != nil {
+		return errors.Wrap(err, "load rdb preamble")
+	}
+	l.preambleKeyCount = loader.LoadResult().TotalKeyCount
+	l.aofParser.ResumeRESP(loader.Rest(), loader.Offset())
+	l.Log("load rdb preamble keys %d, commands start at offset %d", l.preambleKeyCount, l.aofParser.RESPOffset())
+	return nil
+}
+
+// 开启并行导入goroutine:保存断点时只用一个goroutine按照顺序写入.
+// 并行写入时后面的命令可能先于前面的命令写入,断点之后已经写入的命令继续加载时会重复执行
+func (l *AofLoader) startGoroutine() {
+	parallel := l.loadArg.LoadParallel
+	if l.checkpoint != nil {
+		parallel = 1
+	}
+	l.unitChan = make([]chan aofUnit, parallel)
+	for i := range l.unitChan {
+		l.unitChan[i] = make(chan aofUnit)
+		l.wg.Add(1)
+		go l.loadUnitGoroutine(i, l.unitChan[i])
+	}
+}
+
+// 读取aof中的命令并发送:末尾不完整的命令会忽略,没有EXEC的事务会丢弃(和redis加载aof一致)
+func (l *AofLoader) replay() error {
+	for {
+		if err := l.checkExit(); err != nil {
+			return err
+		}
+		offset := l.aofParser.GetLastCommandOffset()
+		cmd, err := l.aofParser.GetNextAofCommand()
+		if err == io.EOF {
+			break
+		}
+		if errors.Cause(err) == io.ErrUnexpectedEOF {
+			l.Log("ignore truncated command at offset %d", offset)
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("read aof command at offset %d", offset))
+		}
+		if len(cmd) == 0 {
+			continue
+		}
+		if err = waitLimit(l.limiter, l.checkExit); err != nil {
+			return err
+		}
+		if err = l.handleCommand(cmd, offset); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("aof command at offset %d", offset))
+		}
+	}
+	l.endOffset = l.aofParser.GetLastCommandOffset()
+	if l.multi != nil { // aof继续追加之后从MULTI开始加载
+		l.Log("discard MULTI without EXEC at offset %d", l.multi.offset)
+		l.endOffset, l.db = l.multi.offset, l.multi.db
+		l.multi = nil
+	}
+	return l.barrier()
+}
+
+// 处理一个命令:SELECT修改当前db,MULTI和EXEC之间的命令作为一个事务发送
+func (l *AofLoader) handleCommand(cmd []string, offset int64) error {
+	name := strings.ToLower(cmd[0])
+	switch name {
+	case "multi":
+		if l.multi != nil {
+			return errors.New(ErrAofNestedMulti)
+		}
+		l.multi = &aofUnit{db: l.db, tx: true, offset: offset}
+		return nil
+	case "exec":
+		if l.multi == nil {
+			return errors.New(ErrAofExecWithoutMulti)
+		}
+		unit := *l.multi
+		l.multi = nil
+		return l.send(unit)
+	case "discard":
+		l.multi = nil
+		return nil
+	case "select":
+		if len(cmd) != 2 {
+			return errors.New(ErrAofSelect)
+		}
+		db, err := strconv.ParseUint(cmd[1], 10, 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s %s", ErrAofSelect, cmd[1]))
+		}
+		l.db = db
+		if l.multi == nil {
+			return nil
+		}
+	}
+	if l.multi != nil {
+		l.multi.cmds = append(l.multi.cmds, cmd)
+		return nil
+	}
+	return l.send(aofUnit{cmds: [][]string{cmd}, db: l.db, offset: offset})
+}
+
+// 发送:只写入一个key的命令(事务)发送到key对应的goroutine,其他的等待之前的命令全部写入之后再执行
+func (l *AofLoader) send(unit aofUnit) error {
+	if l.loadArg.Cluster && l.loadArg.ClusterSkipDB && unit.db != 0 { // 集群只有0号db
+		return nil
+	}
+	unit.seq = l.checkpoint.add(unit.offset, unit.db, "")
+	idx, ok := l.unitGoroutine(unit)
+	if ok {
+		if err := l.sendUnit(idx, unit); err != nil {
+			return err
+		}
+	} else {
+		if err := l.barrier(); err != nil {
+			return err
+		}
+		unit.done = make(chan struct{})
+		if err := l.sendUnit(0, unit); err != nil {
+			return err
+		}
+		if err := l.wait(unit.done); err != nil {
+			return err
+		}
+	}
+	return l.checkpoint.trySave(l.aofParser.GetLastCommandOffset(), l.db)
+}
+
+// 命令写入的key对应的goroutine:涉及多个key(或者多个goroutine)返回false
+func (l *AofLoader) unitGoroutine(unit aofUnit) (int, bool) {
+	idx := -1
+	for _, cmd := range unit.cmds {
+		name := strings.ToLower(cmd[0])
+		if name == "select" && unit.tx {
+			continue
+		}
+		if !aofSingleKeyCommands[name] || len(cmd) < 2 {
+			return 0, false
+		}
+		if (name == "del" || name == "unlink") && len(cmd) > 2 {
+			return 0, false
+		}
+		h := fnv.New32a()
+		h.Write([]byte(cmd[1]))
+		keyIdx := int(h.Sum32() % uint32(len(l.unitChan)))
+		if idx >= 0 && idx != keyIdx {
+			return 0, false
+		}
+		idx = keyIdx
+	}
+	return idx, idx >= 0
+}
+
+// 发送到指定的goroutine
+func (l *AofLoader) sendUnit(idx int, unit aofUnit) error {
+	for {
+		if err := l.checkExit(); err != nil { // 检查是否应该退出
+			return err
+		}
+		select {
+		case l.unitChan[idx] <- unit: // 发送数据
+			return nil
+		case <-time.After(intervalTime): // 超时
+		}
+	}
+}
+
+// 等待所有goroutine写入之前发送的命令
+func (l *AofLoader) barrier() error {
+	dones := make([]chan struct{}, len(l.unitChan))
+	for i := range l.unitChan {
+		dones[i] = make(chan struct{})
+		if err := l.sendUnit(i, aofUnit{done: dones[i]}); err != nil {
+			return err
+		}
+	}
+	for _, done := range dones {
+		if err := l.wait(done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 等待屏障
+func (l *AofLoader) wait(done chan struct{}) error {
+	for {
+		if err := l.checkExit(); err != nil { // 检查是否应该退出
+			return err
+		}
+		select {
+		case <-done:
+			return nil
+		case <-time.After(intervalTime): // 超时
+		}
+	}
+}
+
+// 并行导入goroutine:一个连接,按照顺序pipeline写入
+func (l *AofLoader) loadUnitGoroutine(idx int, unitChan chan aofUnit) {
+	l.Log("start goroutine %d", idx)
+	defer func() {
+		l.wg.Done()
+		l.Log("%d:goroutine end", idx)
+	}()
+	client, err := getRedisConn(l.ctx, idx, l.loadArg)
+	if err != nil {
+		l.setErr(err)
+		return
+	}
+	defer client.Close()
+	var cmdable redis.Cmdable = client
+	if c, ok := client.(*redis.Client); ok { // select只对当前连接生效
+		conn := c.Conn(l.ctx)
+		defer conn.Close()
+		cmdable = conn
+	}
+	var db int64 = unknownDB // 连接当前的db
+	var units []aofUnit
+	var cmdLen = 0
+	flush := func() bool {
+		if len(units) == 0 {
+			return true
+		}
+		if err := l.loadUnits(idx, cmdable, &db, units); err != nil {
+			l.setErr(err)
+			return false
+		}
+		units, cmdLen = units[:0], 0
+		return true
+	}
+	for {
+		select {
+		case unit, isOpen := <-unitChan:
+			if !isOpen { // channel已经关闭,写入剩余的命令之后退出
+				flush()
+				return
+			}
+			if len(unit.cmds) > 0 {
+				units = append(units, unit)
+				cmdLen += len(unit.cmds)
+			}
+			if unit.done == nil && cmdLen < l.loadArg.PipeLineCmdLen {
+				continue
+			}
+			if !flush() {
+				return
+			}
+			if unit.done != nil {
+				close(unit.done)
+			}
+		case <-time.After(intervalTime): // 没有新的命令则写入
+			if !flush() {
+				return
+			}
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+// 批量写入命令:aof中的命令不是幂等的(INCR,LPUSH...),网络错误时不知道哪些命令已经执行,不重试.
+// 写入成功的命令才确认,断点停在第一个没有确认的命令,由断点继续加载
+func (l *AofLoader) loadUnits(idx int, cmdable redis.Cmdable, db *int64, units []aofUnit) error {
+	if err := l.loadUnitPipeline(cmdable, db, units); err != nil {
+		l.Log("%d:load command error %s", idx, err.Error())
+		return err
+	}
+	return nil
+}
+
+// 批量写入命令:连续的普通命令使用一个pipeline,事务使用MULTI/EXEC,每个pipeline执行成功之后确认
+func (l *AofLoader) loadUnitPipeline(cmdable redis.Cmdable, db *int64, units []aofUnit) error {
+	var pipe redis.Pipeliner
+	var pending []aofUnit // pipe中的命令
+	for _, unit := range units {
+		if unit.tx {
+			if err := l.execPipeline(pipe); err != nil {
+				return err
+			}
+			l.ack(pending)
+			pipe, pending = nil, nil
+			txPipe := cmdable.TxPipeline()
+			l.addUnit(txPipe, db, unit)
+			if err := l.execPipeline(txPipe); err != nil {
+				return err
+			}
+			l.ack([]aofUnit{unit})
+			continue
+		}
+		if pipe == nil {
+			pipe = cmdable.Pipeline()
+		}
+		l.addUnit(pipe, db, unit)
+		pending = append(pending, unit)
+	}
+	if err := l.execPipeline(pipe); err != nil {
+		return err
+	}
+	l.ack(pending)
+	return nil
+}
+
+// 确认写入成功的命令
+func (l *AofLoader) ack(units []aofUnit) {
+	if len(units) == 0 {
+		return
+	}
+	seqs := make([]int64, 0, len(units))
+	for _, unit := range units {
+		seqs = append(seqs, unit.seq)
+	}
+	l.checkpoint.ack(seqs)
+}
+
+// 将命令加入pipeline,db不同时先select.集群只有0号db,忽略select
+func (l *AofLoader) addUnit(pipe redis.Pipeliner, db *int64, unit aofUnit) {
+	if !l.loadArg.Cluster && *db != int64(unit.db) {
+		pipe.Do(l.ctx, "select", unit.db)
+		*db = int64(unit.db)
+	}
+	for _, cmd := range unit.cmds {
+		if strings.ToLower(cmd[0]) == "select" {
+			if l.loadArg.Cluster {
+				continue
+			}
+			*db = unknownDB // 事务中的select,之后重新select
+		}
+		args := make([]interface{}, 0, len(cmd))
+		for _, v := range cmd {
+			args = append(args, v)
+		}
+		pipe.Do(l.ctx, args...)
+	}
+}
+
+// 执行pipeline:redis返回的错误只记录,网络错误返回
+func (l *AofLoader) execPipeline(pipe redis.Pipeliner) error {
+	if pipe == nil {
+		return nil
+	}
+	cmds, _ := pipe.Exec(l.ctx)
+	var total, errCount int64
+	for _, cmd := range cmds {
+		if cmd.Name() == "select" || cmd.Name() == "multi" || cmd.Name() == "exec" {
+			if _, ok := cmd.Err().(redis.Error); cmd.Err() != nil && !ok {
+				return errors.Wrap(cmd.Err(), "command pipeline exec")
+			}
+			continue
+		}
+		total++
+		err := cmd.Err()
+		if err == nil || err == redis.Nil {
+			continue
+		}
+		if _, ok := err.(redis.Error); ok {
+			errCount++
+			if l.loadArg.Logger != nil {
+				l.loadArg.Logger.Warnf("cmd %v error %s", cmd.Args(), err.Error())
+			}
+			continue
+		}
+		return errors.Wrap(err, "command pipeline exec")
+	}
+	atomic.AddInt64(&l.totalCmd, total)
+	atomic.AddInt64(&l.errorCmd, errCount)
+	return nil
+}
+
+// 关闭:等待goroutine写入剩余的命令,保存断点
+func (l *AofLoader) Close() (err error) {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	for _, c := range l.unitChan {
+		close(c)
+	}
+	l.wg.Wait()
+	loadErr := l.getErr()
+	if cpErr := l.checkpoint.finish(l.loadDone && loadErr == nil, l.aofParser.GetLastCommandOffset(), l.db); cpErr != nil {
+		err = cpErr
+	}
+	l.cancel()
+	if cErr := l.aofParser.Close(); err == nil {
+		err = cErr
+	}
+	return
+}
+
+// 获取结果
+func (l *AofLoader) LoadResult() AofLoadResult {
+	return AofLoadResult{
+		PreambleKeyCount: l.preambleKeyCount,
+		TotalCmd:         atomic.LoadInt64(&l.totalCmd),
+		ErrorCmd:         atomic.LoadInt64(&l.errorCmd),
+		Offset:           l.endOffset,
+		DB:               l.db,
+	}
+}
+
+// 检查是否需要退出
+func (l *AofLoader) checkExit() error {
+	if err := l.getErr(); err != nil {
+		return err
+	}
+	select {
+	case <-l.ctx.Done():
+		return errors.New("context done")
+	default:
+		return nil
+	}
+}
+
+func (l *AofLoader) setErr(err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *AofLoader) getErr() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.err
+}
+
+// 打印日志
+func (l *AofLoader) Log(fmtString string, val ...interface{}) {
+	if l.loadArg.Debug == true && l.loadArg.Logger != nil {
+		l.loadArg.Logger.Debugf("[%s] %s", time.Now().Format(TimeFormatMS), fmt.Sprintf(fmtString, val...))
+	}
+}
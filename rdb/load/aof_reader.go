@@ -0,0 +1,60 @@
+/*
+ *Descript:将aof重放之后按照rdb格式输出
+ */
+package load
+
+import (
+	"context"
+	"io"
+
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/writer"
+)
+
+// 在内存中重放aof,返回rdb格式的reader:可以作为解析,加载,info的输入
+func NewAOFRDBReader(ctx context.Context, reader io.Reader, arg aof.ReplayArg) (io.ReadCloser, error) {
+	p, err := aof.NewAofParser(reader)
+	if err != nil {
+		return nil, err
+	}
+	replayer := aof.NewReplayer(arg)
+	if err = replayer.Replay(ctx, p); err != nil {
+		return nil, err
+	}
+	return keyspaceRDBReader(ctx, replayer.Keyspace()), nil
+}
+
+// 在内存中重放多文件aof(redis 7.0+),path为appenddirname目录或者manifest文件
+func NewMultiPartAOFRDBReader(ctx context.Context, path string, arg aof.ReplayArg) (io.ReadCloser, error) {
+	m, err := aof.NewMultiPartAof(path)
+	if err != nil {
+		return nil, err
+	}
+	replayer := aof.NewReplayer(arg)
+	if err = replayer.ReplayMultiPart(ctx, m, parser.ParseArg{}); err != nil {
+		return nil, err
+	}
+	return keyspaceRDBReader(ctx, replayer.Keyspace()), nil
+}
+
+// 将keyspace写成rdb格式的输出流
+func keyspaceRDBReader(ctx context.Context, keyspace *aof.Keyspace) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeKeyspaceRDB(ctx, keyspace, pw))
+	}()
+	return pr
+}
+
+// 将keyspace写成rdb
+func writeKeyspaceRDB(ctx context.Context, keyspace *aof.Keyspace, w io.Writer) error {
+	rw, err := writer.NewRDBWriter(w, writer.WriterArg{Version: parser.VersionMax})
+	if err != nil {
+		return err
+	}
+	if err = keyspace.Export(ctx, rw.Handler); err != nil {
+		return err
+	}
+	return rw.Close()
+}
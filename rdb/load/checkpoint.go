@@ -0,0 +1,252 @@
+/*
+ *Descript:加载的断点,用于中断之后继续加载
+ */
+package load
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultCheckpointInterval = 10   // 默认保存断点的间隔(秒)
+	fingerprintLen            = 4096 // 计算rdb指纹的开头字节数:包括header和aux(ctime...)
+	unknownSize               = -1   // 不知道rdb的大小(例如从redis同步)
+
+	ErrCheckpointMismatch = "checkpoint belongs to another rdb"
+)
+
+// 断点
+type Checkpoint struct {
+	Offset     int64  `json:"offset"`               // 从这个offset(key的起始位置)继续加载
+	DB         uint64 `json:"db"`                   // offset处的db
+	Key        string `json:"key"`                  // offset处的key,可能已经写入了一部分
+	LastKey    string `json:"last_key"`             // 最后一个确认写入的key
+	KeyCount   int64  `json:"key_count"`            // 已经确认写入的object数量
+	RDBSize    int64  `json:"rdb_size,omitempty"`   // rdb的大小,-1为未知
+	RDBHeader  string `json:"rdb_header,omitempty"` // rdb开头fingerprintLen字节的hash
+	UpdateTime string `json:"update_time"`          // 保存时间
+}
+
+// rdb的指纹:大小以及开头的hash,继续加载时需要和断点一致
+type rdbFingerprint struct {
+	size   int64
+	header string
+}
+
+// 计算rdb的指纹:可以seek(文件)时读取开头之后seek回去,返回原来的reader,继续加载时可以直接seek到断点;
+// 否则返回的reader包含已经读取的开头部分
+func newRDBFingerprint(reader io.Reader) (io.Reader, rdbFingerprint) {
+	fp := rdbFingerprint{size: unknownSize}
+	if f, ok := reader.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			fp.size = info.Size()
+		}
+	}
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		if head, ok := readHead(seeker); ok {
+			fp.header = hashHeader(head)
+			return reader, fp
+		}
+	}
+	br := bufio.NewReaderSize(reader, fingerprintLen)
+	head, _ := br.Peek(fingerprintLen) // rdb小于fingerprintLen时为全部
+	fp.header = hashHeader(head)
+	return br, fp
+}
+
+// 读取开头fingerprintLen字节之后seek回原来的位置,不能seek(例如管道)时返回false
+func readHead(seeker io.ReadSeeker) ([]byte, bool) {
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false
+	}
+	head := make([]byte, fingerprintLen)
+	n, err := io.ReadFull(seeker, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false
+	}
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, false
+	}
+	return head[:n], true
+}
+
+// 开头的hash:不使用crc64,包括末尾checksum的整个rdb的crc64总是0
+func hashHeader(head []byte) string {
+	h := fnv.New64a()
+	h.Write(head)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// 检查断点是否属于这个rdb
+func (cp Checkpoint) checkRDB(fp rdbFingerprint) error {
+	sizeMismatch := cp.RDBSize != unknownSize && fp.size != unknownSize && cp.RDBSize != fp.size
+	if cp.RDBHeader != fp.header || sizeMismatch {
+		return errors.New(fmt.Sprintf("%s: checkpoint size %d header %s, rdb size %d header %s",
+			ErrCheckpointMismatch, cp.RDBSize, cp.RDBHeader, fp.size, fp.header))
+	}
+	return nil
+}
+
+// 等待确认的object
+type pendingObject struct {
+	seq    int64
+	offset int64
+	db     uint64
+	key    string
+}
+
+// 断点跟踪:object按照发送的顺序编号,所有goroutine确认写入之后断点才能前进
+type checkpointTracker struct {
+	lock     *sync.Mutex
+	file     string
+	interval time.Duration
+	lastSave time.Time
+	seq      int64
+	pending  []pendingObject // 按照seq排序
+	acked    map[int64]bool
+	lastKey  string
+	keyCount int64
+	rdb      rdbFingerprint // 正在加载的rdb
+	resume   Checkpoint     // 继续加载时之前的断点
+}
+
+func newCheckpointTracker(file string, interval int) *checkpointTracker {
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	return &checkpointTracker{
+		lock:     &sync.Mutex{},
+		file:     file,
+		interval: time.Duration(interval) * time.Second,
+		lastSave: time.Now(),
+		acked:    map[int64]bool{},
+	}
+}
+
+// 读取断点文件,文件不存在返回nil
+func ReadCheckpoint(file string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read checkpoint "+file)
+	}
+	var cp Checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return nil, errors.Wrap(err, "parse checkpoint "+file)
+	}
+	return &cp, nil
+}
+
+// 记录一个发送的object,返回编号
+func (c *checkpointTracker) add(offset int64, db uint64, key string) int64 {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seq++
+	c.pending = append(c.pending, pendingObject{seq: c.seq, offset: offset, db: db, key: key})
+	c.advance()
+	return c.seq
+}
+
+// 确认写入
+func (c *checkpointTracker) ack(seqs []int64) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, seq := range seqs {
+		c.acked[seq] = true
+	}
+}
+
+// 移除前面已经确认写入的object
+func (c *checkpointTracker) advance() {
+	i := 0
+	for ; i < len(c.pending) && c.acked[c.pending[i].seq]; i++ {
+		delete(c.acked, c.pending[i].seq)
+		c.lastKey = c.pending[i].key
+		c.keyCount++
+	}
+	c.pending = c.pending[i:]
+}
+
+// 当前的断点:第一个没有确认写入的object所在key的起始位置
+func (c *checkpointTracker) checkpoint(offset int64, db uint64) Checkpoint {
+	c.advance()
+	cp := Checkpoint{
+		Offset:     offset,
+		DB:         db,
+		LastKey:    c.lastKey,
+		KeyCount:   c.resume.KeyCount + c.keyCount,
+		RDBSize:    c.rdb.size,
+		RDBHeader:  c.rdb.header,
+		UpdateTime: time.Now().Format(TimeFormat),
+	}
+	if len(c.pending) > 0 {
+		cp.Offset, cp.DB, cp.Key = c.pending[0].offset, c.pending[0].db, c.pending[0].key
+	}
+	if cp.LastKey == "" {
+		cp.LastKey = c.resume.LastKey
+	}
+	return cp
+}
+
+// 到达间隔时间则保存断点,offset/db为没有等待确认的object时的断点
+func (c *checkpointTracker) trySave(offset int64, db uint64) error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if time.Now().Sub(c.lastSave) < c.interval {
+		return nil
+	}
+	return c.save(offset, db)
+}
+
+// 保存断点:先写临时文件再rename,避免断点文件损坏
+func (c *checkpointTracker) save(offset int64, db uint64) error {
+	c.lastSave = time.Now()
+	data, err := json.Marshal(c.checkpoint(offset, db))
+	if err != nil {
+		return err
+	}
+	tmpFile := c.file + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return errors.Wrap(err, "write checkpoint "+tmpFile)
+	}
+	return os.Rename(tmpFile, c.file)
+}
+
+// 加载结束:成功则删除断点文件,否则保存断点
+func (c *checkpointTracker) finish(success bool, offset int64, db uint64) error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if success {
+		if err := os.Remove(c.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return c.save(offset, db)
+}
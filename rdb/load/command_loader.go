@@ -0,0 +1,118 @@
+/*
+ *Descript:命令加载器,将命令按顺序写入到redis中
+ */
+package load
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// 命令加载器:使用一个连接按顺序pipeline写入,保证命令的顺序和select生效
+type CommandLoader struct {
+	ctx        context.Context
+	loadArg    LoadArg
+	client     redis.UniversalClient // redis连接
+	cmdable    redis.Cmdable         // 单机为固定的连接,集群为集群连接
+	pipe       redis.Pipeliner       // 当前的pipeline
+	pipeCmdLen int                   // 当前pipeline中的命令数量
+	totalCmd   int64                 // 写入的命令数量
+	errorCmd   int64                 // redis返回错误的命令数量
+	db         string                // 当前的db(最后一个select)
+}
+
+// 创建一个命令加载器
+func NewCommandLoader(ctx context.Context, arg LoadArg) (*CommandLoader, error) {
+	if arg.PipeLineCmdLen <= 0 {
+		arg.PipeLineCmdLen = 10
+	}
+	client, err := getRedisConn(ctx, 0, arg)
+	if err != nil {
+		return nil, err
+	}
+	l := CommandLoader{
+		ctx:     ctx,
+		loadArg: arg,
+		client:  client,
+		cmdable: client,
+	}
+	if c, ok := client.(*redis.Client); ok { // select只对当前连接生效
+		l.cmdable = c.Conn(ctx)
+	}
+	return &l, nil
+}
+
+// 写入一个命令,达到pipeline长度则执行
+func (l *CommandLoader) Load(cmd []string) error {
+	if len(cmd) == 0 {
+		return nil
+	}
+	if l.loadArg.Cluster && strings.ToLower(cmd[0]) == "select" { // 集群只有0号db
+		if len(cmd) > 1 {
+			l.db = cmd[1]
+		}
+		return nil
+	}
+	if l.loadArg.Cluster && l.loadArg.ClusterSkipDB && l.db != "" && l.db != "0" { // 跳过非0号db的命令
+		return nil
+	}
+	if l.pipe == nil {
+		l.pipe = l.cmdable.Pipeline()
+	}
+	args := make([]interface{}, 0, len(cmd))
+	for _, v := range cmd {
+		args = append(args, v)
+	}
+	l.pipe.Do(l.ctx, args...)
+	l.pipeCmdLen++
+	if l.pipeCmdLen >= l.loadArg.PipeLineCmdLen {
+		return l.Flush()
+	}
+	return nil
+}
+
+// 执行pipeline中的命令:redis返回的错误只记录,网络错误返回
+func (l *CommandLoader) Flush() error {
+	if l.pipe == nil || l.pipeCmdLen == 0 {
+		return nil
+	}
+	pipe := l.pipe
+	l.pipe, l.pipeCmdLen = nil, 0
+	cmds, _ := pipe.Exec(l.ctx)
+	for _, cmd := range cmds {
+		l.totalCmd++
+		err := cmd.Err()
+		if err == nil || err == redis.Nil {
+			continue
+		}
+		if _, ok := err.(redis.Error); ok {
+			l.errorCmd++
+			if l.loadArg.Logger != nil {
+				l.loadArg.Logger.Warnf("cmd %v error %s", cmd.Args(), err.Error())
+			}
+			continue
+		}
+		return errors.Wrap(err, "command pipeline exec")
+	}
+	return nil
+}
+
+// 获取结果:写入的命令数量,redis返回错误的命令数量
+func (l *CommandLoader) Result() (int64, int64) {
+	return l.totalCmd, l.errorCmd
+}
+
+// 关闭
+func (l *CommandLoader) Close() error {
+	err := l.Flush()
+	if c, ok := l.cmdable.(*redis.Conn); ok {
+		c.Close()
+	}
+	if cErr := l.client.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
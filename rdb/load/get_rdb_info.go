@@ -7,6 +7,7 @@ import (
 	"context"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -16,6 +17,10 @@ import (
 const (
 	bigKeyValueSize = 1024 * 1024
 	ErrCloseProcess = "close process"
+
+	BigKeyOrderMemory = "memory" // 按照估算的内存降序
+	BigKeyOrderSize   = "size"   // 按照value的大小降序
+	BigKeyOrderLen    = "len"    // 按照元素数量降序
 )
 
 // rdb信息输出
@@ -26,13 +31,16 @@ type RDBInfo struct {
 	RedisCTime      int64                               `json:"c_time"`
 	RedisUsedMemory int64                               `json:"used_memory"`
 	KeyStatistics   map[int]map[string]BigKeyStatistics `json:"key_statistics"`
+	// 每个db每种类型的key在rdb中的编码数量:db:类型:编码:数量
+	EncodingStatistics map[int]map[string]map[string]int64 `json:"encoding_statistics"`
 }
 
 // 大key统计
 type BigKeyStatistics struct {
-	KeyTotalCount int64     `json:"big_key_count"`
-	KeyTotalSize  uint64    `json:"big_key_total_size"`
-	KeyList       []KeyInfo `json:"big_key_list"`
+	KeyTotalCount  int64     `json:"big_key_count"`
+	KeyTotalSize   uint64    `json:"big_key_total_size"`
+	KeyTotalMemory uint64    `json:"big_key_total_memory"`
+	KeyList        []KeyInfo `json:"big_key_list"`
 }
 
 type KeyInfo struct {
@@ -40,20 +48,27 @@ type KeyInfo struct {
 	KeyType           string `json:"key_type"`
 	ValueTotalSize    uint64 `json:"value_total_size"`
 	ValueTotalItemLen uint64 `json:"value_total_item_len"`
+	MemoryUsage       uint64 `json:"memory_usage"`
 }
 
 // 参数
 type GetRDBInfoArg struct {
-	OnlyRDBInfo   bool      `json:"only_rdb_info"`  // 只统计rdb信息
-	KeyStatistics bool      `json:"key_statistics"` // 统计key信息
-	BigKey        bool      `json:"big_key"`        // 大key输出
-	BigKeyArg     BigKeyArg `json:"big_key_arg"`    // 大key的输出条件
+	OnlyRDBInfo        bool              `json:"only_rdb_info"`        // 只统计rdb信息
+	KeyStatistics      bool              `json:"key_statistics"`       // 统计key信息
+	BigKey             bool              `json:"big_key"`              // 大key输出
+	BigKeyArg          BigKeyArg         `json:"big_key_arg"`          // 大key的输出条件
+	Filter             *parser.KeyFilter `json:"-"`                    // 只统计满足条件的key
+	CheckSum           bool              `json:"check_sum"`            // 校验rdb的crc64,需要解析到文件末尾
+	ExpiredPolicy      string            `json:"expired_policy"`       // 已经过期的key的处理方式:parser.ExpiredPolicy*
+	MemoryRedisVersion int               `json:"memory_redis_version"` // 估算内存时目标redis的主版本号,0表示和生成rdb的redis一致
 }
 
 // 参数:大key定义
 type BigKeyArg struct {
 	ValueSize uint64            `json:"value_size"` // 默认为1024字节
 	TypeVal   map[string]BigKey `json:"type_value"` // key类型:{}
+	OrderBy   string            `json:"order_by"`   // 大key的排序:BigKeyOrder*,为空则按照解析的顺序
+	Top       int               `json:"top"`        // 每种类型只保留前Top个大key,0为全部
 }
 
 // 结构体
@@ -61,16 +76,21 @@ type rdbInfo struct {
 	reader        io.ReadCloser // 输入流
 	info          *RDBInfo      // 返回结果
 	OnlyRDBInfo   bool          // 只统计rdb信息
+	checkSum      bool          // 校验crc64:不能提前结束
 	KeyStatistics bool          // 统计key信息
 	BigKey        bool          // 大key输出
 	ValueSize     uint64        // 默认为1024字节
 	bigKey        map[string]BigKey
+	orderBy       string
+	top           int
+	db            int // 当前的db
 }
 
 // 大key定义
 type BigKey struct {
 	ValueSize uint64 `json:"value_size"`
 	MemberLen uint64 `json:"member_len"`
+	Memory    uint64 `json:"memory"` // 估算的内存超过该值,0为不检查
 }
 
 // 从文件中获取rdb信息
@@ -89,16 +109,24 @@ func GetRDBInfo(ctx context.Context, reader io.ReadCloser, arg GetRDBInfoArg) (*
 		reader:        reader,
 		info:          &RDBInfo{},
 		OnlyRDBInfo:   arg.OnlyRDBInfo,
+		checkSum:      arg.CheckSum,
 		KeyStatistics: arg.KeyStatistics,
 		BigKey:        arg.BigKey,
 		ValueSize:     arg.BigKeyArg.ValueSize,
 		bigKey:        map[string]BigKey{},
+		orderBy:       arg.BigKeyArg.OrderBy,
+		top:           arg.BigKeyArg.Top,
 	}
 	var err error
 	r.init(arg)
 
 	r.info.RDBVersion, err = ParseRDBHandler(ctx, reader, r.handler, parser.ParseArg{
-		ExtInfo: true,
+		ExtInfo:            true,
+		Filter:             arg.Filter,
+		MergeQuickList:     true,
+		CheckSum:           arg.CheckSum,
+		ExpiredPolicy:      arg.ExpiredPolicy,
+		MemoryRedisVersion: arg.MemoryRedisVersion,
 	})
 	if err != nil {
 		if err.Error() == ErrCloseProcess {
@@ -106,6 +134,7 @@ func GetRDBInfo(ctx context.Context, reader io.ReadCloser, arg GetRDBInfoArg) (*
 		}
 		return r.info, err
 	}
+	r.sortBigKey()
 	return r.info, nil
 }
 
@@ -115,6 +144,7 @@ func (r *rdbInfo) init(arg GetRDBInfoArg) {
 		r.ValueSize = bigKeyValueSize
 	}
 	r.info.KeyStatistics = make(map[int]map[string]BigKeyStatistics)
+	r.info.EncodingStatistics = make(map[int]map[string]map[string]int64)
 	var bigkey = make(map[string]BigKey)
 	if arg.BigKeyArg.TypeVal == nil {
 		arg.BigKeyArg.TypeVal = make(map[string]BigKey)
@@ -125,6 +155,7 @@ func (r *rdbInfo) init(arg GetRDBInfoArg) {
 			bigkey[kType] = BigKey{
 				ValueSize: r.ValueSize,
 				MemberLen: 0,
+				Memory:    0,
 			}
 			continue
 		}
@@ -134,6 +165,7 @@ func (r *rdbInfo) init(arg GetRDBInfoArg) {
 		bigkey[kType] = BigKey{
 			ValueSize: val.ValueSize,
 			MemberLen: val.MemberLen,
+			Memory:    val.Memory,
 		}
 	}
 	r.bigKey = bigkey
@@ -151,22 +183,17 @@ func arrayIndex(array []string, item string) int {
 
 // 处理key
 func (r *rdbInfo) handler(ctx context.Context, object parser.TypeObject) error {
-	var dbNumber int = 0
 	switch object.Type() {
 	case parser.StringObject{}.Type(), parser.ListObject{}.Type(), parser.HashMap{}.Type(), parser.RedisStream{}.Type(), parser.Set{}.Type(),
-		parser.SortedSet{}.Type():
-		if r.BigKey == true {
-			r.checkBigKey(dbNumber, object.Type(), object.Key(), object.ValueLen(), object.ConcreteSize())
-			return nil
-		}
-		r.getKeySize(dbNumber, object.Type(), object.ConcreteSize())
+		parser.SortedSet{}.Type(), parser.ModuleObject{}.Type():
+		r.statKey(object.Type(), object.Key(), object.Encoding(), object.ValueLen(), object.ConcreteSize(), object.MemoryUsage())
 	case parser.SelectionDB{}.Type():
 		_, val, _ := object.Command()
 		dbNum, ok := val[0].(uint64)
 		if ok == false {
 			return errors.New("internal error dbsize value")
 		}
-		dbNumber = int(dbNum)
+		r.db = int(dbNum)
 
 	case parser.AuxField{}.Type():
 		return r.getDBInfo(object)
@@ -175,6 +202,31 @@ func (r *rdbInfo) handler(ctx context.Context, object parser.TypeObject) error {
 	return nil
 }
 
+// 统计一个key
+func (r *rdbInfo) statKey(keyType, keyName, encoding string, valLen, valSize, memory uint64) {
+	r.countEncoding(r.db, keyType, encoding)
+	if r.BigKey == true {
+		r.checkBigKey(r.db, keyType, keyName, valLen, valSize, memory)
+		return
+	}
+	r.getKeySize(r.db, keyType, valSize, memory)
+}
+
+// 统计编码
+func (r *rdbInfo) countEncoding(dbNumber int, keyType, encoding string) {
+	mapEncoding, exist := r.info.EncodingStatistics[dbNumber]
+	if exist == false {
+		mapEncoding = map[string]map[string]int64{}
+		r.info.EncodingStatistics[dbNumber] = mapEncoding
+	}
+	count, exist := mapEncoding[keyType]
+	if exist == false {
+		count = map[string]int64{}
+		mapEncoding[keyType] = count
+	}
+	count[encoding]++
+}
+
 // 获取db大小
 func (r *rdbInfo) getDBInfo(object parser.TypeObject) error {
 	var err error
@@ -194,7 +246,7 @@ func (r *rdbInfo) getDBInfo(object parser.TypeObject) error {
 			return err
 		}
 	}
-	if r.OnlyRDBInfo == true && r.info.RedisVersion != "" && r.info.RedisBits != 0 &&
+	if r.OnlyRDBInfo == true && !r.checkSum && r.info.RedisVersion != "" && r.info.RedisBits != 0 &&
 		r.info.RedisCTime != 0 && r.info.RedisUsedMemory != 0 {
 		return errors.New(ErrCloseProcess)
 	}
@@ -202,7 +254,7 @@ func (r *rdbInfo) getDBInfo(object parser.TypeObject) error {
 }
 
 // 获取key统计
-func (r *rdbInfo) getKeySize(dbNumber int, keyType string, valSize uint64) {
+func (r *rdbInfo) getKeySize(dbNumber int, keyType string, valSize, memory uint64) {
 	if r.KeyStatistics == false {
 		return
 	}
@@ -216,12 +268,13 @@ func (r *rdbInfo) getKeySize(dbNumber int, keyType string, valSize uint64) {
 	}
 	keyStatistics.KeyTotalCount++
 	keyStatistics.KeyTotalSize += valSize
+	keyStatistics.KeyTotalMemory += memory
 	mapKeyStatistics[keyType] = keyStatistics
 	r.info.KeyStatistics[dbNumber] = mapKeyStatistics
 }
 
 // 检查大key
-func (r *rdbInfo) checkBigKey(dbNumber int, keyType, keyName string, valLen, valSize uint64) {
+func (r *rdbInfo) checkBigKey(dbNumber int, keyType, keyName string, valLen, valSize, memory uint64) {
 	if r.BigKey == false {
 		return
 	}
@@ -234,16 +287,40 @@ func (r *rdbInfo) checkBigKey(dbNumber int, keyType, keyName string, valLen, val
 		keyStatistics = BigKeyStatistics{}
 	}
 	big, exist := r.bigKey[keyType]
-	if exist == true && (big.ValueSize > 0 && valSize > big.ValueSize) || (big.MemberLen > 0 && valLen >= big.MemberLen) {
+	if exist == true && (big.ValueSize > 0 && valSize > big.ValueSize) || (big.MemberLen > 0 && valLen >= big.MemberLen) ||
+		(big.Memory > 0 && memory > big.Memory) {
 		keyStatistics.KeyTotalCount++
 		keyStatistics.KeyTotalSize += valSize
+		keyStatistics.KeyTotalMemory += memory
 		keyStatistics.KeyList = append(keyStatistics.KeyList, KeyInfo{
 			KeyName:           keyName,
 			KeyType:           keyType,
 			ValueTotalSize:    valSize,
 			ValueTotalItemLen: valLen,
+			MemoryUsage:       memory,
 		})
 		mapKeyStatistics[keyType] = keyStatistics
 		r.info.KeyStatistics[dbNumber] = mapKeyStatistics
 	}
 }
+
+// 大key排序,每种类型只保留前top个
+func (r *rdbInfo) sortBigKey() {
+	for _, mapKeyStatistics := range r.info.KeyStatistics {
+		for keyType, keyStatistics := range mapKeyStatistics {
+			list := keyStatistics.KeyList
+			switch r.orderBy {
+			case BigKeyOrderMemory:
+				sort.SliceStable(list, func(i, j int) bool { return list[i].MemoryUsage > list[j].MemoryUsage })
+			case BigKeyOrderSize:
+				sort.SliceStable(list, func(i, j int) bool { return list[i].ValueTotalSize > list[j].ValueTotalSize })
+			case BigKeyOrderLen:
+				sort.SliceStable(list, func(i, j int) bool { return list[i].ValueTotalItemLen > list[j].ValueTotalItemLen })
+			}
+			if r.top > 0 && len(list) > r.top {
+				keyStatistics.KeyList = list[:r.top]
+				mapKeyStatistics[keyType] = keyStatistics
+			}
+		}
+	}
+}
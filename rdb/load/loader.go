@@ -5,6 +5,7 @@ package load
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"sync"
 	"time"
@@ -14,45 +15,64 @@ import (
 
 	"github.com/qianxiansheng90/go-redis-tool/log_interface"
 	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+	"github.com/qianxiansheng90/go-redis-tool/tls_config"
 )
 
 // 解析参数结构体
 type LoadArg struct {
-	Addr             []string             // redis地址
-	Username         string               // redis的连接用户
-	Password         string               // redis连接密码
-	DB               int                  // 连接redis的db
-	DialTimeout      int                  // 超时时间(ms)
-	ReadTimeout      int                  // 读超时时间(ms)
-	WriteTimeout     int                  // 写超时时间(ms)
-	LoadParallel     int                  // 导入到redis中的并行线程数
-	Speed            int                  // 限速
-	NoExpTime        bool                 // 忽略过期时间
-	ExpTimeShiftMS   int                  // 过期时间偏移多少ms:正数是向前,负数向后
-	SaveStreamDelVal bool                 // 保留stream中删除的val
-	MaxRetryPerCmd   int                  // 每个命令最多重试多少次
-	PipeLineCmdLen   int                  // 每个批次多少个命令
-	Debug            bool                 // debug 模式
-	Logger           log_interface.Logger // 打印日志
-	DelMode          bool                 // 删除模式
+	Addr               []string             // redis地址
+	Username           string               // redis的连接用户
+	Password           string               // redis连接密码
+	DB                 int                  // 连接redis的db
+	DialTimeout        int                  // 超时时间(ms)
+	ReadTimeout        int                  // 读超时时间(ms)
+	WriteTimeout       int                  // 写超时时间(ms)
+	LoadParallel       int                  // 导入到redis中的并行线程数
+	Speed              int                  // 限速
+	NoExpTime          bool                 // 忽略过期时间
+	ExpTimeShiftMS     int                  // 过期时间偏移多少ms:正数是向前,负数向后
+	SaveStreamDelVal   bool                 // 保留stream中删除的val
+	MaxRetryPerCmd     int                  // 每个命令最多重试多少次
+	PipeLineCmdLen     int                  // 每个批次多少个命令
+	Debug              bool                 // debug 模式
+	Logger             log_interface.Logger // 打印日志
+	DelMode            bool                 // 删除模式
+	KeepLRU            bool                 // 有lru idle/lfu freq的key通过RESTORE IDLETIME|FREQ写入,保留lru/lfu
+	Cluster            bool                 // 目标是redis cluster:按照slot路由,自动处理MOVED/ASK
+	ClusterSkipDB      bool                 // 集群模式下跳过非0号db的key(命令),默认全部写入0号db
+	Checkpoint         string               // 断点文件,为空则不保存断点
+	CheckpointInterval int                  // 保存断点的间隔(秒),默认10秒
+	Resume             bool                 // 从断点文件继续加载(需要相同的rdb),每个key写入之前先删除
+	TLS                tls_config.TLSArg    // tls配置
+	Restore            bool                 // 将object编码成DUMP的格式通过RESTORE写入(需要redis5.0以上),保留stream消费组和lru/lfu
+	noRetry            bool                 // 网络错误时go-redis不重发命令(aof中的命令不是幂等的)
 }
 
 // 加载器
 type RedisLoader struct {
-	loadArg          LoadArg                // 加载器参数
-	redisConnPool    []redisConnPool        // redis连接池
-	dataChan         chan parser.TypeObject // 数据channel
-	ctx              context.Context        // 结束并行线程
-	cancel           context.CancelFunc     // 取消函数
-	limiter          *rate.Limiter          // 限速器
-	lock             *sync.RWMutex          // 运行锁
-	runningGoroutine int                    // 当前运行的线程
-	err              error                  // 错误信息
-	parser           *parser.RDBParser      // 解析器
-	parserArg        parser.ParseArg        // 解析器参数
-	totalKeyCount    int64                  // 加载的key的数量
-	maxRetryPerCmd   int                    // 每个命令最多重试多少次
-	pipeLineCmdLen   int                    // 每个批次多少个命令
+	loadArg          LoadArg            // 加载器参数
+	redisConnPool    []redisConnPool    // redis连接池
+	dataChan         chan loadObject    // 数据channel
+	ctx              context.Context    // 结束并行线程
+	cancel           context.CancelFunc // 取消函数
+	limiter          *rate.Limiter      // 限速器
+	lock             *sync.RWMutex      // 运行锁
+	runningGoroutine int                // 当前运行的线程
+	err              error              // 错误信息
+	parser           *parser.RDBParser  // 解析器
+	parserArg        parser.ParseArg    // 解析器参数
+	totalKeyCount    int64              // 加载的key的数量
+	maxRetryPerCmd   int                // 每个命令最多重试多少次
+	pipeLineCmdLen   int                // 每个批次多少个命令
+	checkpoint       *checkpointTracker // 断点
+	parseDone        bool               // 解析完成
+	replaceKey       bool               // 写入之前先删除key:断点之后可能有已经写入的key
+}
+
+// 发送到加载goroutine的object
+type loadObject struct {
+	object parser.TypeObject
+	seq    int64 // 断点编号
 }
 
 // 连接池
@@ -64,12 +84,7 @@ type redisConnPool struct {
 // 创建一个加载器
 func NewRDBLoad(ctx context.Context, reader io.Reader, arg LoadArg, pArg parser.ParseArg) (*RedisLoader, error) {
 	loaderCtx, loaderCancel := context.WithCancel(context.Background())
-	var limiter *rate.Limiter
-	if arg.Speed > 0 {
-		var intervalMicroSecond = 1000000 / arg.Speed
-		var limitTaskPerSecond = rate.Every(time.Duration(intervalMicroSecond) * time.Microsecond)
-		limiter = rate.NewLimiter(limitTaskPerSecond, arg.Speed) // 限速器
-	}
+	limiter := newLimiter(arg.Speed)
 	if arg.MaxRetryPerCmd <= 0 {
 		arg.MaxRetryPerCmd = 3
 	}
@@ -77,7 +92,7 @@ func NewRDBLoad(ctx context.Context, reader io.Reader, arg LoadArg, pArg parser.
 		arg.PipeLineCmdLen = 10
 	}
 	var err error
-	loadDataChan := make(chan parser.TypeObject)
+	loadDataChan := make(chan loadObject)
 	var l = RedisLoader{
 		loadArg:          arg,
 		redisConnPool:    []redisConnPool{},
@@ -93,6 +108,13 @@ func NewRDBLoad(ctx context.Context, reader io.Reader, arg LoadArg, pArg parser.
 		maxRetryPerCmd:   arg.MaxRetryPerCmd,
 		pipeLineCmdLen:   arg.PipeLineCmdLen,
 	}
+	if arg.Checkpoint != "" {
+		l.checkpoint = newCheckpointTracker(arg.Checkpoint, arg.CheckpointInterval)
+		reader, l.checkpoint.rdb = newRDBFingerprint(reader)
+	}
+	if arg.Restore || arg.KeepLRU || arg.Resume { // RESTORE或者先删除再写入需要完整的key
+		pArg.MergeQuickList = true
+	}
 	l.parser, err = parser.NewRDBParse(ctx, reader, l.loadCommand, l.closeLoader, pArg)
 	if err != nil {
 		return &l, err
@@ -101,12 +123,59 @@ func NewRDBLoad(ctx context.Context, reader io.Reader, arg LoadArg, pArg parser.
 	return &l, nil
 }
 
+// 限速器:每秒speed个,0为不限速
+func newLimiter(speed int) *rate.Limiter {
+	if speed <= 0 {
+		return nil
+	}
+	var intervalMicroSecond = 1000000 / speed
+	var limitTaskPerSecond = rate.Every(time.Duration(intervalMicroSecond) * time.Microsecond)
+	return rate.NewLimiter(limitTaskPerSecond, speed)
+}
+
 // 连接redis
 func (l *RedisLoader) Run() (err error) {
+	if err := l.resume(); err != nil {
+		return err
+	}
 	if err := l.getRedisConn(l.ctx, l.dataChan, l.loadArg); err != nil {
 		return err
 	}
-	return l.parser.Parse()
+	if err = l.parser.Parse(); err != nil {
+		return err
+	}
+	l.parseDone = true
+	return nil
+}
+
+// rdb之后剩余的数据:aof的rdb preamble之后为resp命令
+func (l *RedisLoader) Rest() io.Reader {
+	return l.parser.Rest()
+}
+
+// 已经解析的数据长度
+func (l *RedisLoader) Offset() int64 {
+	return l.parser.Offset()
+}
+
+// 从断点继续加载:并行写入时断点之后的key可能已经写入(全部或者一部分),
+// 所以之后的每个key都先删除再写入,保证重复写入的key和rdb一致
+func (l *RedisLoader) resume() error {
+	if l.checkpoint == nil || l.loadArg.Resume == false {
+		return nil
+	}
+	cp, err := ReadCheckpoint(l.loadArg.Checkpoint)
+	if err != nil || cp == nil {
+		return err
+	}
+	if err = cp.checkRDB(l.checkpoint.rdb); err != nil {
+		return err
+	}
+	l.Log("resume from offset %d db %d key %s", cp.Offset, cp.DB, cp.Key)
+	l.replaceKey = true
+	l.checkpoint.resume = *cp
+	l.parser.SetResume(cp.Offset, cp.DB)
+	return nil
 }
 
 // 关闭
@@ -115,7 +184,7 @@ func (l *RedisLoader) Close() error {
 }
 
 // 连接redis
-func (l *RedisLoader) getRedisConn(ctx context.Context, loadDataChan chan parser.TypeObject, arg LoadArg) (err error) {
+func (l *RedisLoader) getRedisConn(ctx context.Context, loadDataChan chan loadObject, arg LoadArg) (err error) {
 	if arg.LoadParallel <= 0 {
 		arg.LoadParallel = 1
 	}
@@ -135,7 +204,23 @@ func (l *RedisLoader) getRedisConn(ctx context.Context, loadDataChan chan parser
 }
 
 // 获取redis连接
-func getRedisConn(ctx context.Context, idx int, arg LoadArg) (*redis.Client, error) {
+func getRedisConn(ctx context.Context, idx int, arg LoadArg) (redis.UniversalClient, error) {
+	var h = hook{
+		logTimeout: arg.Debug,
+		startTime:  time.Time{},
+		logger:     arg.Logger,
+	}
+	tlsConf, err := arg.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	if arg.Cluster {
+		return getRedisClusterConn(ctx, arg, tlsConf, &h)
+	}
+	maxRetries := 0 // go-redis默认重试3次
+	if arg.noRetry {
+		maxRetries = -1
+	}
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:         arg.Addr[idx%len(arg.Addr)],
 		Username:     arg.Username,
@@ -145,21 +230,35 @@ func getRedisConn(ctx context.Context, idx int, arg LoadArg) (*redis.Client, err
 		ReadTimeout:  time.Duration(arg.ReadTimeout) * time.Millisecond,
 		WriteTimeout: time.Duration(arg.WriteTimeout) * time.Millisecond,
 		PoolSize:     arg.LoadParallel,
+		MaxRetries:   maxRetries,
+		TLSConfig:    tlsConf,
 	})
-	var h = hook{
-		logTimeout: arg.Debug,
-		startTime:  time.Time{},
-		logger:     arg.Logger,
-	}
 	redisClient.AddHook(&h)
 	return redisClient, redisClient.Ping(ctx).Err()
 }
 
+// 获取redis cluster连接:从Addr中发现slot分布,pipeline按照节点拆分.
+// MOVED/ASK的命令没有执行,重定向是安全的;go-redis在节点网络错误时也会在MaxRedirects次数内重发,noRetry不能关闭这种重发
+func getRedisClusterConn(ctx context.Context, arg LoadArg, tlsConf *tls.Config, h *hook) (redis.UniversalClient, error) {
+	redisClient := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:        arg.Addr,
+		MaxRedirects: arg.MaxRetryPerCmd,
+		Username:     arg.Username,
+		Password:     arg.Password,
+		DialTimeout:  time.Duration(arg.DialTimeout) * time.Millisecond,
+		ReadTimeout:  time.Duration(arg.ReadTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(arg.WriteTimeout) * time.Millisecond,
+		PoolSize:     arg.LoadParallel,
+		TLSConfig:    tlsConf,
+	})
+	redisClient.AddHook(h)
+	return redisClient, redisClient.Ping(ctx).Err()
+}
+
 // 关闭
 func (l *RedisLoader) closeLoader(ctx context.Context) (err error) {
-	l.err = io.EOF
 	if l.dataChan != nil {
-		close(l.dataChan)
+		close(l.dataChan) // goroutine写入剩余的数据之后退出
 		for {
 			if l.runningGoroutine == 0 {
 				break
@@ -167,6 +266,11 @@ func (l *RedisLoader) closeLoader(ctx context.Context) (err error) {
 			time.Sleep(intervalLongTime)
 		}
 	}
+	loadErr := l.err
+	l.err = io.EOF
+	if cpErr := l.checkpoint.finish(l.parseDone && loadErr == nil, l.parser.KeyOffset(), l.parser.CurrentDB()); cpErr != nil {
+		err = cpErr
+	}
 
 	if l.cancel != nil {
 		l.cancel()
@@ -11,6 +11,8 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
 	"github.com/qianxiansheng90/go-redis-tool/log_interface"
 	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
 )
@@ -22,8 +24,9 @@ const (
 )
 
 type LoadResult struct {
-	KeyCount      map[string]int64
-	TotalKeyCount int64
+	KeyCount            map[string]int64
+	TotalKeyCount       int64
+	SkipExpiredKeyCount int64 // 跳过的过期key的数量
 }
 
 var (
@@ -41,7 +44,7 @@ func (l *RedisLoader) loadCommand(ctx context.Context, object parser.TypeObject)
 	case parser.SelectionDB{}.Type(): // 需要等待所有的conn切换db
 		return l.changeDB(object)
 	default: // 随机发送数据
-		return l.sendData(object)
+		return l.sendData(object, l.parser.KeyOffset(), l.parser.CurrentDB())
 	}
 }
 
@@ -63,32 +66,54 @@ func (l *RedisLoader) changeDB(object parser.TypeObject) error {
 	return nil
 }
 
-// 发送数据
-func (l *RedisLoader) sendData(object parser.TypeObject) error {
+// 发送数据:offset/db为object所在key的起始位置
+func (l *RedisLoader) sendData(object parser.TypeObject, offset int64, db uint64) error {
+	var key string
+	if isKeyObject(object) {
+		key = object.Key()
+	}
+	obj := loadObject{
+		object: object,
+		seq:    l.checkpoint.add(offset, db, key),
+	}
 	for {
 		if err := l.checkExit(); err != nil { // 检查是否应该退出
 			return err
 		}
 		select {
-		case l.dataChan <- object: // 发送数据
+		case l.dataChan <- obj: // 发送数据
 			goto end
 		case <-time.After(intervalTime): // 超时
 		}
 	}
 end:
-	return nil
+	return l.checkpoint.trySave(l.parser.KeyOffset(), l.parser.CurrentDB())
+}
+
+// 是否是redis中的key
+func isKeyObject(object parser.TypeObject) bool {
+	switch object.Type() {
+	case parser.SelectionDB{}.Type(), parser.ResizeDB{}.Type(), parser.AuxField{}.Type(), parser.ModuleAux{}.Type():
+		return false
+	}
+	return true
 }
 
 // 限速
 func (l *RedisLoader) limit() error {
-	if l.limiter == nil {
+	return waitLimit(l.limiter, l.checkExit)
+}
+
+// 等待限速器,checkExit返回错误则退出
+func waitLimit(limiter *rate.Limiter, checkExit func() error) error {
+	if limiter == nil {
 		return nil
 	}
 	for {
-		if err := l.checkExit(); err != nil { // 检查是否应该退出
+		if err := checkExit(); err != nil { // 检查是否应该退出
 			return err
 		}
-		if l.limiter.Allow() == false {
+		if limiter.Allow() == false {
 			time.Sleep(intervalTime)
 			continue
 		}
@@ -98,9 +123,9 @@ func (l *RedisLoader) limit() error {
 }
 
 // 开启并行导入goroutine
-func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeDBChan, loadDataChan chan parser.TypeObject) {
+func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeDBChan chan parser.TypeObject, loadDataChan chan loadObject) {
 	l.Log("start goroutine %d", idx)
-	var conn *redis.Client
+	var conn redis.UniversalClient
 	var err error
 	defer func() { // 关闭连接
 		if conn != nil {
@@ -119,6 +144,7 @@ func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeD
 	var dbNum uint64 = 0
 	var ok bool
 	var objects = make([]parser.TypeObject, l.pipeLineCmdLen)
+	var seqs = make([]int64, l.pipeLineCmdLen)
 	var objIdx = 0
 	for {
 		if err := l.checkExit(); err != nil { // 检查是否应该退出
@@ -132,6 +158,7 @@ func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeD
 					l.err = err
 					return
 				}
+				l.checkpoint.ack(seqs[:objIdx])
 				objIdx = 0
 			}
 			_, val, _ := changeObj.Command()
@@ -147,16 +174,19 @@ func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeD
 						l.err = err
 						return
 					}
+					l.checkpoint.ack(seqs[:objIdx])
 				}
 				return
 			}
-			objects[objIdx] = obj
+			objects[objIdx] = obj.object
+			seqs[objIdx] = obj.seq
 			objIdx++
 			if objIdx >= l.pipeLineCmdLen { // 缓存量如果要超过限制
 				if err := l.handleRedisKeyPipeline(ctx, idx, dbNum, conn, objects[:objIdx]); err != nil {
 					l.err = err
 					return
 				}
+				l.checkpoint.ack(seqs[:objIdx])
 				objIdx = 0
 			}
 		case <-time.After(intervalTime): // 超时
@@ -165,15 +195,30 @@ func (l *RedisLoader) loadCommandGoroutine(ctx context.Context, idx int, changeD
 }
 
 // 批量处理key
-func (l *RedisLoader) handleRedisKeyPipeline(ctx context.Context, idx int, dbNum uint64, conn *redis.Client, objects []parser.TypeObject) error {
+func (l *RedisLoader) handleRedisKeyPipeline(ctx context.Context, idx int, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
+	if l.loadArg.Cluster && dbNum != 0 && l.loadArg.ClusterSkipDB { // 集群只有0号db
+		l.Log("%d:skip %d keys of db %d in cluster mode", idx, len(objects), dbNum)
+		return nil
+	}
 	if l.loadArg.DelMode { // 删除数据模式
 		return l.delRedisKeyPipelineRetry(ctx, dbNum, conn, objects)
 	}
+	if l.loadArg.Restore { // RESTORE模式
+		return l.restoreRedisKeyPipelineRetry(ctx, idx, dbNum, conn, objects)
+	}
 	return l.loadRedisCommandPipelineRetry(ctx, idx, dbNum, conn, objects)
 }
 
+// pipeline切换db:集群只有0号db,所有的db都写入0号db
+func (l *RedisLoader) selectDB(ctx context.Context, pipe redis.Pipeliner, dbNum uint64) error {
+	if l.loadArg.Cluster {
+		return nil
+	}
+	return pipe.Do(ctx, "select", dbNum).Err()
+}
+
 // 批量删除key:可以重试
-func (l *RedisLoader) delRedisKeyPipelineRetry(ctx context.Context, dbNum uint64, conn *redis.Client, objects []parser.TypeObject) (err error) {
+func (l *RedisLoader) delRedisKeyPipelineRetry(ctx context.Context, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) (err error) {
 	for i := 0; i < l.maxRetryPerCmd; i++ {
 		if err = l.delRedisKeyPipeline(ctx, dbNum, conn, objects); err == nil {
 			return nil
@@ -183,14 +228,13 @@ func (l *RedisLoader) delRedisKeyPipelineRetry(ctx context.Context, dbNum uint64
 }
 
 // 批量删除key
-func (l *RedisLoader) delRedisKeyPipeline(ctx context.Context, dbNum uint64, conn *redis.Client, objects []parser.TypeObject) error {
+func (l *RedisLoader) delRedisKeyPipeline(ctx context.Context, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
 	if len(objects) == 0 {
 		return nil
 	}
 	var pipe = conn.Pipeline()
-	selectCmd := pipe.Do(ctx, "select", dbNum)
-	if selectCmd.Err() != nil {
-		return errors.Wrap(selectCmd.Err(), "delete select")
+	if err := l.selectDB(ctx, pipe, dbNum); err != nil {
+		return errors.Wrap(err, "delete select")
 	}
 	for _, object := range objects {
 		key, val, _ := object.Command()
@@ -212,7 +256,7 @@ func (l *RedisLoader) delRedisKeyPipeline(ctx context.Context, dbNum uint64, con
 }
 
 // 批量导入命令:可以重试
-func (l *RedisLoader) loadRedisCommandPipelineRetry(ctx context.Context, idx int, dbNum uint64, conn *redis.Client, objects []parser.TypeObject) error {
+func (l *RedisLoader) loadRedisCommandPipelineRetry(ctx context.Context, idx int, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
 	var err error
 	for i := 0; i < l.maxRetryPerCmd; i++ {
 		// 如果加载数据失败则先删除key再重试加载数据
@@ -230,17 +274,30 @@ func (l *RedisLoader) loadRedisCommandPipelineRetry(ctx context.Context, idx int
 }
 
 // 批量导入命令
-func (l *RedisLoader) loadRedisCommandPipeline(ctx context.Context, dbNum uint64, conn *redis.Client, objects []parser.TypeObject) error {
+func (l *RedisLoader) loadRedisCommandPipeline(ctx context.Context, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
 	if len(objects) == 0 {
 		return nil
 	}
 	var pipe = conn.Pipeline()
-	selectCmd := pipe.Do(ctx, "select", dbNum)
-	if selectCmd.Err() != nil {
-		return errors.Wrap(selectCmd.Err(), "select")
+	if err := l.selectDB(ctx, pipe, dbNum); err != nil {
+		return errors.Wrap(err, "select")
 	}
 	for _, object := range objects {
+		if l.loadArg.KeepLRU && isKeyObject(object) && (object.Idle() != parser.NoLruIdle || object.Freq() != parser.NoLfuFreq) {
+			// 有lru idle/lfu freq的key通过RESTORE IDLETIME|FREQ写入
+			args, err := l.restoreArgs(object)
+			if err != nil {
+				return err
+			}
+			pipe.Do(ctx, args...)
+			continue
+		}
 		key, val, exp := object.Command()
+		if l.replaceKey && isKeyObject(object) && object.Type() != parser.ObjectTypeModule { // 断点之后的key可能已经写入
+			if status := pipe.Del(ctx, key); status.Err() != nil {
+				return errors.Wrap(status.Err(), "del "+key)
+			}
+		}
 		if l.loadArg.NoExpTime == false && l.loadArg.ExpTimeShiftMS != 0 && exp.Equal(time.Time{}) == false { // 设置了过期时间偏移
 			exp = exp.Add(time.Duration(l.loadArg.ExpTimeShiftMS) * time.Millisecond)
 		}
@@ -248,10 +305,16 @@ func (l *RedisLoader) loadRedisCommandPipeline(ctx context.Context, dbNum uint64
 		switch object.Type() {
 		case parser.StringObject{}.Type():
 			var expDuration time.Duration = invalidExp
-			if exp.Equal(time.Time{}) == false {
+			if l.loadArg.NoExpTime == false && exp.Equal(time.Time{}) == false {
 				expDuration = exp.Sub(time.Now())
 			}
-			if status := pipe.Set(ctx, key, val[0], expDuration); status.Err() != nil {
+			if expDuration > 0 { // 未过期的key直接设置过期时间
+				if status := pipe.Set(ctx, key, val[0], expDuration); status.Err() != nil {
+					return errors.Wrap(status.Err(), errString)
+				}
+				continue
+			}
+			if status := pipe.Set(ctx, key, val[0], invalidExp); status.Err() != nil {
 				return errors.Wrap(status.Err(), errString)
 			}
 		case parser.ListObject{}.Type():
@@ -300,9 +363,13 @@ func (l *RedisLoader) loadRedisCommandPipeline(ctx context.Context, dbNum uint64
 			if status := pipe.ZAdd(ctx, key, zsetVal...); status.Err() != nil {
 				return errors.Wrap(status.Err(), errString)
 			}
+		case parser.ModuleObject{}.Type(): // module的数据无法通过普通命令写入
+			l.Log("skip module key %s", key)
+			continue
 		case parser.SelectionDB{}.Type():
 		case parser.ResizeDB{}.Type():
 		case parser.AuxField{}.Type():
+		case parser.ModuleAux{}.Type():
 		default:
 			// continue
 			return fmt.Errorf(parser.ErrUnknownDataFormat)
@@ -313,18 +380,19 @@ func (l *RedisLoader) loadRedisCommandPipeline(ctx context.Context, dbNum uint64
 		if l.loadArg.NoExpTime == true { // 忽略过期时间
 			continue
 		}
-		expStatus := pipe.PExpire(ctx, key, exp.Sub(time.Now()))
+		// 使用绝对时间,已经过期的key会被redis直接删除
+		expStatus := pipe.PExpireAt(ctx, key, exp)
 		if expStatus.Err() != nil {
 			return errors.Wrap(expStatus.Err(), errString)
 		}
 	}
 	resultArr, err := pipe.Exec(ctx)
 	if err != nil {
-		return errors.Wrap(selectCmd.Err(), "pipeline exec")
+		return errors.Wrap(err, "pipeline exec")
 	}
 	for _, result := range resultArr {
 		if result.Err() != nil {
-			return errors.Wrap(selectCmd.Err(), "pipeline result")
+			return errors.Wrap(result.Err(), "pipeline result")
 		}
 	}
 	return nil
@@ -374,7 +442,8 @@ func (l *RedisLoader) checkExit() (err error) {
 // 获取结果
 func (l *RedisLoader) LoadResult() LoadResult {
 	return LoadResult{
-		TotalKeyCount: l.totalKeyCount,
+		TotalKeyCount:       l.totalKeyCount,
+		SkipExpiredKeyCount: l.parser.SkippedExpiredKeys(),
 	}
 }
 
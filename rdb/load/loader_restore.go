@@ -0,0 +1,90 @@
+/*
+ *Descript:通过RESTORE将object写入到redis
+ */
+package load
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// 批量RESTORE:可以重试,REPLACE会覆盖写入了一部分的key
+func (l *RedisLoader) restoreRedisKeyPipelineRetry(ctx context.Context, idx int, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
+	var err error
+	for i := 0; i < l.maxRetryPerCmd; i++ {
+		if err = l.restoreRedisKeyPipeline(ctx, dbNum, conn, objects); err == nil {
+			return nil
+		}
+		l.Log("%d:restore error %s", idx, err.Error())
+	}
+	return err
+}
+
+// 批量RESTORE key ttl payload REPLACE [ABSTTL] [IDLETIME seconds|FREQ frequency]
+func (l *RedisLoader) restoreRedisKeyPipeline(ctx context.Context, dbNum uint64, conn redis.UniversalClient, objects []parser.TypeObject) error {
+	var pipe = conn.Pipeline()
+	if err := l.selectDB(ctx, pipe, dbNum); err != nil {
+		return errors.Wrap(err, "select")
+	}
+	var restoreCount = 0
+	for _, object := range objects {
+		if !isKeyObject(object) {
+			continue
+		}
+		args, err := l.restoreArgs(object)
+		if err != nil {
+			return err
+		}
+		pipe.Do(ctx, args...)
+		restoreCount++
+	}
+	if restoreCount == 0 {
+		return nil
+	}
+	resultArr, err := pipe.Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "restore pipeline exec")
+	}
+	for _, result := range resultArr {
+		if result.Err() != nil {
+			return errors.Wrap(result.Err(), "restore pipeline result")
+		}
+	}
+	return nil
+}
+
+// RESTORE key ttl payload REPLACE [ABSTTL] [IDLETIME seconds|FREQ frequency]的参数,payload由本地编码
+func (l *RedisLoader) restoreArgs(object parser.TypeObject) ([]interface{}, error) {
+	payload, err := parser.DumpPayload(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "dump payload of key "+object.Key())
+	}
+	ttl := l.restoreTTL(object)
+	args := []interface{}{"restore", object.Key(), ttl, payload, "replace"}
+	if ttl != invalidExp {
+		args = append(args, "absttl")
+	}
+	if object.Freq() != parser.NoLfuFreq { // IDLETIME 和 FREQ 不能同时使用
+		args = append(args, "freq", object.Freq())
+	} else if object.Idle() != parser.NoLruIdle {
+		args = append(args, "idletime", object.Idle())
+	}
+	return args, nil
+}
+
+// RESTORE的过期时间:毫秒时间戳(ABSTTL),没有过期时间为0
+func (l *RedisLoader) restoreTTL(object parser.TypeObject) int64 {
+	_, _, exp := object.Command()
+	if l.loadArg.NoExpTime || exp.Equal(time.Time{}) {
+		return invalidExp
+	}
+	if l.loadArg.ExpTimeShiftMS != 0 {
+		exp = exp.Add(time.Duration(l.loadArg.ExpTimeShiftMS) * time.Millisecond)
+	}
+	return exp.UnixNano() / int64(time.Millisecond)
+}
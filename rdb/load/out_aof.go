@@ -0,0 +1,24 @@
+/*
+ *Descript:将object输出为aof格式
+ */
+package load
+
+import (
+	"context"
+	"io"
+
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/writer"
+)
+
+// 输出为aof:每个key重写为最少的命令,配合-aof输入可以离线重写aof.aof是resp格式,也可以通过redis-cli --pipe导入
+func ParseRDBOutAof(ctx context.Context, reader io.Reader, w io.Writer, arg parser.ParseArg, rArg aof.RewriteArg) (string, error) {
+	aw := writer.NewAofWriter(w, rArg)
+	arg.MergeQuickList = true
+	info, err := ParseRDBHandler(ctx, reader, aw.Handler, arg)
+	if err != nil {
+		return info, err
+	}
+	return info, aw.Close()
+}
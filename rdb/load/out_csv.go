@@ -0,0 +1,142 @@
+/*
+ *Descript:将object输出为csv格式,列和redis-rdb-tools的memory report一致
+ */
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+// 和redis-rdb-tools一样使用datetime.isoformat,微秒为0时不输出小数部分
+const (
+	csvExpiryLayout      = "2006-01-02T15:04:05"
+	csvExpiryLayoutMicro = "2006-01-02T15:04:05.000000"
+)
+
+var csvHeader = []string{"database", "type", "key", "size_in_bytes", "encoding", "num_elements", "len_largest_element", "expiry"}
+
+// redis-rdb-tools的类型名称
+var csvTypeName = map[string]string{
+	parser.ObjectTypeString:    "string",
+	parser.ObjectTypeList:      "list",
+	parser.ObjectTypeSet:       "set",
+	parser.ObjectTypeSortedSet: "sortedset",
+	parser.ObjectTypeHash:      "hash",
+	parser.ObjectTypeStream:    "stream",
+	parser.ObjectTypeModule:    "module",
+}
+
+type OutCsv struct {
+	writer *csv.Writer
+	db     uint64
+}
+
+// 输出为csv:第一行为表头,每个key一行
+func ParseRDBOutCsv(ctx context.Context, reader io.Reader, writer io.Writer, arg parser.ParseArg) (string, error) {
+	var o = OutCsv{
+		writer: csv.NewWriter(writer),
+	}
+	if err := o.writer.Write(csvHeader); err != nil {
+		return "", errors.Wrap(err, "write csv header")
+	}
+	arg.MergeQuickList = true // 每个key一行
+	info, err := ParseRDBHandler(ctx, reader, o.writeCsv, arg)
+	if err != nil {
+		return info, err
+	}
+	o.writer.Flush()
+	return info, o.writer.Error()
+}
+
+// out csv format
+func (o *OutCsv) writeCsv(ctx context.Context, object parser.TypeObject) error {
+	if db, ok := object.(parser.SelectionDB); ok {
+		o.db = db.Index
+		return nil
+	}
+	return o.writeRecord(object)
+}
+
+// 写入一个key
+func (o *OutCsv) writeRecord(object parser.TypeObject) error {
+	typeName, ok := csvTypeName[object.Type()]
+	if !ok { // aux,resize db,module aux
+		return nil
+	}
+	elements, largest := csvElements(object)
+	expiry := ""
+	if exp := parser.ExpireOf(object); exp > 0 {
+		expiry = csvExpiry(exp)
+	}
+	record := []string{
+		strconv.FormatUint(o.db, 10),
+		typeName,
+		object.Key(),
+		strconv.FormatUint(object.MemoryUsage(), 10),
+		object.Encoding(),
+		strconv.FormatUint(elements, 10),
+		strconv.FormatUint(largest, 10),
+		expiry,
+	}
+	if err := o.writer.Write(record); err != nil {
+		return errors.Wrap(err, "write csv "+object.Key())
+	}
+	return nil
+}
+
+// 过期时间(毫秒时间戳)转换为UTC的isoformat
+func csvExpiry(ms int64) string {
+	t := time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+	if t.Nanosecond() == 0 {
+		return t.Format(csvExpiryLayout)
+	}
+	return t.Format(csvExpiryLayoutMicro)
+}
+
+// 元素数量和最大的元素长度:string为value的长度,hash为field和value中较长的
+func csvElements(object parser.TypeObject) (uint64, uint64) {
+	var largest int
+	maxLen := func(s string) {
+		if len(s) > largest {
+			largest = len(s)
+		}
+	}
+	switch obj := object.(type) {
+	case parser.StringObject:
+		return uint64(len(obj.Val)), uint64(len(obj.Val))
+	case parser.ListObject:
+		for _, entry := range obj.Entries {
+			maxLen(entry)
+		}
+		return uint64(len(obj.Entries)), uint64(largest)
+	case parser.Set:
+		for _, entry := range obj.Entries {
+			maxLen(entry)
+		}
+		return uint64(len(obj.Entries)), uint64(largest)
+	case parser.HashMap:
+		for _, entry := range obj.Entry {
+			maxLen(entry.Field)
+			maxLen(entry.Value)
+		}
+		return uint64(len(obj.Entry)), uint64(largest)
+	case parser.SortedSet:
+		for _, entry := range obj.Entries {
+			maxLen(parser.ToString(entry.Field))
+		}
+		return uint64(len(obj.Entries)), uint64(largest)
+	case parser.RedisStream:
+		return obj.Length, 0
+	case parser.ModuleObject:
+		return 1, uint64(len(obj.Payload))
+	}
+	return 0, 0
+}
@@ -0,0 +1,27 @@
+/*
+ *Descript:将object输出为rdb格式
+ */
+package load
+
+import (
+	"context"
+	"io"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/writer"
+)
+
+// 输出为rdb:配合过滤条件可以生成新的rdb
+func ParseRDBOutRDB(ctx context.Context, reader io.Reader, w io.Writer, arg parser.ParseArg, wArg writer.WriterArg) (string, error) {
+	rw, err := writer.NewRDBWriter(w, wArg)
+	if err != nil {
+		return "", err
+	}
+	arg.ExtInfo = true // aux和module aux也需要写入
+	arg.MergeQuickList = true
+	info, err := ParseRDBHandler(ctx, reader, rw.Handler, arg)
+	if err != nil {
+		return info, err
+	}
+	return info, rw.Close()
+}
@@ -6,6 +6,7 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -15,6 +16,11 @@ type AuxField struct {
 }
 
 func (p *RDBParser) auxFields(key, val []byte) error {
+	if string(key) == "redis-bits" {
+		if bits, err := strconv.Atoi(string(val)); err == nil {
+			p.memory = newMemoryModel(bits, p.memoryListPack())
+		}
+	}
 	return p.write(AuxField{Field: string(key), Val: string(val)})
 }
 
@@ -45,6 +51,22 @@ func (af AuxField) Command() (string, []interface{}, time.Time) {
 	return key, val, exp
 }
 
+func (af AuxField) Idle() int64 {
+	return NoLruIdle
+}
+
+func (af AuxField) MemoryUsage() uint64 {
+	return 0
+}
+
+func (af AuxField) Encoding() string {
+	return ""
+}
+
+func (af AuxField) Freq() int64 {
+	return NoLfuFreq
+}
+
 func (af AuxField) JSON() ([]byte, error) {
 	return json.Marshal(JSONFormat{
 		KeyType: ObjectTypeAux,
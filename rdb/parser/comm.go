@@ -15,7 +15,7 @@ const (
 	TypeHash
 	TypeZset2 /* ZSET version 2 with doubles stored in binary. */
 	TypeModule
-	TypeModule2 // module not support at present.
+	TypeModule2 // module value with opcodes
 	_
 	TypeHashZipMap
 	TypeListZipList
@@ -24,6 +24,12 @@ const (
 	TypeHashZipList
 	TypeListQuickList
 	TypeStreamListPacks
+	TypeHashListPack     /* Redis 7.0 RDB 10 */
+	TypeZsetListPack     /* Redis 7.0 RDB 10 */
+	TypeListQuickList2   /* Redis 7.0 RDB 10 */
+	TypeStreamListPacks2 /* Redis 7.0 RDB 10 */
+	TypeSetListPack      /* Redis 7.2 RDB 11 */
+	TypeStreamListPacks3 /* Redis 7.2 RDB 11 */
 )
 
 /* Special RDB opcodes (saved/loaded with rdbSaveType/rdbLoadType). */
@@ -78,6 +84,18 @@ const (
 
 )
 
+// quicklist node container(quicklist 2)
+const (
+	QuickListNodeContainerPlain  = 1 /* Node holds a single plain element. */
+	QuickListNodeContainerPacked = 2 /* Node holds a listpack. */
+)
+
+// listpack
+const (
+	ListPackHeaderSize = 6    /* 4 bytes total-bytes + 2 bytes num-elements */
+	ListPackEnd        = 0xFF /* listpack end byte */
+)
+
 // stream item
 const (
 	StreamItemFlagNone       = 0      /* No special flags. */
@@ -90,7 +108,7 @@ const (
 const (
 	REDIS      = "REDIS"
 	VersionMin = 1
-	VersionMax = 9
+	VersionMax = 11
 )
 
 // 对象类型
@@ -105,9 +123,11 @@ const (
 	ObjectTypeSortedSet = "SortedSet"
 	ObjectTypeList      = "List"
 	ObjectTypeStream    = "Stream"
+	ObjectTypeModule    = "Module"
+	ObjectTypeModuleAux = "ModuleAux"
 )
 
-var BasicObjectArray = []string{ObjectTypeString, ObjectTypeHash, ObjectTypeSet, ObjectTypeSortedSet, ObjectTypeList, ObjectTypeStream}
+var BasicObjectArray = []string{ObjectTypeString, ObjectTypeHash, ObjectTypeSet, ObjectTypeSortedSet, ObjectTypeList, ObjectTypeStream, ObjectTypeModule}
 
 var (
 	PosInf = math.Inf(1)
@@ -0,0 +1,45 @@
+/*
+ *Descript:redis crc64(Jones polynomial)
+ */
+package parser
+
+import "fmt"
+
+// crc64 jones: reflected polynomial of 0xad93d23594c935a9, init 0, no xor out
+const crc64JonesPoly = 0x95ac9329ac4bc9b5
+
+var crc64Table = makeCrc64Table(crc64JonesPoly)
+
+// checksum不一致
+type ChecksumError struct {
+	Expected uint64 // rdb文件末尾记录的checksum
+	Actual   uint64 // 计算得到的checksum
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("rdb checksum mismatch: expected %016x actual %016x", e.Expected, e.Actual)
+}
+
+func makeCrc64Table(poly uint64) *[256]uint64 {
+	t := new([256]uint64)
+	for i := 0; i < 256; i++ {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}
+
+// 计算redis crc64
+func Crc64(crc uint64, b []byte) uint64 {
+	for _, v := range b {
+		crc = crc64Table[byte(crc)^v] ^ (crc >> 8)
+	}
+	return crc
+}
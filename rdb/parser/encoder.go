@@ -0,0 +1,552 @@
+/*
+ *Descript:rdb编码,与解析相反:将对象编码成rdb的value以及DUMP的payload
+ */
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	ErrEncodeNotSupport = "encode object type not support"
+	ErrStreamEntryData  = "illegal stream entry data"
+	ErrStreamIdFormat   = "illegal stream id"
+)
+
+const (
+	basicTypeVersion      = 1   // 基础类型需要的rdb版本
+	dumpPayloadMinVersion = 6   // DUMP的payload最低的rdb版本
+	lzfMinLength          = 20  // 超过这个长度的字符串才压缩
+	streamNodeMaxEntries  = 100 // 每个stream listpack节点最多的entry数量(stream-node-max-entries)
+	listPackMaxElements   = 65535
+)
+
+// rdb编码器
+type Encoder struct {
+	buf      bytes.Buffer
+	compress bool // 使用LZF压缩字符串
+}
+
+// 创建一个编码器:compress 使用LZF压缩字符串
+func NewEncoder(compress bool) *Encoder {
+	return &Encoder{compress: compress}
+}
+
+// 编码之后的数据
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// 清空编码的数据
+func (e *Encoder) Reset() {
+	e.buf.Reset()
+}
+
+// 写入原始数据
+func (e *Encoder) SaveRaw(b ...byte) {
+	e.buf.Write(b)
+}
+
+// 将对象编码成rdb的value:返回对象类型,value和需要的最低rdb版本
+func EncodeValue(object TypeObject) (byte, []byte, int, error) {
+	e := NewEncoder(false)
+	t, version, err := e.SaveObject(object)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	return t, e.Bytes(), version, nil
+}
+
+// 生成DUMP的payload(RESTORE使用):type + value + 2字节rdb版本 + 8字节crc64
+func DumpPayload(object TypeObject) ([]byte, error) {
+	t, value, version, err := EncodeValue(object)
+	if err != nil {
+		return nil, err
+	}
+	if version < dumpPayloadMinVersion {
+		version = dumpPayloadMinVersion
+	}
+	payload := make([]byte, 0, len(value)+11)
+	payload = append(payload, t)
+	payload = append(payload, value...)
+	payload = append(payload, byte(version), byte(version>>8))
+	crc := make([]byte, 8)
+	binary.LittleEndian.PutUint64(crc, Crc64(0, payload))
+	return append(payload, crc...), nil
+}
+
+// 编码对象的value:返回对象类型和需要的最低rdb版本
+func (e *Encoder) SaveObject(object TypeObject) (byte, int, error) {
+	switch o := object.(type) {
+	case StringObject:
+		e.SaveString(o.Val)
+		return TypeString, basicTypeVersion, nil
+	case ListObject:
+		e.SaveLen(uint64(len(o.Entries)))
+		for _, v := range o.Entries {
+			e.SaveString([]byte(v))
+		}
+		return TypeList, basicTypeVersion, nil
+	case Set:
+		e.SaveLen(uint64(len(o.Entries)))
+		for _, v := range o.Entries {
+			e.SaveString([]byte(v))
+		}
+		return TypeSet, basicTypeVersion, nil
+	case HashMap:
+		e.SaveLen(uint64(len(o.Entry)))
+		for _, v := range o.Entry {
+			e.SaveString([]byte(v.Field))
+			e.SaveString([]byte(v.Value))
+		}
+		return TypeHash, basicTypeVersion, nil
+	case SortedSet:
+		e.SaveLen(uint64(len(o.Entries)))
+		for _, v := range o.Entries {
+			e.SaveString(toBytes(v.Field))
+			e.saveBinaryFloat(v.Score)
+		}
+		return TypeZset2, 8, nil
+	case ModuleObject:
+		e.SaveLen(o.ModuleId)
+		e.buf.Write(o.Payload)
+		return TypeModule2, 8, nil
+	case RedisStream:
+		t, err := e.saveStream(o)
+		if err != nil {
+			return 0, 0, err
+		}
+		return t, streamTypeVersion(t), nil
+	default:
+		return 0, 0, errors.New(fmt.Sprintf("%s %s", ErrEncodeNotSupport, object.Type()))
+	}
+}
+
+// 长度编码
+func (e *Encoder) SaveLen(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.buf.WriteByte(byte(n) | Type6Bit<<6)
+	case n < 1<<14:
+		e.buf.WriteByte(byte(n>>8) | Type14Bit<<6)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint32:
+		e.buf.WriteByte(Type32Bit)
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(n))
+		e.buf.Write(b)
+	default:
+		e.buf.WriteByte(Type64Bit)
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, n)
+		e.buf.Write(b)
+	}
+}
+
+// 字符串编码:可以表示为整数的短字符串使用整数编码,开启压缩时长字符串使用LZF
+func (e *Encoder) SaveString(b []byte) {
+	if len(b) <= 11 {
+		if v, ok := stringToInt(b); ok {
+			switch {
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				e.buf.WriteByte(TypeEncVal<<6 | EncodeInt8)
+				e.buf.WriteByte(byte(int8(v)))
+				return
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				e.buf.WriteByte(TypeEncVal<<6 | EncodeInt16)
+				e.buf.Write([]byte{byte(v), byte(v >> 8)})
+				return
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				e.buf.WriteByte(TypeEncVal<<6 | EncodeInt32)
+				e.buf.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)})
+				return
+			}
+		}
+	}
+	if e.compress && len(b) > lzfMinLength {
+		if comp := lzfCompress(b); len(comp) < len(b)-4 { // 压缩之后至少节省4个字节
+			e.buf.WriteByte(TypeEncVal<<6 | EncodeLZF)
+			e.SaveLen(uint64(len(comp)))
+			e.SaveLen(uint64(len(b)))
+			e.buf.Write(comp)
+			return
+		}
+	}
+	e.SaveLen(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+// 8 bytes float64(IEEE754)
+func (e *Encoder) saveBinaryFloat(f float64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	e.buf.Write(b)
+}
+
+// 8 bytes 小端
+func (e *Encoder) saveUint64(v uint64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	e.buf.Write(b)
+}
+
+// stream id(rax的key):16 bytes 大端
+func (e *Encoder) saveRawStreamId(id StreamId) {
+	e.buf.Write(rawStreamId(id))
+}
+
+// stream:按照信息选择最低的类型,已经删除的entry不会编码
+func (e *Encoder) saveStream(s RedisStream) (byte, error) {
+	t := byte(TypeStreamListPacks)
+	if s.EntriesAdded > 0 || s.FirstId != (StreamId{}) || s.MaxDeletedId != (StreamId{}) {
+		t = TypeStreamListPacks2
+	}
+	for _, g := range s.Groups {
+		if g.EntriesRead > 0 && t < TypeStreamListPacks2 {
+			t = TypeStreamListPacks2
+		}
+		for _, c := range g.Consumers {
+			if c.ActiveTime > 0 {
+				t = TypeStreamListPacks3
+			}
+		}
+	}
+
+	entries, err := streamEntries(s.Entries)
+	if err != nil {
+		return 0, err
+	}
+	nodeCount := (len(entries) + streamNodeMaxEntries - 1) / streamNodeMaxEntries
+	e.SaveLen(uint64(nodeCount))
+	for i := 0; i < len(entries); i += streamNodeMaxEntries {
+		end := i + streamNodeMaxEntries
+		if end > len(entries) {
+			end = len(entries)
+		}
+		e.SaveString(rawStreamId(entries[i].id))
+		e.SaveString(streamNodeListPack(entries[i:end]))
+	}
+	e.SaveLen(uint64(len(entries)))
+	e.SaveLen(s.LastId.Ms)
+	e.SaveLen(s.LastId.Sequence)
+	if t >= TypeStreamListPacks2 {
+		e.SaveLen(s.FirstId.Ms)
+		e.SaveLen(s.FirstId.Sequence)
+		e.SaveLen(s.MaxDeletedId.Ms)
+		e.SaveLen(s.MaxDeletedId.Sequence)
+		e.SaveLen(s.EntriesAdded)
+	}
+
+	e.SaveLen(uint64(len(s.Groups)))
+	for _, g := range s.Groups {
+		lastId, err := ParseStreamId(g.LastId)
+		if err != nil {
+			return 0, err
+		}
+		e.SaveString([]byte(g.Name))
+		e.SaveLen(lastId.Ms)
+		e.SaveLen(lastId.Sequence)
+		if t >= TypeStreamListPacks2 {
+			e.SaveLen(g.EntriesRead)
+		}
+		pel, err := streamPendingIds(g.PendingEntryList)
+		if err != nil {
+			return 0, err
+		}
+		e.SaveLen(uint64(len(pel)))
+		for _, id := range pel {
+			nack, _ := g.PendingEntryList[id.String()].(StreamNACK)
+			e.saveRawStreamId(id)
+			e.saveUint64(nack.DeliveryTime)
+			e.SaveLen(nack.DeliveryCount)
+		}
+		e.SaveLen(uint64(len(g.Consumers)))
+		for _, c := range g.Consumers {
+			e.SaveString([]byte(c.Name))
+			e.saveUint64(c.SeenTime)
+			if t >= TypeStreamListPacks3 {
+				e.saveUint64(c.ActiveTime)
+			}
+			cPel, err := streamPendingIds(c.PendingEntryList)
+			if err != nil {
+				return 0, err
+			}
+			e.SaveLen(uint64(len(cPel)))
+			for _, id := range cPel {
+				e.saveRawStreamId(id)
+			}
+		}
+	}
+	return t, nil
+}
+
+// stream类型需要的rdb版本
+func streamTypeVersion(t byte) int {
+	switch t {
+	case TypeStreamListPacks3:
+		return 11
+	case TypeStreamListPacks2:
+		return 10
+	default:
+		return 9
+	}
+}
+
+// stream的一个entry
+type streamEntry struct {
+	id     StreamId
+	fields [][]byte // field value field value ...
+}
+
+// 从解析的结果中获取没有删除的entry,按照id排序,field保持原来的顺序
+func streamEntries(nodes map[string]interface{}) ([]streamEntry, error) {
+	var entries []streamEntry
+	for _, node := range nodes {
+		items, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(ErrStreamEntryData)
+		}
+		for messageId, item := range items {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(ErrStreamEntryData)
+			}
+			if entry["hasDeleted"] == "true" {
+				continue
+			}
+			id, err := ParseStreamId(messageId)
+			if err != nil {
+				return nil, err
+			}
+			fields, ok := entry["fields"].(StreamFields)
+			if !ok {
+				return nil, errors.New(ErrStreamEntryData)
+			}
+			se := streamEntry{id: id, fields: make([][]byte, 0, len(fields))}
+			for _, v := range fields {
+				se.fields = append(se.fields, []byte(v))
+			}
+			entries = append(entries, se)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id.Less(entries[j].id)
+	})
+	return entries, nil
+}
+
+// stream节点的listpack:master entry使用第一个entry的field,相同field的entry只保存value
+func streamNodeListPack(entries []streamEntry) []byte {
+	var lp listPackBuilder
+	master := entries[0]
+	lp.appendInt(int64(len(entries))) // count
+	lp.appendInt(0)                   // deleted
+	lp.appendInt(int64(len(master.fields) / 2))
+	for i := 0; i < len(master.fields); i += 2 {
+		lp.appendString(master.fields[i])
+	}
+	lp.appendInt(0) // master entry 结束
+	for _, entry := range entries {
+		sameFields := len(entry.fields) == len(master.fields)
+		for i := 0; sameFields && i < len(entry.fields); i += 2 {
+			sameFields = bytes.Equal(entry.fields[i], master.fields[i])
+		}
+		flag := int64(StreamItemFlagNone)
+		if sameFields {
+			flag = StreamItemFlagSameFields
+		}
+		lp.appendInt(flag)
+		lp.appendInt(int64(entry.id.Ms - master.id.Ms))
+		lp.appendInt(int64(entry.id.Sequence - master.id.Sequence))
+		count := 3
+		if sameFields {
+			for i := 1; i < len(entry.fields); i += 2 {
+				lp.appendString(entry.fields[i])
+			}
+			count += len(entry.fields) / 2
+		} else {
+			lp.appendInt(int64(len(entry.fields) / 2))
+			for _, v := range entry.fields {
+				lp.appendString(v)
+			}
+			count += 1 + len(entry.fields)
+		}
+		lp.appendInt(int64(count)) // lp-count
+	}
+	return lp.bytes()
+}
+
+// 获取pending entry的id并排序
+func streamPendingIds(pel map[string]interface{}) ([]StreamId, error) {
+	ids := make([]StreamId, 0, len(pel))
+	for rawId := range pel {
+		id, err := ParseStreamId(rawId)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+	return ids, nil
+}
+
+// stream id 16 bytes 大端
+func rawStreamId(id StreamId) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, id.Ms)
+	binary.BigEndian.PutUint64(b[8:], id.Sequence)
+	return b
+}
+
+// 解析 ms-seq 格式的stream id
+func ParseStreamId(s string) (StreamId, error) {
+	i := bytes.IndexByte([]byte(s), '-')
+	if i < 0 {
+		return StreamId{}, errors.New(ErrStreamIdFormat + " " + s)
+	}
+	ms, err := strconv.ParseUint(s[:i], 10, 64)
+	if err != nil {
+		return StreamId{}, errors.New(ErrStreamIdFormat + " " + s)
+	}
+	seq, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil {
+		return StreamId{}, errors.New(ErrStreamIdFormat + " " + s)
+	}
+	return StreamId{Ms: ms, Sequence: seq}, nil
+}
+
+// listpack编码
+type listPackBuilder struct {
+	buf   []byte
+	count int
+}
+
+// 添加字符串:可以表示为整数的字符串使用整数编码
+func (lp *listPackBuilder) appendString(b []byte) {
+	if v, ok := stringToInt(b); ok {
+		lp.appendInt(v)
+		return
+	}
+	var entry []byte
+	switch l := len(b); {
+	case l < 1<<6:
+		entry = append([]byte{0x80 | byte(l)}, b...)
+	case l < 1<<12:
+		entry = append([]byte{0xE0 | byte(l>>8), byte(l)}, b...)
+	default:
+		entry = []byte{0xF0, byte(l), byte(l >> 8), byte(l >> 16), byte(l >> 24)}
+		entry = append(entry, b...)
+	}
+	lp.appendEntry(entry)
+}
+
+// 添加整数
+func (lp *listPackBuilder) appendInt(v int64) {
+	var entry []byte
+	switch {
+	case v >= 0 && v <= 127:
+		entry = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & 0x1FFF
+		entry = []byte{0xC0 | byte(u>>8), byte(u)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		entry = []byte{0xF1, byte(v), byte(v >> 8)}
+	case v >= -(1<<23) && v <= 1<<23-1:
+		entry = []byte{0xF2, byte(v), byte(v >> 8), byte(v >> 16)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		entry = []byte{0xF3, byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}
+	default:
+		entry = make([]byte, 9)
+		entry[0] = 0xF4
+		binary.LittleEndian.PutUint64(entry[1:], uint64(v))
+	}
+	lp.appendEntry(entry)
+}
+
+// 添加entry:entry之后是反向编码的entry长度(backlen)
+func (lp *listPackBuilder) appendEntry(entry []byte) {
+	lp.buf = append(lp.buf, entry...)
+	l := uint64(len(entry))
+	var backLen []byte
+	switch {
+	case l <= 127:
+		backLen = []byte{byte(l)}
+	case l < 16383:
+		backLen = []byte{byte(l >> 7), byte(l&127) | 128}
+	case l < 2097151:
+		backLen = []byte{byte(l >> 14), byte((l>>7)&127) | 128, byte(l&127) | 128}
+	case l < 268435455:
+		backLen = []byte{byte(l >> 21), byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	default:
+		backLen = []byte{byte(l >> 28), byte((l>>21)&127) | 128, byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	}
+	lp.buf = append(lp.buf, backLen...)
+	lp.count++
+}
+
+// 生成listpack:header + entries + end
+func (lp *listPackBuilder) bytes() []byte {
+	total := ListPackHeaderSize + len(lp.buf) + 1
+	count := lp.count
+	if count > listPackMaxElements {
+		count = listPackMaxElements
+	}
+	b := make([]byte, ListPackHeaderSize, total)
+	binary.LittleEndian.PutUint32(b, uint32(total))
+	binary.LittleEndian.PutUint16(b[4:], uint16(count))
+	b = append(b, lp.buf...)
+	return append(b, ListPackEnd)
+}
+
+// 字符串是否是整数(和redis的string2ll一致:不能有前导0和+号)
+func stringToInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != string(b) {
+		return 0, false
+	}
+	return v, true
+}
+
+// 获取对象的过期时间(毫秒时间戳),没有过期时间返回0
+func ExpireOf(object TypeObject) int64 {
+	switch o := object.(type) {
+	case StringObject:
+		return o.Expire
+	case ListObject:
+		return o.Expire
+	case Set:
+		return o.Expire
+	case HashMap:
+		return o.Expire
+	case SortedSet:
+		return o.Expire
+	case RedisStream:
+		return o.Expire
+	case ModuleObject:
+		return o.Expire
+	}
+	return invalidExp
+}
+
+// 转换成[]byte
+func toBytes(v interface{}) []byte {
+	switch val := v.(type) {
+	case []byte:
+		return val
+	case string:
+		return []byte(val)
+	default:
+		return []byte(fmt.Sprint(val))
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ *Descript:key在rdb中的编码(OBJECT ENCODING)
+ */
+package parser
+
+const (
+	EncodingInt        = "int"
+	EncodingEmbStr     = "embstr"
+	EncodingRaw        = "raw"
+	EncodingLinkedList = "linkedlist"
+	EncodingZipList    = "ziplist"
+	EncodingQuickList  = "quicklist"
+	EncodingListPack   = "listpack"
+	EncodingHashTable  = "hashtable"
+	EncodingIntSet     = "intset"
+	EncodingSkipList   = "skiplist"
+	EncodingStream     = "stream"
+	EncodingModule     = "module"
+
+	hashMaxZipListEntries = 128 // hash-max-ziplist-entries的默认值
+	hashMaxZipListValue   = 64  // hash-max-ziplist-value的默认值
+)
+
+// 根据rdb中的类型获取编码:string根据value区分int/embstr/raw
+func encodingOf(object TypeObject, t byte) string {
+	switch t {
+	case TypeString:
+		s, ok := object.(StringObject)
+		if !ok {
+			return EncodingRaw
+		}
+		if _, ok = canonicalInt(string(s.Val)); ok {
+			return EncodingInt
+		}
+		if len(s.Val) <= embstrSizeLimit {
+			return EncodingEmbStr
+		}
+		return EncodingRaw
+	case TypeList:
+		return EncodingLinkedList
+	case TypeListZipList, TypeZsetZipList, TypeHashZipList:
+		return EncodingZipList
+	case TypeListQuickList, TypeListQuickList2:
+		return EncodingQuickList
+	case TypeSet, TypeHash:
+		return EncodingHashTable
+	case TypeSetIntSet:
+		return EncodingIntSet
+	case TypeSetListPack, TypeZsetListPack, TypeHashListPack:
+		return EncodingListPack
+	case TypeZset, TypeZset2:
+		return EncodingSkipList
+	case TypeHashZipMap:
+		return zipMapEncoding(object)
+	case TypeStreamListPacks, TypeStreamListPacks2, TypeStreamListPacks3:
+		return EncodingStream
+	case TypeModule, TypeModule2:
+		return EncodingModule
+	}
+	return ""
+}
+
+// zipmap加载时转换为ziplist,元素数量或者长度超过默认配置时再转换为hashtable
+func zipMapEncoding(object TypeObject) string {
+	h, ok := object.(HashMap)
+	if !ok {
+		return EncodingZipList
+	}
+	if len(h.Entry) > hashMaxZipListEntries {
+		return EncodingHashTable
+	}
+	for _, entry := range h.Entry {
+		if len(entry.Field) > hashMaxZipListValue || len(entry.Value) > hashMaxZipListValue {
+			return EncodingHashTable
+		}
+	}
+	return EncodingZipList
+}
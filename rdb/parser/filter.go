@@ -0,0 +1,164 @@
+/*
+ *Descript:key过滤器
+ */
+package parser
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 过期时间过滤条件
+const (
+	FilterExpiryAll     = ""        // 不过滤
+	FilterExpiryTTL     = "ttl"     // 设置了过期时间并且还没有过期
+	FilterExpiryNoTTL   = "nottl"   // 没有设置过期时间
+	FilterExpiryExpired = "expired" // 已经过期
+)
+
+// 过滤参数
+type FilterArg struct {
+	Patterns        []string // key 匹配的glob(redis keys风格),任意一个匹配即可
+	Regexps         []string // key 匹配的正则,任意一个匹配即可
+	ExcludePatterns []string // 排除的key glob
+	ExcludeRegexps  []string // 排除的key 正则
+	Types           []string // ObjectType*,为空则不过滤
+	DBs             []uint64 // db编号,为空则不过滤
+	Expiry          string   // FilterExpiry*
+}
+
+// key过滤器
+type KeyFilter struct {
+	include keyMatcher
+	exclude keyMatcher
+	types   map[string]bool
+	dbs     map[uint64]bool
+	expiry  string
+}
+
+// 创建过滤器
+func NewKeyFilter(arg FilterArg) (*KeyFilter, error) {
+	f := KeyFilter{expiry: arg.Expiry}
+	switch arg.Expiry {
+	case FilterExpiryAll, FilterExpiryTTL, FilterExpiryNoTTL, FilterExpiryExpired:
+	default:
+		return nil, errors.New("unknown expiry filter " + arg.Expiry)
+	}
+	var err error
+	if f.include, err = newKeyMatcher(arg.Patterns, arg.Regexps); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = newKeyMatcher(arg.ExcludePatterns, arg.ExcludeRegexps); err != nil {
+		return nil, err
+	}
+	if len(arg.Types) > 0 {
+		f.types = make(map[string]bool, len(arg.Types))
+		for _, t := range arg.Types {
+			f.types[t] = true
+		}
+	}
+	if len(arg.DBs) > 0 {
+		f.dbs = make(map[uint64]bool, len(arg.DBs))
+		for _, db := range arg.DBs {
+			f.dbs[db] = true
+		}
+	}
+	return &f, nil
+}
+
+// 判断key是否满足过滤条件,nil过滤器全部满足
+func (f *KeyFilter) Match(db uint64, key []byte, objectType string, expire int64) bool {
+	if f == nil {
+		return true
+	}
+	if f.dbs != nil && f.dbs[db] == false {
+		return false
+	}
+	if f.types != nil && f.types[objectType] == false {
+		return false
+	}
+	switch f.expiry {
+	case FilterExpiryTTL:
+		if expire <= 0 || expire < nowMS() {
+			return false
+		}
+	case FilterExpiryNoTTL:
+		if expire > 0 {
+			return false
+		}
+	case FilterExpiryExpired:
+		if expire <= 0 || expire >= nowMS() {
+			return false
+		}
+	}
+	if f.include.empty() == false && f.include.match(key) == false {
+		return false
+	}
+	return f.exclude.match(key) == false
+}
+
+// key的匹配条件:glob和redis一样按照字节匹配,任意一个glob或者正则匹配即可
+type keyMatcher struct {
+	globs   [][]byte
+	regexps []*regexp.Regexp
+}
+
+func newKeyMatcher(patterns, regexps []string) (keyMatcher, error) {
+	m := keyMatcher{globs: make([][]byte, 0, len(patterns))}
+	for _, pattern := range patterns {
+		m.globs = append(m.globs, []byte(pattern))
+	}
+	for _, expr := range regexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return m, errors.Wrap(err, "key regexp "+expr)
+		}
+		m.regexps = append(m.regexps, re)
+	}
+	return m, nil
+}
+
+func (m keyMatcher) empty() bool {
+	return len(m.globs) == 0 && len(m.regexps) == 0
+}
+
+func (m keyMatcher) match(key []byte) bool {
+	for _, glob := range m.globs {
+		if stringMatch(glob, key) {
+			return true
+		}
+	}
+	for _, re := range m.regexps {
+		if re.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func nowMS() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// rdb中的数据类型对应的object类型
+func ObjectTypeOf(t byte) string {
+	switch t {
+	case TypeString:
+		return ObjectTypeString
+	case TypeList, TypeListZipList, TypeListQuickList, TypeListQuickList2:
+		return ObjectTypeList
+	case TypeSet, TypeSetIntSet, TypeSetListPack:
+		return ObjectTypeSet
+	case TypeZset, TypeZset2, TypeZsetZipList, TypeZsetListPack:
+		return ObjectTypeSortedSet
+	case TypeHash, TypeHashZipMap, TypeHashZipList, TypeHashListPack:
+		return ObjectTypeHash
+	case TypeStreamListPacks, TypeStreamListPacks2, TypeStreamListPacks3:
+		return ObjectTypeStream
+	case TypeModule, TypeModule2:
+		return ObjectTypeModule
+	}
+	return ""
+}
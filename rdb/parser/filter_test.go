@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "用户:1", true},
+		{"用户:*", "用户:1", true},
+		{"用户:*", "用戶:1", false},
+		{"user:?", "user:1", true},
+		{"a?b", "aéb", false}, // ?只匹配一个字节
+		{"a??b", "aéb", true},
+		{"a*", "a", true},
+		{"*a*b", "xaxxb", true},
+		{"*a*b", "xbxa", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"[]", "a", false},
+		{"[^]", "a", true},
+		{"[[:alpha:]]", "a", false}, // 不是posix字符类:[[:alph]后面需要一个]
+		{"[[:alpha:]]", "a]", true},
+		{"[abc", "a", true}, // 没有]
+		{"[abc", "d", false},
+		{`a\*b`, "a*b", true},
+		{`a\*b`, "axb", false},
+		{`[\]]`, "]", true},
+		{`a\`, `a\`, true},
+		{"\xff*", "\xff\x00abc", true},
+		{"?\x00?", "\x80\x00\xfe", true},
+		{"[\x80-\xff]", "\x90", true},
+		{"[\x80-\xff]", "a", false},
+		{"[^\x00]", "\x00", false},
+		{"a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 200), false},
+	}
+	for _, c := range cases {
+		if m := stringMatch([]byte(c.pattern), []byte(c.key)); m != c.match {
+			t.Errorf("pattern %q key %q match %v, want %v", c.pattern, c.key, m, c.match)
+		}
+	}
+}
+
+func TestKeyFilterPatterns(t *testing.T) {
+	f, err := NewKeyFilter(FilterArg{
+		Patterns:        []string{"用户:*", "\x00bin?"},
+		Regexps:         []string{"^order:[0-9]+$"},
+		ExcludePatterns: []string{"用户:9*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		key   string
+		match bool
+	}{
+		{"用户:1", true},
+		{"用户:90", false},
+		{"\x00bin\xff", true},
+		{"\x00bin", false},
+		{"order:12", true},
+		{"order:x", false},
+		{"user:1", false},
+	}
+	for _, c := range cases {
+		if m := f.Match(0, []byte(c.key), ObjectTypeString, 0); m != c.match {
+			t.Errorf("key %q match %v, want %v", c.key, m, c.match)
+		}
+	}
+	if _, err = NewKeyFilter(FilterArg{Regexps: []string{"("}}); err == nil {
+		t.Error("invalid regexp accepted")
+	}
+}
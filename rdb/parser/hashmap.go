@@ -5,6 +5,7 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -12,10 +13,14 @@ import (
 
 // Some of HashEntry manager.
 type HashMap struct {
-	Field  []byte      `json:"field"`
-	Len    uint64      `json:"len"`
-	Entry  []HashEntry `json:"entry"`
-	Expire int64       `json:"expire"`
+	Field   []byte      `json:"field"`
+	Len     uint64      `json:"len"`
+	Entry   []HashEntry `json:"entry"`
+	Expire  int64       `json:"expire"`
+	LruIdle int64       `json:"lruIdle"`
+	LfuFreq int64       `json:"lfuFreq"`
+	Memory  uint64      `json:"memory"`
+	Enc     string      `json:"encoding"`
 }
 
 // HashTable entry.
@@ -30,10 +35,12 @@ func (p *RDBParser) readHashMap(key KeyObject) error {
 		return err
 	}
 	hashTable := HashMap{
-		Field:  key.Field,
-		Len:    length,
-		Entry:  make([]HashEntry, 0, length),
-		Expire: key.Expire,
+		Field:   key.Field,
+		Len:     length,
+		Entry:   make([]HashEntry, 0, length),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := uint64(0); i < length; i++ {
 		field, err := p.loadString()
@@ -70,10 +77,12 @@ func (p *RDBParser) readHashMapWithZipmap(key KeyObject) error {
 	}
 
 	hashTable := HashMap{
-		Field:  key.Field,
-		Len:    uint64(length),
-		Entry:  make([]HashEntry, 0, length),
-		Expire: key.Expire,
+		Field:   key.Field,
+		Len:     uint64(length),
+		Entry:   make([]HashEntry, 0, length),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := 0; i < length; i++ {
 		field, err := loadZipmapItem(buf, false)
@@ -102,10 +111,12 @@ func (p *RDBParser) readHashMapZiplist(key KeyObject) error {
 	length /= 2
 
 	hashTable := HashMap{
-		Field:  key.Field,
-		Len:    uint64(length),
-		Entry:  make([]HashEntry, 0, length),
-		Expire: key.Expire,
+		Field:   key.Field,
+		Len:     uint64(length),
+		Entry:   make([]HashEntry, 0, length),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := int64(0); i < length; i++ {
 		field, err := loadZiplistEntry(buf)
@@ -121,6 +132,34 @@ func (p *RDBParser) readHashMapZiplist(key KeyObject) error {
 	return p.write(hashTable)
 }
 
+func (p *RDBParser) readHashMapListPack(key KeyObject) error {
+	b, err := p.loadString()
+	if err != nil {
+		return err
+	}
+	items, err := loadListPack(b)
+	if err != nil {
+		return err
+	}
+	if len(items)%2 != 0 {
+		return errors.New(ErrIllegalHashData)
+	}
+	length := len(items) / 2
+
+	hashTable := HashMap{
+		Field:   key.Field,
+		Len:     uint64(length),
+		Entry:   make([]HashEntry, 0, length),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
+	}
+	for i := 0; i < len(items); i += 2 {
+		hashTable.Entry = append(hashTable.Entry, HashEntry{Field: ToString(items[i]), Value: ToString(items[i+1])})
+	}
+	return p.write(hashTable)
+}
+
 func (hm HashMap) Type() string {
 	return ObjectTypeHash
 }
@@ -166,21 +205,45 @@ func (hm HashMap) ConcreteSize() uint64 {
 	return uint64(len(strings.Join(kv, "")))
 }
 
+func (hm HashMap) Idle() int64 {
+	return hm.LruIdle
+}
+
+// 估算的内存
+func (hm HashMap) MemoryUsage() uint64 {
+	return hm.Memory
+}
+
+// rdb中的编码
+func (hm HashMap) Encoding() string {
+	return hm.Enc
+}
+
+func (hm HashMap) Freq() int64 {
+	return hm.LfuFreq
+}
+
 func (hm HashMap) JSON() ([]byte, error) {
 	if hm.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeHash,
-			Key:     hm.Key(),
-			Value:   hm.Entry,
-			Expire:  hm.Expire,
+			KeyType:  ObjectTypeHash,
+			Key:      hm.Key(),
+			Idle:     lruValue(hm.LruIdle),
+			Freq:     lruValue(hm.LfuFreq),
+			Encoding: hm.Encoding(),
+			Value:    hm.Entry,
+			Expire:   hm.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeHash,
-		Key:     hm.Key(),
-		Value:   hm.Entry,
+		KeyType:  ObjectTypeHash,
+		Key:      hm.Key(),
+		Idle:     lruValue(hm.LruIdle),
+		Freq:     lruValue(hm.LfuFreq),
+		Encoding: hm.Encoding(),
+		Value:    hm.Entry,
 	})
 }
 func (hm HashMap) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeHash, hm.Key(), hm.Value(), hm.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeHash, hm.Key(), hm.Value(), hm.Expire, hm.LruIdle, hm.LfuFreq, hm.Encoding())), nil
 }
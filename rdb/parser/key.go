@@ -9,12 +9,14 @@ import (
 )
 
 type KeyObject struct {
-	Field  []byte
-	Expire int64
+	Field   []byte
+	Expire  int64
+	LruIdle int64 // lru idle(秒)
+	LfuFreq int64 // lfu freq
 }
 
 func NewKeyObject(key []byte, expire int64) KeyObject {
-	return KeyObject{Field: key, Expire: expire}
+	return KeyObject{Field: key, Expire: expire, LruIdle: NoLruIdle, LfuFreq: NoLfuFreq}
 }
 
 // Whether the key has expired until now.
@@ -24,7 +26,7 @@ func (k KeyObject) GetExpireTime() time.Time {
 
 // Whether the key has expired until now.
 func (k KeyObject) Expired() bool {
-	return k.GetExpireTime().Before(time.Now())
+	return k.Expire > 0 && k.Expire < nowMS()
 }
 
 func (k KeyObject) Type() string {
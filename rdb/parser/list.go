@@ -5,6 +5,7 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -15,6 +16,10 @@ type ListObject struct {
 	Len     uint64   `json:"len"`
 	Entries []string `json:"entries"`
 	Expire  int64    `json:"expire"`
+	LruIdle int64    `json:"lruIdle"`
+	LfuFreq int64    `json:"lfuFreq"`
+	Memory  uint64   `json:"memory"`
+	Enc     string   `json:"encoding"`
 }
 
 func (p *RDBParser) readList(key KeyObject) error {
@@ -27,6 +32,8 @@ func (p *RDBParser) readList(key KeyObject) error {
 		Len:     length,
 		Entries: make([]string, 0, length),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := uint64(0); i < length; i++ {
 		val, err := p.loadString()
@@ -44,6 +51,7 @@ func (p *RDBParser) readListWithQuickList(key KeyObject) error {
 		return err
 	}
 
+	merged := newMergedList(key)
 	for i := uint64(0); i < length; i++ {
 		listItems, err := p.loadZipList()
 		if err != nil {
@@ -54,18 +62,101 @@ func (p *RDBParser) readListWithQuickList(key KeyObject) error {
 			Len:     uint64(len(listItems)),
 			Entries: make([]string, 0, len(listItems)),
 			Expire:  key.Expire,
+			LruIdle: key.LruIdle,
+			LfuFreq: key.LfuFreq,
 		}
 		for _, v := range listItems {
 			listObj.Entries = append(listObj.Entries, ToString(v))
 		}
-		if err = p.write(listObj); err != nil {
+		if err = p.writeListNode(&merged, listObj); err != nil {
 			return err
 		}
 	}
 
+	return p.writeMergedList(merged, length)
+}
+
+// quicklist 2: 每个节点可能是plain节点或者listpack节点
+func (p *RDBParser) readListWithQuickList2(key KeyObject) error {
+	length, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
+
+	merged := newMergedList(key)
+	for i := uint64(0); i < length; i++ {
+		container, _, err := p.loadLen()
+		if err != nil {
+			return err
+		}
+		b, err := p.loadString()
+		if err != nil {
+			return err
+		}
+		var listItems [][]byte
+		switch container {
+		case QuickListNodeContainerPlain:
+			listItems = [][]byte{b}
+		case QuickListNodeContainerPacked:
+			if listItems, err = loadListPack(b); err != nil {
+				return err
+			}
+		default:
+			return errors.New(fmt.Sprintf("unknown quicklist node container %d", container))
+		}
+		listObj := ListObject{
+			Field:   key.Field,
+			Len:     uint64(len(listItems)),
+			Entries: make([]string, 0, len(listItems)),
+			Expire:  key.Expire,
+			LruIdle: key.LruIdle,
+			LfuFreq: key.LfuFreq,
+		}
+		for _, v := range listItems {
+			listObj.Entries = append(listObj.Entries, ToString(v))
+		}
+		if err = p.writeListNode(&merged, listObj); err != nil {
+			return err
+		}
+	}
+
+	return p.writeMergedList(merged, length)
+}
+
+// 合并quicklist节点的ListObject
+func newMergedList(key KeyObject) ListObject {
+	return ListObject{
+		Field:   key.Field,
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
+	}
+}
+
+// 输出quicklist的一个节点:开启MergeQuickList时合并到merged,内存按照每个节点估算之后累加
+func (p *RDBParser) writeListNode(merged *ListObject, node ListObject) error {
+	if !p.parseArg.MergeQuickList {
+		return p.write(node)
+	}
+	if p.skipKey {
+		return nil
+	}
+	node = p.withKeyInfo(node).(ListObject)
+	merged.Entries = append(merged.Entries, node.Entries...)
+	merged.Memory += node.Memory
+	merged.Enc = node.Enc
 	return nil
 }
 
+// 输出合并之后的quicklist
+func (p *RDBParser) writeMergedList(merged ListObject, nodes uint64) error {
+	if !p.parseArg.MergeQuickList || p.skipKey || nodes == 0 {
+		return nil
+	}
+	merged.Len = uint64(len(merged.Entries))
+	return p.handler(p.ctx, merged)
+}
+
 func (p *RDBParser) readListWithZipList(key KeyObject) error {
 	entries, err := p.loadZipList()
 	if err != nil {
@@ -76,6 +167,8 @@ func (p *RDBParser) readListWithZipList(key KeyObject) error {
 		Len:     uint64(len(entries)),
 		Entries: make([]string, 0, len(entries)),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for _, v := range entries {
 		listObj.Entries = append(listObj.Entries, ToString(v))
@@ -138,21 +231,45 @@ func (l ListObject) ConcreteSize() uint64 {
 	return uint64(len([]byte(l.Value())) - (len(l.Entries) - 1)) // 减去分隔符占用字节数
 }
 
+func (l ListObject) Idle() int64 {
+	return l.LruIdle
+}
+
+// 估算的内存
+func (l ListObject) MemoryUsage() uint64 {
+	return l.Memory
+}
+
+// rdb中的编码
+func (l ListObject) Encoding() string {
+	return l.Enc
+}
+
+func (l ListObject) Freq() int64 {
+	return l.LfuFreq
+}
+
 func (l ListObject) JSON() ([]byte, error) {
 	if l.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeList,
-			Key:     l.Key(),
-			Value:   l.Entries,
-			Expire:  l.Expire,
+			KeyType:  ObjectTypeList,
+			Key:      l.Key(),
+			Idle:     lruValue(l.LruIdle),
+			Freq:     lruValue(l.LfuFreq),
+			Encoding: l.Encoding(),
+			Value:    l.Entries,
+			Expire:   l.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeList,
-		Key:     l.Key(),
-		Value:   l.Entries,
+		KeyType:  ObjectTypeList,
+		Key:      l.Key(),
+		Idle:     lruValue(l.LruIdle),
+		Freq:     lruValue(l.LfuFreq),
+		Encoding: l.Encoding(),
+		Value:    l.Entries,
 	})
 }
 func (l ListObject) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeList, l.Key(), l.Value(), l.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeList, l.Key(), l.Value(), l.Expire, l.LruIdle, l.LfuFreq, l.Encoding())), nil
 }
@@ -0,0 +1,410 @@
+/*
+ *Descript:估算key占用的内存(和MEMORY USAGE一致):rdb中的编码,robj,dictEntry,jemalloc的size class,redis-bits
+ */
+package parser
+
+import (
+	"math"
+	"strconv"
+)
+
+const (
+	DefaultRedisBits = 64
+
+	embstrSizeLimit  = 44 // OBJ_ENCODING_EMBSTR_SIZE_LIMIT
+	skiplistMaxLevel = 32 // ZSKIPLIST_MAXLEVEL
+	skiplistP        = 0.25
+	dictMinSlots     = 4 // DICT_HT_INITIAL_SIZE
+	streamRaxNode    = 4 // sizeof(raxNode)
+	streamIdSize     = 16
+	streamRaxAux     = 30 // streamRadixTreeMemoryUsage:每个节点sizeof(long)*30
+
+	quicklistNodeMaxBytes = 8192 // list-max-ziplist-size(list-max-listpack-size)的默认值-2
+	listPackRDBVersion    = 10   // redis 7.0的rdb版本,ziplist加载时转换为listpack
+)
+
+// 内存模型:结构体的大小按照指针(long)的大小计算
+type memoryModel struct {
+	ptr      uint64 // 指针的大小:redis-bits为32时为4
+	quantum  uint64 // jemalloc的最小对齐
+	skipNode uint64 // skiplist节点的平均大小(按照层数的概率分布)
+	listpack bool   // redis 7.0以上:ziplist加载时转换为listpack
+}
+
+func newMemoryModel(bits int, listpack bool) memoryModel {
+	m := memoryModel{ptr: 8, quantum: 16, listpack: listpack}
+	if bits == 32 {
+		m.ptr, m.quantum = 4, 8
+	}
+	var avg float64
+	for level := 1; level <= skiplistMaxLevel; level++ {
+		prob := math.Pow(skiplistP, float64(level-1)) * (1 - skiplistP)
+		avg += prob * float64(m.malloc(m.skiplistNode(uint64(level))))
+	}
+	m.skipNode = uint64(math.Ceil(avg))
+	return m
+}
+
+// jemalloc的size class:8*quantum以内按照quantum对齐,之后每次翻倍分为4档
+func (m memoryModel) malloc(size uint64) uint64 {
+	if size <= 8 {
+		return 8
+	}
+	if size <= 8*m.quantum {
+		return (size + m.quantum - 1) / m.quantum * m.quantum
+	}
+	step := uint64(1) << uint(bitLen(size-1)-3)
+	return (size + step - 1) / step * step
+}
+
+// 表示n需要多少位
+func bitLen(n uint64) int {
+	var bits int
+	for ; n > 0; n >>= 1 {
+		bits++
+	}
+	return bits
+}
+
+func (m memoryModel) robj() uint64 {
+	return 8 + m.ptr // type:4,encoding:4,lru:24,refcount,ptr
+}
+
+func (m memoryModel) dictEntry() uint64 {
+	return 3 * m.ptr // key,val,next
+}
+
+// dict结构体以及bucket数组:bucket数量为不小于元素数量的2的幂
+func (m memoryModel) dict(length uint64) uint64 {
+	slots := uint64(0)
+	if length > 0 {
+		slots = dictMinSlots
+		for slots < length {
+			slots <<= 1
+		}
+	}
+	return 7*m.ptr + slots*m.ptr
+}
+
+// sds的header大小:sdsReqType
+func sdsHeader(length uint64) uint64 {
+	switch {
+	case length == 0: // 空字符串使用sdshdr8
+		return 3
+	case length < 1<<5:
+		return 1
+	case length < 1<<8:
+		return 3
+	case length < 1<<16:
+		return 5
+	case length < 1<<32:
+		return 9
+	}
+	return 17
+}
+
+func (m memoryModel) sds(length uint64) uint64 {
+	return m.malloc(sdsHeader(length) + length + 1)
+}
+
+// key本身:db的dictEntry以及sds
+func (m memoryModel) key(key []byte) uint64 {
+	return m.dictEntry() + m.sds(uint64(len(key)))
+}
+
+// string:int编码只有robj,44字节以内为embstr(robj和sds一起分配),否则为raw
+func (m memoryModel) str(val []byte) uint64 {
+	if _, ok := canonicalInt(string(val)); ok {
+		return m.robj()
+	}
+	length := uint64(len(val))
+	if length <= embstrSizeLimit {
+		return m.malloc(m.robj() + 3 + length + 1)
+	}
+	header := sdsHeader(length)
+	if header < 3 {
+		header = 3
+	}
+	return m.robj() + m.malloc(header+length+1)
+}
+
+// 是否为整数的规范格式(string2ll)
+func canonicalInt(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != s {
+		return 0, false
+	}
+	return v, true
+}
+
+// ziplist的大小:zlbytes,zltail,zllen,zlend以及每个entry(prevlen,encoding,data)
+func ziplistSize(items []string) uint64 {
+	var size, prev uint64 = 11, 0
+	for _, item := range items {
+		entry := uint64(1)
+		if prev >= 254 {
+			entry = 5
+		}
+		if v, ok := canonicalInt(item); ok && len(item) < 32 {
+			switch {
+			case v >= 0 && v <= 12:
+				entry += 1
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				entry += 2
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				entry += 3
+			case v >= -1<<23 && v < 1<<23:
+				entry += 4
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				entry += 5
+			default:
+				entry += 9
+			}
+		} else {
+			length := uint64(len(item))
+			switch {
+			case length <= 0x3f:
+				entry += 1 + length
+			case length <= 0x3fff:
+				entry += 2 + length
+			default:
+				entry += 5 + length
+			}
+		}
+		size += entry
+		prev = entry
+	}
+	return size
+}
+
+// listpack的大小:total-bytes,num-elements,end以及每个entry(encoding,data,backlen)
+func listpackSize(items []string) uint64 {
+	var size uint64 = 7
+	for _, item := range items {
+		var entry uint64
+		if v, ok := canonicalInt(item); ok {
+			switch {
+			case v >= 0 && v <= 127:
+				entry = 1
+			case v >= -4096 && v <= 4095:
+				entry = 2
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				entry = 3
+			case v >= -1<<23 && v < 1<<23:
+				entry = 4
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				entry = 5
+			default:
+				entry = 9
+			}
+		} else {
+			length := uint64(len(item))
+			switch {
+			case length < 64:
+				entry = 1 + length
+			case length < 4096:
+				entry = 2 + length
+			default:
+				entry = 5 + length
+			}
+		}
+		switch {
+		case entry <= 127:
+			entry += 1
+		case entry < 16383:
+			entry += 2
+		case entry < 2097151:
+			entry += 3
+		case entry < 268435455:
+			entry += 4
+		default:
+			entry += 5
+		}
+		size += entry
+	}
+	return size
+}
+
+// intset的大小:encoding,length以及按照最大的元素确定的宽度
+func intsetSize(items []string) uint64 {
+	var width uint64 = 2
+	for _, item := range items {
+		v, _ := strconv.ParseInt(item, 10, 64)
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			width = 8
+			break
+		}
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			width = 4
+		}
+	}
+	return 8 + width*uint64(len(items))
+}
+
+// zset在ziplist/listpack中的score:整数按照整数保存,否则使用17位有效数字
+func scoreString(score float64) string {
+	if score == math.Trunc(score) && math.Abs(score) < 1<<53 {
+		return strconv.FormatInt(int64(score), 10)
+	}
+	return strconv.FormatFloat(score, 'g', 17, 64)
+}
+
+func (m memoryModel) skiplistNode(level uint64) uint64 {
+	return 2*m.ptr + 8 + level*2*m.ptr // ele,score,backward,level[](forward,span)
+}
+
+// quicklist结构体
+func (m memoryModel) quicklist() uint64 {
+	return 4*m.ptr + 8
+}
+
+// quicklist节点:redis 7.0(listpack)增加了size_t sz
+func (m memoryModel) quicklistNode(listpack bool) uint64 {
+	if listpack {
+		return 4*m.ptr + 8
+	}
+	return 3*m.ptr + 8
+}
+
+// ziplist/listpack的大小:redis 7.0以上为listpack
+func (m memoryModel) packSize(items []string) uint64 {
+	if m.listpack {
+		return listpackSize(items)
+	}
+	return ziplistSize(items)
+}
+
+// linkedlist/ziplist加载时转换为quicklist:按照默认的list-max-ziplist-size拆分为多个节点
+func (m memoryModel) quicklistNodes(items []string) uint64 {
+	var size, nodeBytes uint64
+	start := 0
+	for i, item := range items {
+		itemBytes := m.packSize([]string{item}) - m.packSize(nil)
+		if i > start && nodeBytes+itemBytes > quicklistNodeMaxBytes {
+			size += m.quicklistNode(m.listpack) + m.malloc(m.packSize(items[start:i]))
+			start, nodeBytes = i, m.packSize(nil)
+		}
+		nodeBytes += itemBytes
+	}
+	if start < len(items) {
+		size += m.quicklistNode(m.listpack) + m.malloc(m.packSize(items[start:]))
+	}
+	return size
+}
+
+// rax结构体以及节点(streamRadixTreeMemoryUsage)
+func (m memoryModel) radixTree(length uint64) uint64 {
+	return length*streamIdSize + (length+1)*(streamRaxNode+m.ptr*streamRaxAux)
+}
+
+// 估算一个object占用的内存:t为rdb中的类型,first表示是否为key的第一个object(quicklist的每个节点会输出一个object)
+func (m memoryModel) usage(object TypeObject, t byte, first bool, streamBytes uint64) uint64 {
+	var size uint64
+	var key []byte
+	switch o := object.(type) {
+	case StringObject:
+		key, size = o.Field, m.str(o.Val)
+	case ListObject:
+		key = o.Field
+		switch t {
+		case TypeList, TypeListZipList: // 加载时转换为quicklist
+			size = m.robj() + m.quicklist() + m.quicklistNodes(o.Entries)
+		case TypeListQuickList: // redis 7.0以上加载时每个ziplist节点转换为listpack
+			size = m.quicklistNode(m.listpack) + m.malloc(m.packSize(o.Entries))
+			if first {
+				size += m.robj() + m.quicklist()
+			}
+		default: // quicklist2
+			size = m.quicklistNode(true) + m.malloc(listpackSize(o.Entries))
+			if first {
+				size += m.robj() + m.quicklist()
+			}
+		}
+	case Set:
+		key = o.Field
+		switch t {
+		case TypeSetIntSet:
+			size = m.robj() + m.malloc(intsetSize(o.Entries))
+		case TypeSetListPack:
+			size = m.robj() + m.malloc(listpackSize(o.Entries))
+		default:
+			size = m.robj() + m.dict(uint64(len(o.Entries)))
+			for _, entry := range o.Entries {
+				size += m.dictEntry() + m.sds(uint64(len(entry)))
+			}
+		}
+	case HashMap:
+		key = o.Field
+		switch {
+		case t == TypeHash, t == TypeHashZipMap && zipMapEncoding(o) == EncodingHashTable:
+			size = m.robj() + m.dict(uint64(len(o.Entry)))
+			for _, entry := range o.Entry {
+				size += m.dictEntry() + m.sds(uint64(len(entry.Field))) + m.sds(uint64(len(entry.Value)))
+			}
+		default: // zipmap加载时转换为ziplist(超过默认配置时为hashtable),redis 7.0以上ziplist转换为listpack
+			items := make([]string, 0, len(o.Entry)*2)
+			for _, entry := range o.Entry {
+				items = append(items, entry.Field, entry.Value)
+			}
+			if t == TypeHashListPack {
+				size = m.robj() + m.malloc(listpackSize(items))
+			} else {
+				size = m.robj() + m.malloc(m.packSize(items))
+			}
+		}
+	case SortedSet:
+		key = o.Field
+		switch t {
+		case TypeZset, TypeZset2:
+			// zset结构体,zskiplist结构体,32层的header节点,dict
+			size = m.robj() + 2*m.ptr + 2*m.ptr + 16 + m.malloc(m.skiplistNode(skiplistMaxLevel)) + m.dict(uint64(len(o.Entries)))
+			for _, entry := range o.Entries {
+				size += m.sds(uint64(len(ToString(entry.Field)))) + m.dictEntry() + m.skipNode
+			}
+		default:
+			items := make([]string, 0, len(o.Entries)*2)
+			for _, entry := range o.Entries {
+				items = append(items, ToString(entry.Field), scoreString(entry.Score))
+			}
+			if t == TypeZsetListPack {
+				size = m.robj() + m.malloc(listpackSize(items))
+			} else { // redis 7.0以上ziplist加载时转换为listpack
+				size = m.robj() + m.malloc(m.packSize(items))
+			}
+		}
+	case RedisStream:
+		// stream结构体,rax以及每个listpack节点
+		nodes := uint64(len(o.Entries))
+		size = m.robj() + 2*m.ptr + 64 + m.ptr + 16 + nodes*streamRaxNode + streamBytes
+		if len(o.Groups) > 0 {
+			size += m.ptr + 16
+		}
+		for _, g := range o.Groups {
+			pel := uint64(len(g.PendingEntryList))
+			size += 24 + 2*m.ptr + m.radixTree(pel) + pel*(16+m.ptr)
+			for _, c := range g.Consumers {
+				cPel := uint64(len(c.PendingEntryList))
+				size += 16 + 2*m.ptr + uint64(len(c.Name)) + m.radixTree(cPel) + cPel*m.ptr
+			}
+		}
+	case ModuleObject:
+		key, size = o.Field, m.robj()+m.malloc(uint64(len(o.Payload)))
+	default:
+		return 0
+	}
+	if first {
+		size += m.key(key)
+	}
+	return size
+}
+
+// 估算内存时ziplist是否转换为listpack:没有指定目标redis的版本时按照rdb的版本
+func (p *RDBParser) memoryListPack() bool {
+	if p.parseArg.MemoryRedisVersion > 0 {
+		return p.parseArg.MemoryRedisVersion >= 7
+	}
+	return p.rdbVersionNum >= listPackRDBVersion
+}
@@ -0,0 +1,273 @@
+/*
+ *Descript:解析module
+ */
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// module type name 字符集(module.c)
+const moduleTypeNameCharSet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+const (
+	ErrModuleTypeNotSupport = "module type 1 value without opcodes is not supported"
+	ErrModuleOpcodeUnknown  = "unknown module opcode"
+)
+
+// module 类型的key
+type ModuleObject struct {
+	Field      []byte `json:"field"`
+	ModuleId   uint64 `json:"moduleId"`   // module id: 54bit name + 10bit encver
+	ModuleName string `json:"moduleName"` // module type name,例如 MBbloom--
+	EncVersion uint64 `json:"encVersion"` // module encoding version
+	Payload    []byte `json:"payload"`    // module 的原始数据(不包括module id)
+	Expire     int64  `json:"expire"`
+	LruIdle    int64  `json:"lruIdle"`  // lru idle(秒),-1表示不存在
+	LfuFreq    int64  `json:"lfuFreq"`  // lfu freq,-1表示不存在
+	Memory     uint64 `json:"memory"`   // 估算的内存(MEMORY USAGE)
+	Enc        string `json:"encoding"` // rdb中的编码
+}
+
+// module 辅助数据
+type ModuleAux struct {
+	ModuleId   uint64 `json:"moduleId"`
+	ModuleName string `json:"moduleName"`
+	When       uint64 `json:"when"`    // REDISMODULE_AUX_BEFORE_RDB/REDISMODULE_AUX_AFTER_RDB
+	Payload    []byte `json:"payload"` // module aux 的原始数据
+}
+
+// 解析module value
+func (p *RDBParser) readModule(key KeyObject, t byte) error {
+	moduleId, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
+	if t == TypeModule {
+		return errors.New(ErrModuleTypeNotSupport)
+	}
+	payload, err := p.loadModuleValue()
+	if err != nil {
+		return err
+	}
+	return p.write(ModuleObject{
+		Field:      key.Field,
+		ModuleId:   moduleId,
+		ModuleName: ModuleTypeName(moduleId),
+		EncVersion: moduleId & 1023,
+		Payload:    payload,
+		Expire:     key.Expire,
+		LruIdle:    key.LruIdle,
+		LfuFreq:    key.LfuFreq,
+	})
+}
+
+// 解析module aux
+func (p *RDBParser) readModuleAux() error {
+	moduleId, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
+	whenOpcode, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
+	if whenOpcode != TypeModuleOpcodeUInt {
+		return errors.New("module aux when opcode must be uint")
+	}
+	when, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
+	payload, err := p.loadModuleValue()
+	if err != nil {
+		return err
+	}
+	return p.write(ModuleAux{
+		ModuleId:   moduleId,
+		ModuleName: ModuleTypeName(moduleId),
+		When:       when,
+		Payload:    payload,
+	})
+}
+
+// 按照module opcode遍历module value,返回原始数据(包括结尾的EOF opcode)
+func (p *RDBParser) loadModuleValue() ([]byte, error) {
+	p.reader.startRecord()
+	defer p.reader.stopRecord()
+	for {
+		opcode, _, err := p.loadLen()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case TypeModuleOpcodeEof:
+			return p.reader.record, nil
+		case TypeModuleOpcodeSInt, TypeModuleOpcodeUInt:
+			_, _, err = p.loadLen()
+		case TypeModuleOpcodeFloat:
+			_, err = io.ReadFull(p.reader, p.buff[:4])
+		case TypeModuleOpcodeDouble:
+			_, err = io.ReadFull(p.reader, p.buff)
+		case TypeModuleOpcodeString:
+			_, err = p.loadString()
+		default:
+			return nil, errors.New(fmt.Sprintf("%s %d", ErrModuleOpcodeUnknown, opcode))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 根据module id获取module type name
+func ModuleTypeName(moduleId uint64) string {
+	name := make([]byte, 9)
+	id := moduleId >> 10
+	for i := 8; i >= 0; i-- {
+		name[i] = moduleTypeNameCharSet[id&63]
+		id >>= 6
+	}
+	return string(name)
+}
+
+func (m ModuleObject) Type() string {
+	return ObjectTypeModule
+}
+
+func (m ModuleObject) String() string {
+	return fmt.Sprintf("{Module: {Key: %s, Module: %s, EncVer: %d, Len: %d}}", m.Key(), m.ModuleName, m.EncVersion, len(m.Payload))
+}
+
+func (m ModuleObject) Key() string {
+	return ToString(m.Field)
+}
+
+// 原始数据的base64
+func (m ModuleObject) Value() string {
+	return base64.StdEncoding.EncodeToString(m.Payload)
+}
+
+func (m ModuleObject) ValueLen() uint64 {
+	return uint64(len(m.Payload))
+}
+
+func (m ModuleObject) Command() (string, []interface{}, time.Time) {
+	key := m.Key()
+	val := []interface{}{m.Payload}
+	return key, val, ToTime(m.Expire)
+}
+
+// module 原始数据的大小
+func (m ModuleObject) ConcreteSize() uint64 {
+	return uint64(len(m.Payload))
+}
+
+func (m ModuleObject) Idle() int64 {
+	return m.LruIdle
+}
+
+// 估算的内存
+func (m ModuleObject) MemoryUsage() uint64 {
+	return m.Memory
+}
+
+// rdb中的编码
+func (m ModuleObject) Encoding() string {
+	return m.Enc
+}
+
+func (m ModuleObject) Freq() int64 {
+	return m.LfuFreq
+}
+
+func (m ModuleObject) JSON() ([]byte, error) {
+	value := map[string]interface{}{"module": m.ModuleName, "encver": m.EncVersion, "payload": m.Value()}
+	if m.Expire > 0 {
+		return json.Marshal(JSONExpireFormat{
+			KeyType:  ObjectTypeModule,
+			Key:      m.Key(),
+			Idle:     lruValue(m.LruIdle),
+			Freq:     lruValue(m.LfuFreq),
+			Encoding: m.Encoding(),
+			Value:    value,
+			Expire:   m.Expire,
+		})
+	}
+	return json.Marshal(JSONFormat{
+		KeyType:  ObjectTypeModule,
+		Key:      m.Key(),
+		Idle:     lruValue(m.LruIdle),
+		Freq:     lruValue(m.LfuFreq),
+		Encoding: m.Encoding(),
+		Value:    value,
+	})
+}
+
+func (m ModuleObject) KV() ([]byte, error) {
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeModule, m.Key(), m.Value(), m.Expire, m.LruIdle, m.LfuFreq, m.Encoding())), nil
+}
+
+func (m ModuleAux) Type() string {
+	return ObjectTypeModuleAux
+}
+
+func (m ModuleAux) String() string {
+	return fmt.Sprintf("{ModuleAux: {Module: %s, When: %d, Len: %d}}", m.ModuleName, m.When, len(m.Payload))
+}
+
+func (m ModuleAux) Key() string {
+	return m.ModuleName
+}
+
+func (m ModuleAux) Value() string {
+	return base64.StdEncoding.EncodeToString(m.Payload)
+}
+
+func (m ModuleAux) ValueLen() uint64 {
+	return 0
+}
+
+func (m ModuleAux) Command() (string, []interface{}, time.Time) {
+	key := m.Key()
+	val := []interface{}{m.Payload}
+	return key, val, time.Time{}
+}
+
+// 辅助字段全部返回0
+func (m ModuleAux) ConcreteSize() uint64 {
+	return 0
+}
+
+func (m ModuleAux) Idle() int64 {
+	return NoLruIdle
+}
+
+func (m ModuleAux) MemoryUsage() uint64 {
+	return 0
+}
+
+func (m ModuleAux) Encoding() string {
+	return ""
+}
+
+func (m ModuleAux) Freq() int64 {
+	return NoLfuFreq
+}
+
+func (m ModuleAux) JSON() ([]byte, error) {
+	return json.Marshal(JSONFormat{
+		KeyType: ObjectTypeModuleAux,
+		Key:     m.Key(),
+		Value:   m.Value(),
+	})
+}
+
+func (m ModuleAux) KV() ([]byte, error) {
+	return []byte(fmt.Sprintf(OutInfoFormat, m.Key(), m.Value())), nil
+}
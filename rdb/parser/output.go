@@ -6,18 +6,32 @@ package parser
 
 // kv格式
 const (
-	OutKVFormat = "type:%s|key:%s|value:%s|expire:%d"
+	OutKVFormat = "type:%s|key:%s|value:%s|expire:%d|idle:%d|freq:%d|encoding:%s"
 )
 
 // json格式
 type JSONFormat struct {
-	KeyType string      `json:"type"`
-	Key     string      `json:"key"`
-	Value   interface{} `json:"value"`
+	KeyType  string      `json:"type"`
+	Key      string      `json:"key"`
+	Idle     *int64      `json:"idle,omitempty"`
+	Freq     *int64      `json:"freq,omitempty"`
+	Encoding string      `json:"encoding,omitempty"`
+	Value    interface{} `json:"value"`
 }
 type JSONExpireFormat struct {
-	KeyType string      `json:"type"`
-	Key     string      `json:"key"`
-	Value   interface{} `json:"value"`
-	Expire  int64       `json:"expire"`
+	KeyType  string      `json:"type"`
+	Key      string      `json:"key"`
+	Idle     *int64      `json:"idle,omitempty"`
+	Freq     *int64      `json:"freq,omitempty"`
+	Encoding string      `json:"encoding,omitempty"`
+	Value    interface{} `json:"value"`
+	Expire   int64       `json:"expire"`
+}
+
+// lru/lfu 不存在时不输出
+func lruValue(v int64) *int64 {
+	if v < 0 {
+		return nil
+	}
+	return &v
 }
@@ -12,35 +12,50 @@ import (
 // 解析rdb
 func (p *RDBParser) Parse() (err error) {
 	var expire int64
+	var lruIdle, lfuFreq int64 = NoLruIdle, NoLfuFreq
 	var flag byte
 	var hasSelectDb bool
+	var inKey bool // 已经读取了key的过期时间等opcode
 	if err = p.parseHeader(); err != nil {
 		return err
 	}
+	if err = p.resume(); err != nil {
+		return err
+	}
 	for {
 		select {
 		case <-p.ctx.Done():
 			return errors.New(ErrContextDone)
 		default:
 		}
+		if inKey == false {
+			p.keyOffset = p.reader.offset
+		}
 		// Begin analyze
 		flag, err = p.reader.ReadByte()
 		if err != nil {
 			break
 		}
-		if flag == FlagOpcodeIdle {
+		if flag == FlagOpcodeModuleAux {
+			if err = p.readModuleAux(); err != nil {
+				return err
+			}
+			continue
+		} else if flag == FlagOpcodeIdle {
 			b, _, err := p.loadLen()
 			if err != nil {
-				break
+				return errors.New("Parse Idle failed: " + err.Error())
 			}
-			_ = int64(b) // lruIdle
+			lruIdle = int64(b)
+			inKey = true
 			continue
 		} else if flag == FlagOpcodeFreq {
 			b, err := p.reader.ReadByte()
 			if err != nil {
-				break
+				return errors.New("Parse Freq failed: " + err.Error())
 			}
-			_ = int64(b) // lfuIdle
+			lfuFreq = int64(b)
+			inKey = true
 			continue
 		} else if flag == FlagOpcodeAux {
 			// RDB 7 版本之后引入
@@ -54,13 +69,11 @@ func (p *RDBParser) Parse() (err error) {
 			// lua：lua脚本
 			key, err := p.loadString()
 			if err != nil {
-				err = errors.New("Parse Aux key failed: " + err.Error())
-				break
+				return errors.New("Parse Aux key failed: " + err.Error())
 			}
 			val, err := p.loadString()
 			if err != nil {
-				err = errors.New("Parse Aux value failed: " + err.Error())
-				break
+				return errors.New("Parse Aux value failed: " + err.Error())
 			}
 			if err = p.auxFields(key, val); err != nil {
 				return err
@@ -73,13 +86,11 @@ func (p *RDBParser) Parse() (err error) {
 			// 2.失效哈希表的大小
 			dbSize, _, err := p.loadLen()
 			if err != nil {
-				err = errors.New("Parse ResizeDB size failed: " + err.Error())
-				break
+				return errors.New("Parse ResizeDB size failed: " + err.Error())
 			}
 			expiresSize, _, err := p.loadLen()
 			if err != nil {
-				err = errors.New("Parse ResizeDB size failed: " + err.Error())
-				break
+				return errors.New("Parse ResizeDB size failed: " + err.Error())
 			}
 			if err = p.resize(dbSize, expiresSize); err != nil {
 				return err
@@ -88,18 +99,18 @@ func (p *RDBParser) Parse() (err error) {
 		} else if flag == FlagOpcodeExpireTimeMs {
 			_, err := io.ReadFull(p.reader, p.buff)
 			if err != nil {
-				err = errors.New("Parse ExpireTime_ms failed: " + err.Error())
-				break
+				return errors.New("Parse ExpireTime_ms failed: " + err.Error())
 			}
 			expire = int64(binary.LittleEndian.Uint64(p.buff))
+			inKey = true
 			continue
 		} else if flag == FlagOpcodeExpireTime {
 			_, err := io.ReadFull(p.reader, p.buff)
 			if err != nil {
-				err = errors.New("Parse ExpireTime failed: " + err.Error())
-				break
+				return errors.New("Parse ExpireTime failed: " + err.Error())
 			}
 			expire = int64(binary.LittleEndian.Uint64(p.buff)) * 1000
+			inKey = true
 			continue
 		} else if flag == FlagOpcodeSelectDB {
 			if hasSelectDb == true {
@@ -107,7 +118,7 @@ func (p *RDBParser) Parse() (err error) {
 			}
 			dbindex, _, err := p.loadLen()
 			if err != nil {
-				break
+				return errors.New("Parse SelectDB failed: " + err.Error())
 			}
 			if err = p.selection(dbindex); err != nil {
 				return err
@@ -115,8 +126,7 @@ func (p *RDBParser) Parse() (err error) {
 			hasSelectDb = false
 			continue
 		} else if flag == FlagOpcodeEOF {
-			// TODO rdb_go_redis_parser checksum
-			err = nil
+			err = p.parseChecksum()
 			break
 		}
 		// Read key
@@ -125,11 +135,26 @@ func (p *RDBParser) Parse() (err error) {
 			return err
 		}
 		// Read value
-		if err := p.loadObject(key, flag, expire); err != nil {
+		if err := p.loadObject(key, flag, expire, lruIdle, lfuFreq); err != nil {
 			return err
 		}
 		expire = NotExpired
-		//lfuIdle, lruIdle = -1, -1
+		lruIdle, lfuFreq = NoLruIdle, NoLfuFreq
+		inKey = false
 	}
 	return
 }
+
+// 跳到上次解析的位置继续解析
+func (p *RDBParser) resume() error {
+	if p.resumeOffset <= 0 {
+		return nil
+	}
+	if p.resumeOffset < p.reader.offset {
+		return errors.New("invalid resume offset")
+	}
+	if err := p.reader.skipTo(p.resumeOffset); err != nil {
+		return errors.New("skip to resume offset failed: " + err.Error())
+	}
+	return p.selection(p.resumeDB)
+}
@@ -4,7 +4,6 @@
 package parser
 
 import (
-	"bufio"
 	"context"
 	"io"
 
@@ -13,35 +12,63 @@ import (
 
 const (
 	NotExpired = -1
+	NoLruIdle  = -1 // 没有lru idle
+	NoLfuFreq  = -1 // 没有lfu freq
+)
+
+// 已经过期的key的处理方式
+const (
+	ExpiredPolicyKeep  = "keep"  // 保留过期时间,加载后由redis过期(默认)
+	ExpiredPolicySkip  = "skip"  // 跳过已经过期的key
+	ExpiredPolicyNoTTL = "nottl" // 去掉过期时间
 )
 
 // 解析器结构体
 type RDBParser struct {
-	outType    string
-	reader     *bufio.Reader                                      // 输入流
-	parseArg   ParseArg                                           // 解析参数
-	buff       []byte                                             // 缓冲区
-	ctx        context.Context                                    // ctx
-	handler    func(ctx context.Context, object TypeObject) error // 自定义处理器
-	closer     func(ctx context.Context) error                    // 关闭
-	rdbVersion string                                             // rdb版本
+	outType       string
+	reader        *rdbReader                                         // 输入流
+	parseArg      ParseArg                                           // 解析参数
+	buff          []byte                                             // 缓冲区
+	ctx           context.Context                                    // ctx
+	handler       func(ctx context.Context, object TypeObject) error // 自定义处理器
+	closer        func(ctx context.Context) error                    // 关闭
+	rdbVersion    string                                             // rdb版本
+	rdbVersionNum int                                                // rdb版本号
+	currentDB     uint64                                             // 当前的db
+	skipKey       bool                                               // 当前key不满足过滤条件
+	skipExpired   int64                                              // 跳过的过期key的数量
+	keyOffset     int64                                              // 当前key(包括过期时间等opcode)的起始offset
+	resumeOffset  int64                                              // 从这个offset继续解析
+	resumeDB      uint64                                             // 继续解析时的db
+	memory        memoryModel                                        // 估算内存的模型,根据redis-bits确定
+	keyType       byte                                               // 当前key在rdb中的类型
+	keyFirst      bool                                               // 当前key还没有输出object(quicklist的每个节点都会输出一个object)
+	streamBytes   uint64                                             // 当前stream的listpack占用的内存
 }
 
 // 解析参数结构体
 type ParseArg struct {
-	ExtInfo bool // 输出一些额外的信息:例如版本
+	ExtInfo       bool       // 输出一些额外的信息:例如版本
+	CheckSum      bool       // 校验rdb文件末尾的crc64(rdbchecksum no 时末尾为0,不要开启)
+	Filter        *KeyFilter // key过滤器,为空则不过滤
+	ExpiredPolicy string     // 已经过期的key的处理方式:ExpiredPolicy*,默认为keep
+	// quicklist的所有节点合并成一个ListObject输出,默认每个节点输出一个ListObject
+	MergeQuickList bool
+	// 估算内存时目标redis的主版本号(7以上ziplist转换为listpack),默认和生成rdb的redis一致
+	MemoryRedisVersion int
 }
 
 // 创建一个解析器:outType  输出类型:json,kv
 func NewRDBParse(ctx context.Context, reader io.Reader, f func(ctx context.Context, object TypeObject) error,
 	c func(ctx context.Context) error, arg ParseArg) (*RDBParser, error) {
 	p := RDBParser{
-		reader:   bufio.NewReader(reader),
+		reader:   newRDBReader(reader, arg.CheckSum),
 		handler:  f,
 		parseArg: arg,
 		closer:   c,
 		buff:     make([]byte, 8),
 		ctx:      ctx,
+		memory:   newMemoryModel(DefaultRedisBits, arg.MemoryRedisVersion >= 7),
 	}
 
 	if err := p.checkParser(); err != nil {
@@ -61,6 +88,11 @@ func (p *RDBParser) checkParser() error {
 	if p.ctx == nil {
 		p.ctx = context.Background()
 	}
+	switch p.parseArg.ExpiredPolicy {
+	case "", ExpiredPolicyKeep, ExpiredPolicySkip, ExpiredPolicyNoTTL:
+	default:
+		return errors.New("unknown expired policy " + p.parseArg.ExpiredPolicy)
+	}
 	return nil
 }
 
@@ -68,3 +100,34 @@ func (p *RDBParser) checkParser() error {
 func (p *RDBParser) GetRDBInfo() string {
 	return p.rdbVersion
 }
+
+// 获取已经读取的字节数
+func (p *RDBParser) Offset() int64 {
+	return p.reader.offset
+}
+
+// 获取当前key的起始offset:从这个offset可以重新解析当前key
+func (p *RDBParser) KeyOffset() int64 {
+	return p.keyOffset
+}
+
+// 获取当前的db
+func (p *RDBParser) CurrentDB() uint64 {
+	return p.currentDB
+}
+
+// 设置从offset(必须是key的起始offset)继续解析,db为offset处的db.跳过的部分不校验checksum
+func (p *RDBParser) SetResume(offset int64, db uint64) {
+	p.resumeOffset = offset
+	p.resumeDB = db
+}
+
+// 获取跳过的过期key的数量
+func (p *RDBParser) SkippedExpiredKeys() int64 {
+	return p.skipExpired
+}
+
+// 解析结束之后剩余的数据(包括已经缓冲的部分):例如aof的rdb preamble之后的命令
+func (p *RDBParser) Rest() io.Reader {
+	return p.reader.reader
+}
@@ -5,6 +5,7 @@ package parser
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
 	"strconv"
 
@@ -15,8 +16,12 @@ const (
 	ErrRDBFileEmpty         = "RDB file is empty"
 	ErrReadRDBFile          = "Read RDB file failed"
 	ErrNotSupportRDBVersion = "not support rdb version"
+	ErrReadChecksum         = "Read RDB checksum failed"
 )
 
+// rdb 5 版本之后文件末尾有8字节的crc64
+const checksumMinVersion = 5
+
 // 9 bytes length include: 5 bytes "REDIS" and 4 bytes version in rdb.h
 func (p *RDBParser) parseHeader() error {
 	header := make([]byte, 9)
@@ -34,5 +39,32 @@ func (p *RDBParser) parseHeader() error {
 		return errors.New(ErrNotSupportRDBVersion)
 	}
 	p.rdbVersion = string(header)
+	p.rdbVersionNum = rdbVersion
+	p.memory.listpack = p.memoryListPack()
+	return nil
+}
+
+// 校验rdb文件末尾的checksum,checksum包含EOF之前(含EOF)的全部数据
+// 不校验时也会读取checksum,rdb之后的数据可以通过Rest继续读取(例如aof的rdb preamble)
+func (p *RDBParser) parseChecksum() error {
+	if p.rdbVersionNum < checksumMinVersion {
+		return nil
+	}
+	// 继续解析时跳过了部分数据,无法校验
+	verify := p.reader.checksum
+	actual := p.reader.crc
+	if _, err := io.ReadFull(p.reader, p.buff); err != nil {
+		if !verify {
+			return nil
+		}
+		return errors.Wrap(err, ErrReadChecksum)
+	}
+	if !verify {
+		return nil
+	}
+	expected := binary.LittleEndian.Uint64(p.buff)
+	if expected != 0 && expected != actual { // rdbchecksum no时checksum为0,不校验
+		return &ChecksumError{Expected: expected, Actual: actual}
+	}
 	return nil
 }
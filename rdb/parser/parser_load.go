@@ -20,8 +20,21 @@ const (
 	EncodeLZF          /* string compressed with FASTLZ */
 )
 
-func (p *RDBParser) loadObject(key []byte, t byte, expire int64) error {
+func (p *RDBParser) loadObject(key []byte, t byte, expire, lruIdle, lfuFreq int64) error {
 	keyObj := NewKeyObject(key, expire)
+	keyObj.LruIdle, keyObj.LfuFreq = lruIdle, lfuFreq
+	p.keyType, p.keyFirst, p.streamBytes = t, true, 0
+	// 不满足过滤条件的key仍然需要解析,但是不输出
+	p.skipKey = !p.parseArg.Filter.Match(p.currentDB, key, ObjectTypeOf(t), expire)
+	if p.skipKey == false && keyObj.Expired() {
+		switch p.parseArg.ExpiredPolicy {
+		case ExpiredPolicySkip:
+			p.skipKey = true
+			p.skipExpired++
+		case ExpiredPolicyNoTTL:
+			keyObj.Expire = NotExpired
+		}
+	}
 	var err error
 	switch t {
 	case TypeString:
@@ -33,10 +46,9 @@ func (p *RDBParser) loadObject(key []byte, t byte, expire int64) error {
 	case TypeZset, TypeZset2:
 		err = p.readZSet(keyObj, t)
 	case TypeHash:
-		keyObj := NewKeyObject(key, expire)
 		err = p.readHashMap(keyObj)
 	case TypeModule, TypeModule2:
-		err = errors.New("not support module type! ")
+		err = p.readModule(keyObj, t)
 	case TypeHashZipMap:
 		err = p.readHashMapWithZipmap(keyObj)
 	case TypeListZipList:
@@ -49,10 +61,18 @@ func (p *RDBParser) loadObject(key []byte, t byte, expire int64) error {
 		err = p.readHashMapZiplist(keyObj)
 	case TypeListQuickList: // quicklist + ziplist to realize linked list
 		err = p.readListWithQuickList(keyObj)
-	case TypeStreamListPacks:
-		err = p.loadStreamListPack(keyObj)
+	case TypeStreamListPacks, TypeStreamListPacks2, TypeStreamListPacks3:
+		err = p.loadStreamListPack(keyObj, t)
+	case TypeHashListPack:
+		err = p.readHashMapListPack(keyObj)
+	case TypeZsetListPack:
+		err = p.readZSetListPack(keyObj)
+	case TypeListQuickList2: // quicklist + listpack to realize linked list
+		err = p.readListWithQuickList2(keyObj)
+	case TypeSetListPack:
+		err = p.readSetListPack(keyObj)
 	default:
-		err = errors.New("not support key type:" + string(t))
+		err = errors.New("not support key type:" + strconv.Itoa(int(t)))
 	}
 	return err
 }
@@ -104,15 +124,15 @@ func (p *RDBParser) loadString() ([]byte, error) {
 
 	if needEncode {
 		switch length {
-		case EncodeInt8:
+		case EncodeInt8: // 有符号整数
 			b, err := p.reader.ReadByte()
-			return []byte(strconv.Itoa(int(b))), err
+			return []byte(strconv.Itoa(int(int8(b)))), err
 		case EncodeInt16:
 			b, err := p.loadUint16()
-			return []byte(strconv.Itoa(int(b))), err
+			return []byte(strconv.Itoa(int(int16(b)))), err
 		case EncodeInt32:
 			b, err := p.loadUint32()
-			return []byte(strconv.Itoa(int(b))), err
+			return []byte(strconv.Itoa(int(int32(b)))), err
 		case EncodeLZF:
 			res, err := p.loadLZF()
 			return res, err
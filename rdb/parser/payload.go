@@ -0,0 +1,32 @@
+/*
+ *Descript:解析DUMP的payload(RESTORE的参数)
+ */
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+)
+
+const ErrDumpPayload = "DUMP payload version or checksum are wrong"
+
+// 解析DUMP的payload:type + value + 2字节rdb版本 + 8字节crc64,expire为毫秒时间戳(NotExpired表示不过期)
+func ParsePayload(ctx context.Context, key, payload []byte, expire int64, f func(ctx context.Context, object TypeObject) error, arg ParseArg) error {
+	if len(payload) < 11 {
+		return errors.New(ErrDumpPayload)
+	}
+	footer := payload[len(payload)-10:]
+	version := int(binary.LittleEndian.Uint16(footer))
+	if version > VersionMax || binary.LittleEndian.Uint64(footer[2:]) != Crc64(0, payload[:len(payload)-8]) {
+		return errors.New(ErrDumpPayload)
+	}
+	p, err := NewRDBParse(ctx, bytes.NewReader(payload[1:len(payload)-10]), f, nil, arg)
+	if err != nil {
+		return err
+	}
+	p.rdbVersionNum = version
+	p.memory.listpack = p.memoryListPack()
+	return p.loadObject(key, payload[0], expire, NoLruIdle, NoLfuFreq)
+}
@@ -0,0 +1,96 @@
+/*
+ *Descript:rdb输入流,记录读取的offset和crc64
+ */
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+type rdbReader struct {
+	src      io.Reader     // 原始输入流
+	start    int64         // 原始输入流的起始位置(仅io.Seeker有效)
+	reader   *bufio.Reader // 输入流
+	offset   int64         // 已经读取的字节数
+	checksum bool          // 是否计算crc64
+	crc      uint64        // 已读取数据的crc64
+	record   []byte        // 记录读取的原始数据
+	isRecord bool          // 是否记录原始数据
+}
+
+func newRDBReader(reader io.Reader, checksum bool) *rdbReader {
+	r := rdbReader{
+		src:      reader,
+		start:    -1,
+		reader:   bufio.NewReader(reader),
+		checksum: checksum,
+	}
+	if seeker, ok := reader.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			r.start = start
+		}
+	}
+	return &r
+}
+
+func (r *rdbReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return b, err
+	}
+	r.offset++
+	if r.checksum {
+		r.crc = Crc64(r.crc, []byte{b})
+	}
+	if r.isRecord {
+		r.record = append(r.record, b)
+	}
+	return b, nil
+}
+
+func (r *rdbReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if r.checksum && n > 0 {
+		r.crc = Crc64(r.crc, p[:n])
+	}
+	if r.isRecord && n > 0 {
+		r.record = append(r.record, p[:n]...)
+	}
+	return n, err
+}
+
+// 开始记录原始数据
+func (r *rdbReader) startRecord() {
+	r.record = nil
+	r.isRecord = true
+}
+
+// 停止记录并返回记录的原始数据
+func (r *rdbReader) stopRecord() []byte {
+	data := r.record
+	r.record = nil
+	r.isRecord = false
+	return data
+}
+
+// 跳到指定的offset:支持seek则直接seek,否则丢弃中间的数据.跳过的数据无法计算crc64
+func (r *rdbReader) skipTo(offset int64) error {
+	if offset < r.offset {
+		return errors.New("can not skip backward")
+	}
+	r.checksum = false
+	if seeker, ok := r.src.(io.Seeker); ok && r.start >= 0 {
+		if _, err := seeker.Seek(r.start+offset, io.SeekStart); err != nil {
+			return err
+		}
+		r.reader.Reset(r.src)
+		r.offset = offset
+		return nil
+	}
+	n, err := r.reader.Discard(int(offset - r.offset))
+	r.offset += int64(n)
+	return err
+}
@@ -44,6 +44,22 @@ func (r ResizeDB) Command() (string, []interface{}, time.Time) {
 	exp := time.Time{}
 	return key, val, exp
 }
+func (r ResizeDB) Idle() int64 {
+	return NoLruIdle
+}
+
+func (r ResizeDB) MemoryUsage() uint64 {
+	return 0
+}
+
+func (r ResizeDB) Encoding() string {
+	return ""
+}
+
+func (r ResizeDB) Freq() int64 {
+	return NoLfuFreq
+}
+
 func (r ResizeDB) JSON() ([]byte, error) {
 	return json.Marshal(r)
 }
@@ -14,6 +14,7 @@ type SelectionDB struct {
 }
 
 func (p *RDBParser) selection(index uint64) error {
+	p.currentDB = index
 	return p.write(SelectionDB{Index: index})
 
 }
@@ -44,6 +45,22 @@ func (s SelectionDB) Command() (string, []interface{}, time.Time) {
 	exp := time.Time{}
 	return key, val, exp
 }
+func (s SelectionDB) Idle() int64 {
+	return NoLruIdle
+}
+
+func (s SelectionDB) MemoryUsage() uint64 {
+	return 0
+}
+
+func (s SelectionDB) Encoding() string {
+	return ""
+}
+
+func (s SelectionDB) Freq() int64 {
+	return NoLfuFreq
+}
+
 func (s SelectionDB) JSON() ([]byte, error) {
 	return json.Marshal(s)
 }
@@ -18,6 +18,10 @@ type Set struct {
 	Len     uint64   `json:"len"`
 	Entries []string `json:"entries"`
 	Expire  int64    `json:"expire"`
+	LruIdle int64    `json:"lruIdle"`
+	LfuFreq int64    `json:"lfuFreq"`
+	Memory  uint64   `json:"memory"`
+	Enc     string   `json:"encoding"`
 }
 
 func (p *RDBParser) readSet(key KeyObject) error {
@@ -30,6 +34,8 @@ func (p *RDBParser) readSet(key KeyObject) error {
 		Len:     length,
 		Entries: make([]string, 0, length),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := uint64(0); i < length; i++ {
 		member, err := p.loadString()
@@ -67,6 +73,8 @@ func (p *RDBParser) readIntSet(key KeyObject) error {
 		Len:     uint64(cardinality),
 		Entries: make([]string, 0, cardinality),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := uint32(0); i < cardinality; i++ {
 		intBytes, err := buf.Slice(int(intSize))
@@ -87,6 +95,29 @@ func (p *RDBParser) readIntSet(key KeyObject) error {
 	return p.write(set)
 }
 
+func (p *RDBParser) readSetListPack(key KeyObject) error {
+	b, err := p.loadString()
+	if err != nil {
+		return err
+	}
+	items, err := loadListPack(b)
+	if err != nil {
+		return err
+	}
+	set := Set{
+		Field:   key.Field,
+		Len:     uint64(len(items)),
+		Entries: make([]string, 0, len(items)),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
+	}
+	for _, v := range items {
+		set.Entries = append(set.Entries, ToString(v))
+	}
+	return p.write(set)
+}
+
 func (s Set) Type() string {
 	return ObjectTypeSet
 }
@@ -119,21 +150,45 @@ func (s Set) ConcreteSize() uint64 {
 	return uint64(len([]byte(s.Value())) - (len(s.Entries) - 1))
 }
 
+func (s Set) Idle() int64 {
+	return s.LruIdle
+}
+
+// 估算的内存
+func (s Set) MemoryUsage() uint64 {
+	return s.Memory
+}
+
+// rdb中的编码
+func (s Set) Encoding() string {
+	return s.Enc
+}
+
+func (s Set) Freq() int64 {
+	return s.LfuFreq
+}
+
 func (s Set) JSON() ([]byte, error) {
 	if s.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeSet,
-			Key:     s.Key(),
-			Value:   s.Entries,
-			Expire:  s.Expire,
+			KeyType:  ObjectTypeSet,
+			Key:      s.Key(),
+			Idle:     lruValue(s.LruIdle),
+			Freq:     lruValue(s.LfuFreq),
+			Encoding: s.Encoding(),
+			Value:    s.Entries,
+			Expire:   s.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeSet,
-		Key:     s.Key(),
-		Value:   s.Entries,
+		KeyType:  ObjectTypeSet,
+		Key:      s.Key(),
+		Idle:     lruValue(s.LruIdle),
+		Freq:     lruValue(s.LfuFreq),
+		Encoding: s.Encoding(),
+		Value:    s.Entries,
 	})
 }
 func (s Set) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeSet, s.Key(), s.Value(), s.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeSet, s.Key(), s.Value(), s.Expire, s.LruIdle, s.LfuFreq, s.Encoding())), nil
 }
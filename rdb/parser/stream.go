@@ -4,6 +4,7 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -16,12 +17,19 @@ import (
 )
 
 type RedisStream struct {
-	Field   []byte                 `json:"field"`
-	Entries map[string]interface{} `json:"entries"`
-	Length  uint64                 `json:"length"`
-	LastId  StreamId               `json:"lastId"`
-	Groups  []StreamGroup          `json:"groups"`
-	Expire  int64                  `json:"expire"`
+	Field        []byte                 `json:"field"`
+	Entries      map[string]interface{} `json:"entries"`
+	Length       uint64                 `json:"length"`
+	LastId       StreamId               `json:"lastId"`
+	FirstId      StreamId               `json:"firstId"`      // RDB 10
+	MaxDeletedId StreamId               `json:"maxDeletedId"` // RDB 10
+	EntriesAdded uint64                 `json:"entriesAdded"` // RDB 10
+	Groups       []StreamGroup          `json:"groups"`
+	Expire       int64                  `json:"expire"`
+	LruIdle      int64                  `json:"lruIdle"`
+	LfuFreq      int64                  `json:"lfuFreq"`
+	Memory       uint64                 `json:"memory"`
+	Enc          string                 `json:"encoding"`
 }
 
 type StreamEntries struct {
@@ -37,32 +45,66 @@ type StreamId struct {
 type StreamGroup struct {
 	Name             string                 `json:"groupName"`
 	LastId           string                 `json:"lastId"`
+	EntriesRead      uint64                 `json:"entriesRead"` // RDB 10
 	PendingEntryList map[string]interface{} `json:"pending"`
 	Consumers        []StreamConsumer       `json:"consumers"`
 }
 
 type StreamConsumer struct {
 	SeenTime         uint64                 `json:"seenTime"`
+	ActiveTime       uint64                 `json:"activeTime"` // RDB 11
 	Name             string                 `json:"consumerName"`
 	PendingEntryList map[string]interface{} `json:"pending"`
 }
 
+// stream entry的field和value:field value field value ...,保持写入时的顺序
+type StreamFields []string
+
+// 按照顺序输出为json对象
+func (f StreamFields) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBufferString("{")
+	for i := 0; i+1 < len(f); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f[i+1])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
 type StreamNACK struct {
 	Consumer      StreamConsumer `json:"consumer"`
 	DeliveryTime  uint64         `json:"deliveryTime"`
 	DeliveryCount uint64         `json:"deliveryCount"`
 }
 
-func (p *RDBParser) loadStreamListPack(key KeyObject) error {
+func (p *RDBParser) loadStreamListPack(key KeyObject, t byte) error {
 	// Stream entry
 	entries, err := p.loadStreamEntry()
 	if err != nil {
-		return nil
+		return err
 	}
 
-	length, _, _ := p.loadLen()
+	length, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
 	ms, _, _ := p.loadLen()
-	seq, _, _ := p.loadLen()
+	seq, _, err := p.loadLen()
+	if err != nil {
+		return err
+	}
 	lastId := StreamId{Ms: ms, Sequence: seq}
 	stream := RedisStream{
 		Field:   key.Field,
@@ -71,12 +113,31 @@ func (p *RDBParser) loadStreamListPack(key KeyObject) error {
 		LastId:  lastId,
 		Groups:  nil,
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
+	}
+	if t >= TypeStreamListPacks2 {
+		// Redis 7.0 新增: first id, max deleted entry id, entries added
+		firstMs, _, _ := p.loadLen()
+		firstSeq, _, _ := p.loadLen()
+		maxDelMs, _, _ := p.loadLen()
+		maxDelSeq, _, _ := p.loadLen()
+		entriesAdded, _, err := p.loadLen()
+		if err != nil {
+			return err
+		}
+		stream.FirstId = StreamId{Ms: firstMs, Sequence: firstSeq}
+		stream.MaxDeletedId = StreamId{Ms: maxDelMs, Sequence: maxDelSeq}
+		stream.EntriesAdded = entriesAdded
 	}
 	if len(entries) > 0 {
 		stream.Entries = entries
 	}
 	//Stream group
-	groups, err := p.loadStreamGroup()
+	groups, err := p.loadStreamGroup(t)
+	if err != nil {
+		return err
+	}
 	if len(groups) > 0 {
 		stream.Groups = groups
 	}
@@ -108,6 +169,7 @@ func (p *RDBParser) loadStreamEntry() (map[string]interface{}, error) {
 		messageId := streamId.String()
 
 		headerBytes, err := p.loadString()
+		p.streamBytes += p.memory.malloc(uint64(len(headerBytes)))
 		lp := newInput(headerBytes)
 		// Skip the header.
 		// 4b total-bytes + 2b num-elements
@@ -123,7 +185,7 @@ func (p *RDBParser) loadStreamEntry() (map[string]interface{}, error) {
 	return entries, nil
 }
 
-func (p *RDBParser) loadStreamGroup() ([]StreamGroup, error) {
+func (p *RDBParser) loadStreamGroup(t byte) ([]StreamGroup, error) {
 	/*Redis group, struct is this
 	typedef struct streamCG {
 	 	streamID last_id
@@ -146,6 +208,12 @@ func (p *RDBParser) loadStreamGroup() ([]StreamGroup, error) {
 		// GroupLastId
 		lastId := StreamId{Ms: ms, Sequence: seq}
 		group := StreamGroup{Name: string(gName), LastId: lastId.String()}
+		if t >= TypeStreamListPacks2 {
+			// Redis 7.0 新增: entries read
+			if group.EntriesRead, _, err = p.loadLen(); err != nil {
+				return nil, err
+			}
+		}
 
 		// Global PendingEntryList
 		pel, _, _ := p.loadLen()
@@ -177,6 +245,13 @@ func (p *RDBParser) loadStreamGroup() ([]StreamGroup, error) {
 			io.ReadFull(p.reader, p.buff)
 			seenTime := uint64(binary.LittleEndian.Uint64(p.buff))
 			consumer := StreamConsumer{Name: string(cName), SeenTime: seenTime}
+			if t >= TypeStreamListPacks3 {
+				// Redis 7.2 新增: active time
+				if _, err = io.ReadFull(p.reader, p.buff); err != nil {
+					return nil, err
+				}
+				consumer.ActiveTime = binary.LittleEndian.Uint64(p.buff)
+			}
 
 			// Consumer PendingEntryList
 			pel, _, _ := p.loadLen()
@@ -218,19 +293,19 @@ func (p *RDBParser) loadStreamGroup() ([]StreamGroup, error) {
 func loadStreamEntryItem(lp *input, stId StreamId) (entries map[string]interface{}, err error) {
 	// Entry format:
 	// | count | deleted | num-fields | field_1 | field_2 | ... | field_N |0|
-	countBytes, err := loadStreamListPackEntry(lp)
+	countBytes, err := loadListPackEntry(lp)
 	if err != nil {
 		return nil, err
 	}
 
 	count, _ := strconv.ParseUint(string(countBytes), 10, 64)
-	deletedBytes, err := loadStreamListPackEntry(lp)
+	deletedBytes, err := loadListPackEntry(lp)
 	if err != nil {
 		return nil, err
 	}
 	deleted, _ := strconv.ParseInt(string(deletedBytes), 10, 64)
 
-	fieldsNumBytes, err := loadStreamListPackEntry(lp)
+	fieldsNumBytes, err := loadListPackEntry(lp)
 	if err != nil {
 		return nil, err
 	}
@@ -238,51 +313,53 @@ func loadStreamEntryItem(lp *input, stId StreamId) (entries map[string]interface
 
 	fieldCollect := make([][]byte, 0, fieldsNum)
 	for i := uint64(0); i < fieldsNum; i++ {
-		tmp, err := loadStreamListPackEntry(lp)
+		tmp, err := loadListPackEntry(lp)
 		if err != nil {
 			return nil, err
 		}
 		fieldCollect = append(fieldCollect, tmp)
 	}
-	loadStreamListPackEntry(lp)
+	loadListPackEntry(lp)
 
 	total := uint64(count) + uint64(deleted)
 	entries = make(map[string]interface{}, total)
 	for i := uint64(0); i < total; i++ {
-		flagBytes, err := loadStreamListPackEntry(lp)
+		flagBytes, err := loadListPackEntry(lp)
 		if err != nil {
 			return nil, err
 		}
 		flag, _ := strconv.Atoi(string(flagBytes))
-		msBytes, err := loadStreamListPackEntry(lp) // ms
+		msBytes, err := loadListPackEntry(lp) // ms
 		if err != nil {
 			return nil, err
 		}
-		seqBytes, err := loadStreamListPackEntry(lp) // seq
+		seqBytes, err := loadListPackEntry(lp) // seq
 		if err != nil {
 			return nil, err
 		}
 
-		ms, _ := strconv.ParseUint(string(msBytes), 10, 64)
-		seq, _ := strconv.ParseUint(string(seqBytes), 10, 64)
-		messageId := stId.BuildOn(ms, seq).String()
+		// 相对于master entry的差值,seq的差值可能是负数
+		ms, _ := strconv.ParseInt(string(msBytes), 10, 64)
+		seq, _ := strconv.ParseInt(string(seqBytes), 10, 64)
+		messageId := stId.BuildOn(uint64(ms), uint64(seq)).String()
 
 		hasDelete := "false"
 		if flag&StreamItemFlagDeleted != 0 {
 			hasDelete = "true"
 		}
+		fieldsNum = uint64(len(fieldCollect)) // 和master entry相同的field
 		if flag&StreamItemFlagSameFields == 0 {
-			fieldsNumBytes, err := loadStreamListPackEntry(lp)
+			fieldsNumBytes, err := loadListPackEntry(lp)
 			if err != nil {
 				return nil, err
 			}
 			fieldsNum, _ = strconv.ParseUint(string(fieldsNumBytes), 10, 64)
 		}
-		fields := make(map[string]interface{}, fieldsNum)
+		fields := make(StreamFields, 0, fieldsNum*2)
 		for i := uint64(0); i < fieldsNum; i++ {
 			var fieldBytes []byte
 			if flag&StreamItemFlagSameFields == 0 {
-				fieldBytes, err = loadStreamListPackEntry(lp)
+				fieldBytes, err = loadListPackEntry(lp)
 				if err != nil {
 					return nil, err
 				}
@@ -292,14 +369,14 @@ func loadStreamEntryItem(lp *input, stId StreamId) (entries map[string]interface
 				}
 				fieldBytes = fieldCollect[i]
 			}
-			vBytes, err := loadStreamListPackEntry(lp)
+			vBytes, err := loadListPackEntry(lp)
 			if err != nil {
 				return nil, err
 			}
-			fields[string(fieldBytes)] = string(vBytes)
+			fields = append(fields, string(fieldBytes), string(vBytes))
 		}
 		entries[messageId] = map[string]interface{}{"hasDeleted": hasDelete, "fields": fields}
-		loadStreamListPackEntry(lp)
+		loadListPackEntry(lp)
 	}
 
 	if endBytes, _ := lp.ReadByte(); endBytes != 255 {
@@ -309,106 +386,18 @@ func loadStreamEntryItem(lp *input, stId StreamId) (entries map[string]interface
 	return entries, nil
 }
 
-func loadStreamListPackEntry(buf *input) ([]byte, error) {
-	special, err := buf.ReadByte()
-	if err != nil {
-		return nil, err
-	}
-
-	res := make([]byte, 0)
-	skip := 0
-	if special&0x80 == 0 {
-		skip = 1
-		res = []byte(strconv.FormatInt(int64(special&0x7F), 10))
-	} else if special&0xC0 == 0x80 {
-		length := special & 0x3F
-		skip = 1 + int(length)
-		res, err = buf.Slice(int(length))
-		if err != nil {
-			return nil, err
-		}
-	} else if special&0xE0 == 0xC0 {
-		skip = 2
-		next, err := buf.ReadByte()
-		if err != nil {
-			return nil, err
-		}
-		//int64(int32(uint32(special&0x1F)<<8|uint32(next)) << 19 >> 19)
-		res = []byte(strconv.FormatInt(int64(int32(uint32(special&0x1F)<<8|uint32(next))<<19>>19), 10))
-	} else if special&0xFF == 0xF1 {
-		skip = 3
-		b, err := buf.Slice(2)
-		if err != nil {
-			return nil, err
-		}
-		res = []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10))
-	} else if special&0xFF == 0xF2 {
-		skip = 4
-		intBytes := make([]byte, 4)
-		_, err := buf.Read(intBytes[1:])
-		if err != nil {
-			return nil, err
-		}
-		res = []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(intBytes))>>8), 10))
-	} else if special&0xFF == 0xF3 {
-		skip = 5
-		intBytes, err := buf.Slice(4)
-		if err != nil {
-			return nil, err
-		}
-		res = []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(intBytes))), 10))
-	} else if special&0xFF == 0xF4 {
-		skip = 9
-		intBytes, err := buf.Slice(8)
-		if err != nil {
-			return nil, err
-		}
-		res = []byte(strconv.FormatInt(int64(binary.LittleEndian.Uint64(intBytes)), 10))
-	} else if special&0xF0 == 0xE0 {
-		b, err := buf.ReadByte()
-		if err != nil {
-			return nil, err
-		}
-		length := ((special & 0x0F) << 8) | b
-		skip = 2 + int(length)
-		res, err = buf.Slice(int(length))
-		if err != nil {
-			return nil, err
-		}
-	} else if special&0xFF == 0xf0 {
-		lenBytes, err := buf.Slice(4)
-		if err != nil {
-			return nil, err
-		}
-		length := uint64(binary.BigEndian.Uint32(lenBytes))
-		skip = 5 + int(length)
-		res, err = buf.Slice(int(length))
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, errors.New("Unknown encoding type! ")
-	}
-
-	// element-total-len
-	if skip <= 127 {
-		buf.Seek(1, 1)
-	} else if skip < 16383 {
-		buf.Seek(2, 1)
-	} else if skip < 2097151 {
-		buf.Seek(3, 1)
-	} else if skip < 268435455 {
-		buf.Seek(4, 1)
-	} else {
-		buf.Seek(5, 1)
-	}
-	return res, err
-}
-
 func (sd StreamId) String() string {
 	return strconv.FormatUint(sd.Ms, 10) + "-" + strconv.FormatUint(sd.Sequence, 10)
 }
 
+// 比较stream id
+func (sd StreamId) Less(o StreamId) bool {
+	if sd.Ms != o.Ms {
+		return sd.Ms < o.Ms
+	}
+	return sd.Sequence < o.Sequence
+}
+
 func (sd StreamId) BuildOn(ms, seq uint64) StreamId {
 	newMs := sd.Ms + ms
 	newSequence := sd.Sequence + seq
@@ -480,7 +469,7 @@ func (rs RedisStream) Command() (string, []interface{}, time.Time) {
 			if vMap["hasDeleted"] == "false" {
 				hasDelete = false
 			}
-			vals, ok := vMap["fields"].(map[string]interface{})
+			vals, ok := vMap["fields"].(StreamFields)
 			if ok == false {
 				continue
 			}
@@ -489,7 +478,7 @@ func (rs RedisStream) Command() (string, []interface{}, time.Time) {
 				MaxLen:       0,
 				MaxLenApprox: 0,
 				ID:           k,
-				Values:       vals,
+				Values:       []string(vals),
 			}
 			xaArr = append(xaArr, XAdd{ID: vv.ID, HasDelete: hasDelete, XaddArg: &vv})
 
@@ -518,8 +507,8 @@ func (rs RedisStream) ConcreteSize() uint64 {
 			if entry, ok := item.(map[string]interface{}); ok {
 				for _, fields := range entry {
 					collect := fields.(map[string]interface{})["fields"]
-					for key, value := range collect.(map[string]interface{}) { // entry fields and values
-						size += uint64(len([]byte(ToString(key)))) + uint64(len([]byte(ToString(value))))
+					for _, v := range collect.(StreamFields) { // entry fields and values
+						size += uint64(len(v))
 					}
 				}
 			}
@@ -530,21 +519,45 @@ func (rs RedisStream) ConcreteSize() uint64 {
 	return 0
 }
 
+func (rs RedisStream) Idle() int64 {
+	return rs.LruIdle
+}
+
+// 估算的内存
+func (rs RedisStream) MemoryUsage() uint64 {
+	return rs.Memory
+}
+
+// rdb中的编码
+func (rs RedisStream) Encoding() string {
+	return rs.Enc
+}
+
+func (rs RedisStream) Freq() int64 {
+	return rs.LfuFreq
+}
+
 func (rs RedisStream) JSON() ([]byte, error) {
 	if rs.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeStream,
-			Key:     rs.Key(),
-			Value:   rs.Value(),
-			Expire:  rs.Expire,
+			KeyType:  ObjectTypeStream,
+			Key:      rs.Key(),
+			Idle:     lruValue(rs.LruIdle),
+			Freq:     lruValue(rs.LfuFreq),
+			Encoding: rs.Encoding(),
+			Value:    rs.Value(),
+			Expire:   rs.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeStream,
-		Key:     rs.Key(),
-		Value:   rs.Value(),
+		KeyType:  ObjectTypeStream,
+		Key:      rs.Key(),
+		Idle:     lruValue(rs.LruIdle),
+		Freq:     lruValue(rs.LfuFreq),
+		Encoding: rs.Encoding(),
+		Value:    rs.Value(),
 	})
 }
 func (rs RedisStream) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeStream, rs.Key(), rs.Value(), rs.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeStream, rs.Key(), rs.Value(), rs.Expire, rs.LruIdle, rs.LfuFreq, rs.Encoding())), nil
 }
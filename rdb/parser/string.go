@@ -10,9 +10,13 @@ import (
 )
 
 type StringObject struct {
-	Field  []byte `json:"field"`
-	Val    []byte `json:"val"`
-	Expire int64  `json:"expire"`
+	Field   []byte `json:"field"`
+	Val     []byte `json:"val"`
+	Expire  int64  `json:"expire"`
+	LruIdle int64  `json:"lruIdle"`
+	LfuFreq int64  `json:"lfuFreq"`
+	Memory  uint64 `json:"memory"`
+	Enc     string `json:"encoding"`
 }
 
 func (p *RDBParser) readString(key KeyObject) error {
@@ -25,9 +29,11 @@ func (p *RDBParser) readString(key KeyObject) error {
 
 func NewStringObject(key KeyObject, val []byte) StringObject {
 	return StringObject{
-		Field:  key.Field,
-		Val:    val,
-		Expire: key.Expire,
+		Field:   key.Field,
+		Val:     val,
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 }
 
@@ -61,21 +67,45 @@ func (s StringObject) Command() (string, []interface{}, time.Time) {
 func (s StringObject) ConcreteSize() uint64 {
 	return uint64(len([]byte(s.Value())))
 }
+func (s StringObject) Idle() int64 {
+	return s.LruIdle
+}
+
+// 估算的内存
+func (s StringObject) MemoryUsage() uint64 {
+	return s.Memory
+}
+
+// rdb中的编码
+func (s StringObject) Encoding() string {
+	return s.Enc
+}
+
+func (s StringObject) Freq() int64 {
+	return s.LfuFreq
+}
+
 func (s StringObject) JSON() ([]byte, error) {
 	if s.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeString,
-			Key:     s.Key(),
-			Value:   s.Value(),
-			Expire:  s.Expire,
+			KeyType:  ObjectTypeString,
+			Key:      s.Key(),
+			Idle:     lruValue(s.LruIdle),
+			Freq:     lruValue(s.LfuFreq),
+			Encoding: s.Encoding(),
+			Value:    s.Value(),
+			Expire:   s.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeString,
-		Key:     s.Key(),
-		Value:   s.Value(),
+		KeyType:  ObjectTypeString,
+		Key:      s.Key(),
+		Idle:     lruValue(s.LruIdle),
+		Freq:     lruValue(s.LfuFreq),
+		Encoding: s.Encoding(),
+		Value:    s.Value(),
 	})
 }
 func (s StringObject) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeString, s.Key(), s.Value(), s.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeString, s.Key(), s.Value(), s.Expire, s.LruIdle, s.LfuFreq, s.Encoding())), nil
 }
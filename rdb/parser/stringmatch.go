@@ -0,0 +1,103 @@
+/*
+ *Descript:redis风格的glob匹配,移植自redis的stringmatchlen(util.c)
+ */
+package parser
+
+const stringMatchMaxNesting = 1000 // 和redis一致,防止恶意的pattern
+
+// 按照字节匹配glob:* ? [abc] [^a] [a-z] \x,和redis的KEYS/SCAN MATCH结果一致
+func stringMatch(pattern, str []byte) bool {
+	if len(pattern) == 1 && pattern[0] == '*' { // 和KEYS *一样匹配全部key(包括空key)
+		return true
+	}
+	skipLongerMatches := false
+	return stringMatchLen(pattern, str, &skipLongerMatches, 0)
+}
+
+// skipLongerMatches:*之后的pattern从str的任何位置开始都不匹配,之前的*匹配更长的字符串也不会匹配
+func stringMatchLen(pattern, str []byte, skipLongerMatches *bool, nesting int) bool {
+	if nesting > stringMatchMaxNesting {
+		return false
+	}
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for ; s < len(str); s++ {
+				if stringMatchLen(pattern[p+1:], str[s:], skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if p < len(pattern) && pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if p < len(pattern) && pattern[p] == ']' {
+					break
+				} else if p >= len(pattern) { // 没有],最后一个字符作为结束
+					p--
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end, c := pattern[p], pattern[p+2], str[s]
+					if start > end {
+						start, end = end, start
+					}
+					p += 2
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if pattern[p] == str[s] {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if pattern[p] != str[s] {
+				return false
+			}
+			s++
+		}
+		p++
+		if s == len(str) {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
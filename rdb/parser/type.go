@@ -16,4 +16,8 @@ type TypeObject interface {
 	Command() (string, []interface{}, time.Time) // out command
 	JSON() ([]byte, error)                       // out json data
 	KV() ([]byte, error)                         // out key value data
+	Idle() int64                                 // lru idle seconds, NoLruIdle if not exist
+	Freq() int64                                 // lfu frequency, NoLfuFreq if not exist
+	MemoryUsage() uint64                         // estimated memory usage(MEMORY USAGE), 0 if not a key
+	Encoding() string                            // encoding in rdb(OBJECT ENCODING), empty if not a key
 }
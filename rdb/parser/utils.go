@@ -41,6 +41,60 @@ func lzfDecompress(in []byte, inLen, outLen int) []byte {
 	return out
 }
 
+// LZF压缩(liblzf),与lzfDecompress相反
+func lzfCompress(in []byte) []byte {
+	const (
+		hashLog   = 14
+		hashSize  = 1 << hashLog
+		maxLit    = 1 << 5
+		maxOff    = 1 << 13
+		maxRefLen = (1 << 8) + (1 << 3) // 最长的匹配长度
+	)
+	inLen := len(in)
+	out := make([]byte, 0, inLen)
+	hashTable := make([]int, hashSize) // 位置+1,0表示没有
+	litStart := 0
+	flushLiteral := func(end int) {
+		for litStart < end {
+			n := end - litStart
+			if n > maxLit {
+				n = maxLit
+			}
+			out = append(out, byte(n-1))
+			out = append(out, in[litStart:litStart+n]...)
+			litStart += n
+		}
+	}
+	for ip := 0; ip+2 < inLen; {
+		h := (uint32(in[ip])<<16 | uint32(in[ip+1])<<8 | uint32(in[ip+2])) * 2654435761 >> (32 - hashLog)
+		ref := hashTable[h] - 1
+		hashTable[h] = ip + 1
+		if ref < 0 || ip-ref-1 >= maxOff || in[ref] != in[ip] || in[ref+1] != in[ip+1] || in[ref+2] != in[ip+2] {
+			ip++
+			continue
+		}
+		matchLen, maxLen := 3, inLen-ip
+		if maxLen > maxRefLen {
+			maxLen = maxRefLen
+		}
+		for matchLen < maxLen && in[ref+matchLen] == in[ip+matchLen] {
+			matchLen++
+		}
+		flushLiteral(ip)
+		l, off := matchLen-2, ip-ref-1
+		if l < 7 {
+			out = append(out, byte(l<<5|off>>8))
+		} else {
+			out = append(out, byte(7<<5|off>>8), byte(l-7))
+		}
+		out = append(out, byte(off))
+		ip += matchLen
+		litStart = ip
+	}
+	flushLiteral(inLen)
+	return out
+}
+
 func loadZipmapItem(buf *input, readFree bool) ([]byte, error) {
 	length, free, err := loadZipmapItemLength(buf, readFree)
 	if err != nil {
@@ -174,6 +228,131 @@ func loadZiplistEntry(buf *input) ([]byte, error) {
 	return nil, errors.New(fmt.Sprintf("rdb_go_redis_parser: unknown ziplist header byte: %d", header))
 }
 
+// 解析listpack的全部元素
+func loadListPack(b []byte) ([][]byte, error) {
+	buf := newInput(b)
+	header, err := buf.Slice(ListPackHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint16(header[4:]))
+	items := make([][]byte, 0, length)
+	for {
+		special, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if special == ListPackEnd {
+			break
+		}
+		if _, err = buf.Seek(-1, 1); err != nil {
+			return nil, err
+		}
+		entry, err := loadListPackEntry(buf)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entry)
+	}
+	return items, nil
+}
+
+func loadListPackEntry(buf *input) ([]byte, error) {
+	special, err := buf.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, 0)
+	skip := 0
+	if special&0x80 == 0 {
+		skip = 1
+		res = []byte(strconv.FormatInt(int64(special&0x7F), 10))
+	} else if special&0xC0 == 0x80 {
+		length := special & 0x3F
+		skip = 1 + int(length)
+		res, err = buf.Slice(int(length))
+		if err != nil {
+			return nil, err
+		}
+	} else if special&0xE0 == 0xC0 {
+		skip = 2
+		next, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		//int64(int32(uint32(special&0x1F)<<8|uint32(next)) << 19 >> 19)
+		res = []byte(strconv.FormatInt(int64(int32(uint32(special&0x1F)<<8|uint32(next))<<19>>19), 10))
+	} else if special&0xFF == 0xF1 {
+		skip = 3
+		b, err := buf.Slice(2)
+		if err != nil {
+			return nil, err
+		}
+		res = []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10))
+	} else if special&0xFF == 0xF2 {
+		skip = 4
+		intBytes := make([]byte, 4)
+		_, err := buf.Read(intBytes[1:])
+		if err != nil {
+			return nil, err
+		}
+		res = []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(intBytes))>>8), 10))
+	} else if special&0xFF == 0xF3 {
+		skip = 5
+		intBytes, err := buf.Slice(4)
+		if err != nil {
+			return nil, err
+		}
+		res = []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(intBytes))), 10))
+	} else if special&0xFF == 0xF4 {
+		skip = 9
+		intBytes, err := buf.Slice(8)
+		if err != nil {
+			return nil, err
+		}
+		res = []byte(strconv.FormatInt(int64(binary.LittleEndian.Uint64(intBytes)), 10))
+	} else if special&0xF0 == 0xE0 {
+		b, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length := int(special&0x0F)<<8 | int(b)
+		skip = 2 + length
+		res, err = buf.Slice(length)
+		if err != nil {
+			return nil, err
+		}
+	} else if special&0xFF == 0xf0 {
+		lenBytes, err := buf.Slice(4)
+		if err != nil {
+			return nil, err
+		}
+		length := uint64(binary.LittleEndian.Uint32(lenBytes))
+		skip = 5 + int(length)
+		res, err = buf.Slice(int(length))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("Unknown encoding type! ")
+	}
+
+	// element-total-len
+	if skip <= 127 {
+		buf.Seek(1, 1)
+	} else if skip < 16383 {
+		buf.Seek(2, 1)
+	} else if skip < 2097151 {
+		buf.Seek(3, 1)
+	} else if skip < 268435455 {
+		buf.Seek(4, 1)
+	} else {
+		buf.Seek(5, 1)
+	}
+	return res, err
+}
+
 func ToString(i interface{}) string {
 	switch v := i.(type) {
 	case string:
@@ -193,5 +372,5 @@ func ToTime(t int64) time.Time {
 	if t <= 0 {
 		return time.Time{}
 	}
-	return time.Unix(t/1000, 0).UTC()
+	return time.Unix(t/1000, (t%1000)*int64(time.Millisecond)).UTC()
 }
@@ -14,6 +14,7 @@ const (
 
 	ErrNotSupportOutType = "not support out type"
 	ErrIllegalZSetData   = "illegal zset data"
+	ErrIllegalHashData   = "illegal hash data"
 	ErrUnknownDataFormat = "unknown data format"
 	OutInfoFormat        = "info %s:%s"
 )
@@ -21,11 +22,47 @@ const (
 // write out data
 func (p *RDBParser) write(object TypeObject) error {
 	switch object.Type() {
-	case AuxField{}.Type():
+	case AuxField{}.Type(), ModuleAux{}.Type():
 		if p.parseArg.ExtInfo == false {
 			return nil
 		}
+	case SelectionDB{}.Type(), ResizeDB{}.Type():
 	default:
+		if p.skipKey {
+			return nil
+		}
+		object = p.withKeyInfo(object)
 	}
 	return p.handler(p.ctx, object)
 }
+
+// 设置key在rdb中的编码以及估算的内存
+func (p *RDBParser) withKeyInfo(object TypeObject) TypeObject {
+	encoding := encodingOf(object, p.keyType)
+	memory := p.memory.usage(object, p.keyType, p.keyFirst, p.streamBytes)
+	p.keyFirst = false
+	switch o := object.(type) {
+	case StringObject:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case ListObject:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case Set:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case HashMap:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case SortedSet:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case RedisStream:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	case ModuleObject:
+		o.Enc, o.Memory = encoding, memory
+		return o
+	}
+	return object
+}
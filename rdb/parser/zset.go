@@ -5,6 +5,7 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -15,6 +16,10 @@ type SortedSet struct {
 	Len     uint64           `json:"len"`
 	Entries []SortedSetEntry `json:"entries"`
 	Expire  int64            `json:"expire"`
+	LruIdle int64            `json:"lruIdle"`
+	LfuFreq int64            `json:"lfuFreq"`
+	Memory  uint64           `json:"memory"`
+	Enc     string           `json:"encoding"`
 }
 
 type SortedSetEntry struct {
@@ -32,6 +37,8 @@ func (p *RDBParser) readZSet(key KeyObject, t byte) error {
 		Len:     length,
 		Entries: make([]SortedSetEntry, 0, length),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := uint64(0); i < length; i++ {
 		member, err := p.loadString()
@@ -69,6 +76,8 @@ func (p *RDBParser) readZipListSortSet(key KeyObject) error {
 		Len:     uint64(cardinality),
 		Entries: make([]SortedSetEntry, 0, cardinality),
 		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
 	}
 	for i := int64(0); i < cardinality; i++ {
 		member, err := loadZiplistEntry(buf)
@@ -88,6 +97,38 @@ func (p *RDBParser) readZipListSortSet(key KeyObject) error {
 	return p.write(sortedSet)
 }
 
+func (p *RDBParser) readZSetListPack(key KeyObject) error {
+	b, err := p.loadString()
+	if err != nil {
+		return err
+	}
+	items, err := loadListPack(b)
+	if err != nil {
+		return err
+	}
+	if len(items)%2 != 0 {
+		return errors.New(ErrIllegalZSetData)
+	}
+	cardinality := len(items) / 2
+
+	sortedSet := SortedSet{
+		Field:   key.Field,
+		Len:     uint64(cardinality),
+		Entries: make([]SortedSetEntry, 0, cardinality),
+		Expire:  key.Expire,
+		LruIdle: key.LruIdle,
+		LfuFreq: key.LfuFreq,
+	}
+	for i := 0; i < len(items); i += 2 {
+		score, err := strconv.ParseFloat(string(items[i+1]), 64)
+		if err != nil {
+			return err
+		}
+		sortedSet.Entries = append(sortedSet.Entries, SortedSetEntry{Field: ToString(items[i]), Score: score})
+	}
+	return p.write(sortedSet)
+}
+
 func (zs SortedSet) Type() string {
 	return ObjectTypeSortedSet
 }
@@ -128,21 +169,45 @@ func (zs SortedSet) ConcreteSize() uint64 {
 	return size
 }
 
+func (zs SortedSet) Idle() int64 {
+	return zs.LruIdle
+}
+
+// 估算的内存
+func (zs SortedSet) MemoryUsage() uint64 {
+	return zs.Memory
+}
+
+// rdb中的编码
+func (zs SortedSet) Encoding() string {
+	return zs.Enc
+}
+
+func (zs SortedSet) Freq() int64 {
+	return zs.LfuFreq
+}
+
 func (zs SortedSet) JSON() ([]byte, error) {
 	if zs.Expire > 0 {
 		return json.Marshal(JSONExpireFormat{
-			KeyType: ObjectTypeSortedSet,
-			Key:     zs.Key(),
-			Value:   zs.Entries,
-			Expire:  zs.Expire,
+			KeyType:  ObjectTypeSortedSet,
+			Key:      zs.Key(),
+			Idle:     lruValue(zs.LruIdle),
+			Freq:     lruValue(zs.LfuFreq),
+			Encoding: zs.Encoding(),
+			Value:    zs.Entries,
+			Expire:   zs.Expire,
 		})
 	}
 	return json.Marshal(JSONFormat{
-		KeyType: ObjectTypeSortedSet,
-		Key:     zs.Key(),
-		Value:   zs.Entries,
+		KeyType:  ObjectTypeSortedSet,
+		Key:      zs.Key(),
+		Idle:     lruValue(zs.LruIdle),
+		Freq:     lruValue(zs.LfuFreq),
+		Encoding: zs.Encoding(),
+		Value:    zs.Entries,
 	})
 }
 func (zs SortedSet) KV() ([]byte, error) {
-	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeSortedSet, zs.Key(), zs.Value(), zs.Expire)), nil
+	return []byte(fmt.Sprintf(OutKVFormat, ObjectTypeSortedSet, zs.Key(), zs.Value(), zs.Expire, zs.LruIdle, zs.LfuFreq, zs.Encoding())), nil
 }
@@ -0,0 +1,99 @@
+/*
+ *Descript:将解析的object写成aof文件(resp格式的命令)
+ */
+package writer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/aof"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/dump"
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const ErrAofWriterClosed = "aof writer closed"
+
+// aof写入器:按照解析的顺序将每个key重写为最少的命令,最后Close写入缓冲区
+type AofWriter struct {
+	writer   *bufio.Writer
+	arg      aof.RewriteArg
+	db       int64 // 已经select的db,-1为还没有select
+	commands int64 // 写入的命令数量
+	closed   bool
+}
+
+// 创建一个aof写入器
+func NewAofWriter(w io.Writer, arg aof.RewriteArg) *AofWriter {
+	return &AofWriter{
+		writer: bufio.NewWriterSize(w, defaultBufferSize),
+		arg:    arg,
+		db:     -1,
+	}
+}
+
+// 作为解析器的handler:解析时需要开启MergeQuickList,每个list重写为一组命令
+func (w *AofWriter) Handler(ctx context.Context, object parser.TypeObject) error {
+	return w.WriteObject(object)
+}
+
+// 写入一个object:切换db时写入SELECT
+func (w *AofWriter) WriteObject(object parser.TypeObject) error {
+	if w.closed {
+		return errors.New(ErrAofWriterClosed)
+	}
+	if o, ok := object.(parser.SelectionDB); ok {
+		if int64(o.Index) == w.db {
+			return nil
+		}
+		w.db = int64(o.Index)
+		return w.WriteCommand([]string{"SELECT", strconv.FormatUint(o.Index, 10)})
+	}
+	return aof.RewriteObject(object, w.arg, w.WriteCommand)
+}
+
+// 写入一个resp格式的命令
+func (w *AofWriter) WriteCommand(cmd []string) error {
+	if len(cmd) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(cmd)-1)
+	for _, arg := range cmd[1:] {
+		args = append(args, arg)
+	}
+	if err := dump.Encode(w.writer, dump.NewCommand(cmd[0], args...), false); err != nil {
+		return errors.Wrap(err, "write aof command")
+	}
+	w.commands++
+	return nil
+}
+
+// 写入的命令数量
+func (w *AofWriter) Commands() int64 {
+	return w.commands
+}
+
+// 写入剩余的数据
+func (w *AofWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.writer.Flush(); err != nil {
+		return errors.Wrap(err, "flush aof")
+	}
+	return nil
+}
+
+// 将重放aof得到的keyspace重写为最少的命令(离线bgrewriteaof)
+func RewriteKeyspace(ctx context.Context, keyspace *aof.Keyspace, w io.Writer, arg aof.RewriteArg) error {
+	aw := NewAofWriter(w, arg)
+	if err := keyspace.Export(ctx, aw.Handler); err != nil {
+		return err
+	}
+	return aw.Close()
+}
@@ -0,0 +1,177 @@
+/*
+ *Descript:将解析的object写成rdb文件
+ */
+package writer
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/qianxiansheng90/go-redis-tool/rdb/parser"
+)
+
+const (
+	ErrWriterClosed   = "rdb writer closed"
+	ErrRDBVersion     = "rdb version not support"
+	ErrObjectVersion  = "object need higher rdb version"
+	ErrUnknownObject  = "unknown object type"
+	checksumVersion   = 5 // rdb版本5开始末尾有crc64
+	auxVersion        = 7 // rdb版本7开始有aux和resize db
+	lruVersion        = 9 // rdb版本9开始有idle和freq
+	moduleAuxVersion  = 9 // rdb版本9开始有module aux
+	maxLfuFreq        = 255
+	defaultBufferSize = 64 * 1024
+)
+
+// 写入参数
+type WriterArg struct {
+	Version  int  // rdb版本,默认为parser.VersionMax,需要不小于object需要的版本
+	Compress bool // 使用LZF压缩字符串(rdbcompression yes)
+}
+
+// rdb写入器:按照解析的顺序写入object,最后Close写入EOF和crc64
+type RDBWriter struct {
+	writer  *bufio.Writer
+	arg     WriterArg
+	encoder *parser.Encoder
+	crc     uint64
+	closed  bool
+}
+
+// 创建一个写入器并写入header
+func NewRDBWriter(w io.Writer, arg WriterArg) (*RDBWriter, error) {
+	if arg.Version == 0 {
+		arg.Version = parser.VersionMax
+	}
+	if arg.Version < parser.VersionMin || arg.Version > parser.VersionMax {
+		return nil, errors.New(fmt.Sprintf("%s %d", ErrRDBVersion, arg.Version))
+	}
+	rw := &RDBWriter{
+		writer:  bufio.NewWriterSize(w, defaultBufferSize),
+		arg:     arg,
+		encoder: parser.NewEncoder(arg.Compress),
+	}
+	if err := rw.write([]byte(fmt.Sprintf("%s%04d", parser.REDIS, arg.Version))); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// 作为解析器的handler:解析时需要开启MergeQuickList,每个list只写入一次
+func (w *RDBWriter) Handler(ctx context.Context, object parser.TypeObject) error {
+	return w.WriteObject(object)
+}
+
+// 写入一个object
+func (w *RDBWriter) WriteObject(object parser.TypeObject) error {
+	if w.closed {
+		return errors.New(ErrWriterClosed)
+	}
+	return w.writeObject(object)
+}
+
+// 按照object类型写入
+func (w *RDBWriter) writeObject(object parser.TypeObject) error {
+	e := w.encoder
+	e.Reset()
+	switch o := object.(type) {
+	case parser.AuxField:
+		if w.arg.Version < auxVersion {
+			return nil
+		}
+		e.SaveRaw(parser.FlagOpcodeAux)
+		e.SaveString([]byte(o.Field))
+		e.SaveString([]byte(o.Val))
+	case parser.SelectionDB:
+		e.SaveRaw(parser.FlagOpcodeSelectDB)
+		e.SaveLen(o.Index)
+	case parser.ResizeDB:
+		if w.arg.Version < auxVersion {
+			return nil
+		}
+		e.SaveRaw(parser.FlagOpcodeResizeDB)
+		e.SaveLen(o.DBSize)
+		e.SaveLen(o.ExpireSize)
+	case parser.ModuleAux:
+		if w.arg.Version < moduleAuxVersion {
+			return errors.New(fmt.Sprintf("%s %s %d", ErrObjectVersion, o.Type(), moduleAuxVersion))
+		}
+		e.SaveRaw(parser.FlagOpcodeModuleAux)
+		e.SaveLen(o.ModuleId)
+		e.SaveLen(parser.TypeModuleOpcodeUInt)
+		e.SaveLen(o.When)
+		e.SaveRaw(o.Payload...)
+	case parser.StringObject, parser.ListObject, parser.Set, parser.HashMap, parser.SortedSet, parser.RedisStream, parser.ModuleObject:
+		if err := w.saveKey(object); err != nil {
+			return err
+		}
+	default:
+		return errors.New(fmt.Sprintf("%s %s", ErrUnknownObject, object.Type()))
+	}
+	return w.write(e.Bytes())
+}
+
+// 写入key:过期时间,lru/lfu,类型,key,value
+func (w *RDBWriter) saveKey(object parser.TypeObject) error {
+	value := parser.NewEncoder(w.arg.Compress)
+	t, version, err := value.SaveObject(object)
+	if err != nil {
+		return errors.Wrap(err, "encode key "+object.Key())
+	}
+	if version > w.arg.Version {
+		return errors.New(fmt.Sprintf("%s %s %s %d", ErrObjectVersion, object.Type(), object.Key(), version))
+	}
+	e := w.encoder
+	if expire := parser.ExpireOf(object); expire > 0 {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(expire))
+		e.SaveRaw(parser.FlagOpcodeExpireTimeMs)
+		e.SaveRaw(b...)
+	}
+	if w.arg.Version >= lruVersion {
+		if idle := object.Idle(); idle != parser.NoLruIdle {
+			e.SaveRaw(parser.FlagOpcodeIdle)
+			e.SaveLen(uint64(idle))
+		}
+		if freq := object.Freq(); freq != parser.NoLfuFreq && freq <= maxLfuFreq {
+			e.SaveRaw(parser.FlagOpcodeFreq, byte(freq))
+		}
+	}
+	e.SaveRaw(t)
+	e.SaveString([]byte(object.Key()))
+	e.SaveRaw(value.Bytes()...)
+	return nil
+}
+
+// 写入数据并计算crc64
+func (w *RDBWriter) write(b []byte) error {
+	w.crc = parser.Crc64(w.crc, b)
+	if _, err := w.writer.Write(b); err != nil {
+		return errors.Wrap(err, "write rdb")
+	}
+	return nil
+}
+
+// 写入EOF和crc64(rdb版本5以上)
+func (w *RDBWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.write([]byte{parser.FlagOpcodeEOF}); err != nil {
+		return err
+	}
+	if w.arg.Version >= checksumVersion {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, w.crc)
+		if _, err := w.writer.Write(b); err != nil {
+			return errors.Wrap(err, "write rdb checksum")
+		}
+	}
+	return w.writer.Flush()
+}
@@ -0,0 +1,60 @@
+/*
+ *Descript:tls配置,dump和load共用
+ */
+package tls_config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ErrTLSCertKeyPair = "tls cert file and key file must be set together"
+	ErrTLSCAFile      = "no valid certificate in tls ca file"
+)
+
+// tls参数
+type TLSArg struct {
+	Enable             bool   // 开启tls
+	CAFile             string // 校验服务端证书的ca文件,为空则使用系统ca
+	CertFile           string // 客户端证书(双向认证)
+	KeyFile            string // 客户端证书的私钥(双向认证)
+	ServerName         string // 校验的服务端名称(SNI),为空则使用连接的地址
+	InsecureSkipVerify bool   // 不校验服务端证书
+}
+
+// 生成tls.Config:没有开启tls时返回nil
+func (t TLSArg) Config() (*tls.Config, error) {
+	if !t.Enable {
+		return nil, nil
+	}
+	conf := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read tls ca file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New(ErrTLSCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New(ErrTLSCertKeyPair)
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls cert key pair")
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
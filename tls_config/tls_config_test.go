@@ -0,0 +1,267 @@
+package tls_config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试用的证书:ca签发的服务端证书和客户端证书
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// 生成证书:parent为空时生成自签名的ca
+func newTestCert(t *testing.T, name string, parent *testCert, dnsNames []string, ips []net.IP) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// 写入文件,返回路径
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// 启动tls服务端,每个连接完成握手之后关闭
+func startTLSServer(t *testing.T, ca, server *testCert, clientAuth bool) net.Listener {
+	pair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{pair}}
+	if clientAuth {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				conn.Write([]byte("+PONG\r\n"))
+			}()
+		}
+	}()
+	return ln
+}
+
+// 使用TLSArg的配置连接并完成握手(和dump/load一样通过tls.DialWithDialer连接)
+func handshake(arg TLSArg, addr string) error {
+	conf, err := arg.Config()
+	if err != nil {
+		return err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// tls1.3的客户端证书在读取服务端数据时才会校验
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 7))
+	return err
+}
+
+func TestTLSArgConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "test ca", nil, nil, nil)
+	otherCA := newTestCert(t, "other ca", nil, nil, nil)
+	server := newTestCert(t, "redis server", ca, []string{"redis.test"}, []net.IP{net.ParseIP("127.0.0.1")})
+	client := newTestCert(t, "redis client", ca, nil, nil)
+	otherClient := newTestCert(t, "other client", otherCA, nil, nil)
+
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM)
+	otherCAFile := writeFile(t, dir, "other_ca.pem", otherCA.certPEM)
+	badCAFile := writeFile(t, dir, "bad_ca.pem", []byte("not a certificate"))
+	clientCert := writeFile(t, dir, "client.pem", client.certPEM)
+	clientKey := writeFile(t, dir, "client.key", client.keyPEM)
+	otherClientCert := writeFile(t, dir, "other_client.pem", otherClient.certPEM)
+	otherClientKey := writeFile(t, dir, "other_client.key", otherClient.keyPEM)
+
+	ln := startTLSServer(t, ca, server, false)
+	defer ln.Close()
+	mutualLn := startTLSServer(t, ca, server, true)
+	defer mutualLn.Close()
+	addr, mutualAddr := ln.Addr().String(), mutualLn.Addr().String()
+
+	cases := []struct {
+		name    string
+		arg     TLSArg
+		addr    string
+		wantErr string // 为空表示握手成功
+	}{
+		{
+			name: "verified by ca",
+			arg:  TLSArg{Enable: true, CAFile: caFile},
+			addr: addr,
+		},
+		{
+			name:    "ca mismatch",
+			arg:     TLSArg{Enable: true, CAFile: otherCAFile},
+			addr:    addr,
+			wantErr: "certificate",
+		},
+		{
+			name: "insecure skip verify",
+			arg:  TLSArg{Enable: true, CAFile: otherCAFile, InsecureSkipVerify: true},
+			addr: addr,
+		},
+		{
+			name: "server name override",
+			arg:  TLSArg{Enable: true, CAFile: caFile, ServerName: "redis.test"},
+			addr: addr,
+		},
+		{
+			name:    "server name mismatch",
+			arg:     TLSArg{Enable: true, CAFile: caFile, ServerName: "other.test"},
+			addr:    addr,
+			wantErr: "other.test",
+		},
+		{
+			name: "mutual tls",
+			arg:  TLSArg{Enable: true, CAFile: caFile, CertFile: clientCert, KeyFile: clientKey},
+			addr: mutualAddr,
+		},
+		{
+			name:    "mutual tls without client cert",
+			arg:     TLSArg{Enable: true, CAFile: caFile},
+			addr:    mutualAddr,
+			wantErr: "certificate",
+		},
+		{
+			name:    "mutual tls client cert from other ca",
+			arg:     TLSArg{Enable: true, CAFile: caFile, CertFile: otherClientCert, KeyFile: otherClientKey},
+			addr:    mutualAddr,
+			wantErr: "certificate",
+		},
+		{
+			name:    "cert without key",
+			arg:     TLSArg{Enable: true, CertFile: clientCert},
+			wantErr: ErrTLSCertKeyPair,
+		},
+		{
+			name:    "key without cert",
+			arg:     TLSArg{Enable: true, KeyFile: clientKey},
+			wantErr: ErrTLSCertKeyPair,
+		},
+		{
+			name:    "cert and key not a pair",
+			arg:     TLSArg{Enable: true, CertFile: clientCert, KeyFile: otherClientKey},
+			wantErr: "load tls cert key pair",
+		},
+		{
+			name:    "invalid ca file",
+			arg:     TLSArg{Enable: true, CAFile: badCAFile},
+			wantErr: ErrTLSCAFile,
+		},
+		{
+			name:    "missing ca file",
+			arg:     TLSArg{Enable: true, CAFile: filepath.Join(dir, "missing.pem")},
+			wantErr: "read tls ca file",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var err error
+			if c.addr == "" {
+				_, err = c.arg.Config()
+			} else {
+				err = handshake(c.arg, c.addr)
+			}
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("error %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSArgDisabled(t *testing.T) {
+	conf, err := TLSArg{CAFile: "missing.pem"}.Config()
+	if conf != nil || err != nil {
+		t.Fatalf("disabled tls got %v %v", conf, err)
+	}
+}